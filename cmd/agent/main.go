@@ -1,21 +1,30 @@
 // Agent main package.
-// Agent collects metrics and sends them to the server
+// Agent collects metrics and sends them to the server.
+// In replay mode (agent replay -record=file) agent sends recorded data to the server again.
 package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/DarkOmap/metricsService/internal/agent"
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
 	"github.com/DarkOmap/metricsService/internal/build"
 	"github.com/DarkOmap/metricsService/internal/client"
+	"github.com/DarkOmap/metricsService/internal/identity"
 	"github.com/DarkOmap/metricsService/internal/logger"
-	"github.com/DarkOmap/metricsService/internal/memstats"
 	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/DarkOmap/metricsService/internal/spool"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -26,41 +35,166 @@ var (
 
 func main() {
 	build.DisplayBuild(buildVersion, buildDate, buildCommit)
+
+	replayMode := len(os.Args) > 1 && os.Args[1] == "replay"
+	if replayMode {
+		os.Args = slices.Delete(os.Args, 1, 2)
+	}
+
 	p := parameters.ParseFlagsAgent()
 
 	if err := logger.Initialize("INFO", "stderr"); err != nil {
 		panic(err)
 	}
 
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	if replayMode {
+		if err := replay(ctx, p); err != nil {
+			logger.Log.Fatal("Replay", zap.Error(err))
+		}
+
+		return
+	}
+
+	// spool is shared by agents restarted with new config
+	var s *spool.Spool
+	if p.SpoolDir != "" {
+		var err error
+		s, err = spool.NewSpool(p.SpoolDir, int64(p.SpoolMaxSize), time.Duration(p.SpoolMaxAge)*time.Second)
+		if err != nil {
+			logger.Log.Fatal("Create spool", zap.Error(err))
+		}
+	}
+
+	sv := agentconfig.NewSupervisor(p, func(p parameters.AgentParameters) (agentconfig.Agent, error) {
+		return newRunner(p, s)
+	})
+
+	logger.Log.Info("Agent start")
+	if err := sv.Run(ctx); err != nil {
+		logger.Log.Fatal("Run agent", zap.Error(err))
+	}
+}
+
+// replay sends data recorded in the record file by usual client
+func replay(ctx context.Context, p parameters.AgentParameters) error {
+	if p.RecordFile == "" {
+		return errors.New("record file isn't set")
+	}
+
+	f, err := os.Open(p.RecordFile)
+	if err != nil {
+		return fmt.Errorf("open record file: %w", err)
+	}
+	defer f.Close()
+
+	// replayed data isn't recorded again
+	p.RecordFile = ""
+
+	c, err := client.NewClient(p)
+	if err != nil {
+		return fmt.Errorf("create client: %w", err)
+	}
+	defer c.Close()
+
+	logger.Log.Info("Replay start", zap.String("file", f.Name()), zap.Float64("speed", p.ReplaySpeed))
+
+	return client.Replay(ctx, c, f, p.ReplaySpeed)
+}
+
+// runner it's agent with its client and push listener
+type runner struct {
+	client.Client
+	agent    *agent.Agent
+	listener *agent.Listener
+}
+
+func newRunner(p parameters.AgentParameters, s *spool.Spool) (*runner, error) {
 	logger.Log.Info("Create client")
 	c, err := client.NewClient(p)
 	if err != nil {
-		logger.Log.Fatal("Create client", zap.Error(err))
+		return nil, fmt.Errorf("create client: %w", err)
 	}
 
-	defer func() {
-		err := c.Close()
-		if err != nil {
-			logger.Log.Fatal("Close client", zap.Error(err))
-		}
-	}()
+	r := &runner{Client: c}
+	if err := r.setAgent(p, s); err != nil {
+		c.Close()
+		return nil, err
+	}
 
-	logger.Log.Info("Init mem stats")
-	ms, err := memstats.NewForServer()
+	return r, nil
+}
+
+func (r *runner) setAgent(p parameters.AgentParameters, s *spool.Spool) error {
+	logger.Log.Info("Create collectors")
+	jobs, err := agent.NewRegistry().Jobs(p)
 	if err != nil {
-		logger.Log.Fatal("Create mem stats", zap.Error(err))
+		return fmt.Errorf("create collectors: %w", err)
+	}
+
+	if p.PushHTTPAddr != "" || p.PushUDPAddr != "" {
+		r.listener = agent.NewListener(p.PushHTTPAddr, p.PushUDPAddr)
+		jobs = append(jobs, agent.Job{Collector: r.listener, Name: "push", Interval: time.Duration(p.PollInterval) * time.Second})
 	}
 
 	logger.Log.Info("Create agent")
-	a := agent.NewAgent(c, ms, p.ReportInterval, p.PollInterval)
+	a := agent.NewAgent(r.Client, p.ReportInterval, p.RateLimit, jobs...)
 
-	logger.Log.Info("Agent start")
+	if s != nil {
+		a.SetSpool(s)
+	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	defer cancel()
+	if len(p.Rules) != 0 {
+		pl, err := agent.NewPipeline(p.Rules)
+		if err != nil {
+			a.Close()
+			return fmt.Errorf("create metric pipeline: %w", err)
+		}
 
-	err = a.Run(ctx)
-	if err != nil {
-		logger.Log.Fatal("Run agent", zap.Error(err))
+		a.SetPipeline(pl)
 	}
+
+	if p.IdentityLabel != "" {
+		if err := a.SetInstanceLabel(identity.New(p.Instance, p.ReportInterval).Instance, p.IdentityLabel); err != nil {
+			a.Close()
+			return fmt.Errorf("set instance label: %w", err)
+		}
+	}
+
+	if p.ChangesOnly {
+		a.SetChangesOnly(p.ChangeEpsilon, p.FullRefresh)
+	}
+
+	r.agent = a
+
+	return nil
+}
+
+// Close closes collectors of agent and client
+func (r *runner) Close() error {
+	var err error
+	if r.agent != nil {
+		err = r.agent.Close()
+	}
+
+	return errors.Join(err, r.Client.Close())
+}
+
+// Run runs agent and push listener
+func (r *runner) Run(ctx context.Context) error {
+	eg, egCtx := errgroup.WithContext(ctx)
+
+	if r.listener != nil {
+		eg.Go(func() error {
+			return r.listener.Run(egCtx)
+		})
+	}
+
+	eg.Go(func() error {
+		return r.agent.Run(egCtx)
+	})
+
+	return eg.Wait()
 }
@@ -6,12 +6,15 @@ import (
 	"context"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/DarkOmap/metricsService/internal/auth"
 	"github.com/DarkOmap/metricsService/internal/build"
 	"github.com/DarkOmap/metricsService/internal/compresses"
 	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/DarkOmap/metricsService/internal/inventory"
 	"github.com/DarkOmap/metricsService/internal/ip"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/parameters"
@@ -45,14 +48,27 @@ var (
 //	@Tag.name			Value
 //	@Tag.description	"Query group for metrics data retrieval"
 
+//	@Tag.name			Tenants
+//	@Tag.description	"Query group for tenants administration"
+
+//	@Tag.name			Agents
+//	@Tag.description	"Query group for agents inventory"
+
+//	@Tag.name			Agent
+//	@Tag.description	"Query group for agents configuration"
+
 func main() {
 	build.DisplayBuild(buildVersion, buildDate, buildCommit)
-	p := parameters.ParseFlagsServer()
+	p, err := parameters.ParseFlagsServer()
 
 	if err := logger.Initialize("INFO", "stderr"); err != nil {
 		panic(err)
 	}
 
+	if err != nil {
+		logger.Log.Fatal("Parse parameters", zap.Error(err))
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
 
@@ -69,24 +85,38 @@ func main() {
 	}()
 
 	logger.Log.Info("Create IP checker")
-	ipc := ip.NewChecker(p.TrustedSubnet)
+	ipc := ip.NewChecker(p.TrustedSubnets, p.DeniedSubnets, p.TrustedProxies)
 
 	logger.Log.Info("Create hasher pool")
-	h := hasher.NewHasher([]byte(p.HashKey), p.RateLimit)
+	h := hasher.NewHasher(
+		[]byte(p.HashKey),
+		p.RateLimit,
+		hasher.WithClockSkew(time.Duration(p.ClockSkew)*time.Second),
+		hasher.WithNonceCacheSize(p.NonceCacheSize),
+	)
 	defer h.Close()
 
+	logger.Log.Info("Create authenticator")
+	a, err := auth.NewAuthenticator(p.TokensPath)
+	if err != nil {
+		logger.Log.Fatal("Create authenticator", zap.Error(err))
+	}
+
 	logger.Log.Info("Create gzip pool")
 	gzipPool := compresses.NewGzipPool(p.RateLimit)
 	defer gzipPool.Close()
 
+	logger.Log.Info("Create agents inventory")
+	inv := inventory.NewInventory(time.Duration(p.AgentReportInterval)*time.Second, p.AgentStaleIntervals, ipc)
+
 	opts := make([]server.OptionFunc, 0, 2)
 
 	if p.FlagRunAddr != "" {
-		opts = append(opts, server.WithHTTP(r, ipc, h, gzipPool, p))
+		opts = append(opts, server.WithHTTP(r, ipc, h, gzipPool, a, inv, p))
 	}
 
 	if p.FlagRunGRPCAddr != "" {
-		opts = append(opts, server.WithGRPC(r, ipc, h, p))
+		opts = append(opts, server.WithGRPC(r, ipc, h, a, inv, p))
 	}
 
 	logger.Log.Info("Create server")
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 
+	"github.com/DarkOmap/metricsService/internal/auth"
 	"github.com/DarkOmap/metricsService/internal/models"
 	"github.com/DarkOmap/metricsService/internal/proto"
 	"google.golang.org/grpc/codes"
@@ -32,6 +33,10 @@ func (s *MetricsServer) Update(ctx context.Context, req *proto.UpdateRequest) (*
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	if err := auth.Check(ctx, auth.ScopeWrite, m.ID); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
 	rM, err := s.r.UpdateByMetrics(ctx, *m)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -60,6 +65,10 @@ func (s *MetricsServer) Updates(ctx context.Context, req *proto.UpdatesRequest)
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	if err := auth.Check(ctx, auth.ScopeWrite, metricsIDs(ms)...); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
 	err = s.r.Updates(ctx, ms)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
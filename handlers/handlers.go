@@ -4,15 +4,21 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"maps"
 	"net/http"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/DarkOmap/metricsService/internal/auth"
 	"github.com/DarkOmap/metricsService/internal/compresses"
 	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/DarkOmap/metricsService/internal/identity"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/models"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -25,6 +31,8 @@ const (
 	contentTypeCharsetUTF8 = "charset=utf-8"
 
 	headerContentType = "Content-Type"
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
 )
 
 // Decrypter describes the type for decrypting messages
@@ -39,12 +47,26 @@ type IPChecker interface {
 
 // ServiceHandlers structure with handlers
 type ServiceHandlers struct {
-	ms Repository
+	ms        Repository
+	configs   AgentConfigs
+	inventory Inventory
 }
 
 // NewServiceHandlers create ServiceHandlers
 func NewServiceHandlers(ms Repository) ServiceHandlers {
-	return ServiceHandlers{ms}
+	return ServiceHandlers{ms: ms}
+}
+
+// WithAgentConfigs returns handlers serving configs of agents from c
+func (sh ServiceHandlers) WithAgentConfigs(c AgentConfigs) ServiceHandlers {
+	sh.configs = c
+	return sh
+}
+
+// WithInventory returns handlers tracking agents in inv
+func (sh ServiceHandlers) WithInventory(inv Inventory) ServiceHandlers {
+	sh.inventory = inv
+	return sh
 }
 
 // UpdateByJSON godoc
@@ -70,6 +92,11 @@ func (sh *ServiceHandlers) updateByJSON(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := auth.AllowMetrics(r.Context(), m.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	m, err = sh.ms.UpdateByMetrics(r.Context(), *m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -119,6 +146,11 @@ func (sh *ServiceHandlers) updateByURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.AllowMetrics(r.Context(), m.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	_, err = sh.ms.UpdateByMetrics(r.Context(), *m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -152,6 +184,11 @@ func (sh *ServiceHandlers) valueByJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.AllowMetrics(r.Context(), m.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	m, err = sh.ms.ValueByMetrics(r.Context(), *m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
@@ -200,6 +237,11 @@ func (sh *ServiceHandlers) valueByURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.AllowMetrics(r.Context(), m.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	m, err = sh.ms.ValueByMetrics(r.Context(), *m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
@@ -278,6 +320,10 @@ func (sh *ServiceHandlers) all(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	maps.DeleteFunc(data, func(name string, _ fmt.Stringer) bool {
+		return auth.AllowMetrics(ctx, name) != nil
+	})
+
 	err = t.Execute(w, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -286,6 +332,66 @@ func (sh *ServiceHandlers) all(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Tenants godoc
+//
+//	@Tags			Tenants
+//	@Summary		Return tenants
+//	@Description	Return names of tenants having metrics. Requires admin scope.
+//	@ID				tenantsTenants
+//	@Accept			plain
+//	@Produce		json
+//	@Success		200	{array}		string
+//	@Failure		500	{string}	string
+//	@Security		ApiKeyAuth
+//	@Router			/tenants [get]
+func (sh *ServiceHandlers) tenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add(headerContentType, contentTypeApplicationJSON)
+	w.Header().Add(headerContentType, contentTypeCharsetUTF8)
+
+	tenants, err := sh.ms.Tenants(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(tenants)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// TenantAll godoc
+//
+//	@Tags			Tenants
+//	@Summary		Return all metrics of tenant
+//	@Description	Return all metric value of tenant. Requires admin scope.
+//	@ID				tenantsAll
+//	@Accept			plain
+//	@Produce		html
+//	@Param			tenant	path		string	true	"Tenant's name"	example("default")
+//	@Success		200		{string}	string
+//	@Failure		400		{string}	string
+//	@Failure		500		{string}	string
+//	@Security		ApiKeyAuth
+//	@Router			/tenants/{tenant} [get]
+func (sh *ServiceHandlers) tenantAll(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "tenant")
+	if err := tenant.Validate(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sh.all(w, r.WithContext(tenant.NewContext(r.Context(), name)))
+}
+
 // Ping godoc
 //
 //	@Summary		Ping storage
@@ -340,6 +446,11 @@ func (sh *ServiceHandlers) updates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.AllowMetrics(r.Context(), metricsIDs(m)...); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	err = sh.ms.Updates(r.Context(), m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -348,6 +459,100 @@ func (sh *ServiceHandlers) updates(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// AgentConfig godoc
+//
+//	@Tags			Agent
+//	@Summary		Return config of agent
+//	@Description	Return versioned config of the agent sending the request, config of agent's group or default config.
+//	@ID				agentConfig
+//	@Accept			plain
+//	@Produce		json
+//	@Param			group			query		string	false	"Agent's group"	example("prod")
+//	@Param			If-None-Match	header		string	false	"Version of the applied config"
+//	@Success		200				{object}	agentconfig.Document
+//	@Success		304				{string}	string
+//	@Failure		404				{string}	string
+//	@Failure		500				{string}	string
+//	@Security		ApiKeyAuth
+//	@Router			/agent/config [get]
+func (sh *ServiceHandlers) agentConfig(w http.ResponseWriter, r *http.Request) {
+	if sh.configs == nil {
+		http.Error(w, agentconfig.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	id, _ := identity.FromContext(r.Context())
+
+	d, err := sh.configs.Get(id.Instance, r.URL.Query().Get("group"))
+	if errors.Is(err, agentconfig.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := `"` + d.Version + `"`
+	w.Header().Set(headerETag, etag)
+
+	if r.Header.Get(headerIfNoneMatch) == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	resp, err := json.Marshal(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add(headerContentType, contentTypeApplicationJSON)
+	w.Header().Add(headerContentType, contentTypeCharsetUTF8)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Agents godoc
+//
+//	@Tags			Agents
+//	@Summary		Return agents
+//	@Description	Return agents seen by the server with their last request time. Requires admin scope.
+//	@ID				agentsAgents
+//	@Accept			plain
+//	@Produce		json
+//	@Success		200	{array}		inventory.Agent
+//	@Failure		404	{string}	string
+//	@Failure		500	{string}	string
+//	@Security		ApiKeyAuth
+//	@Router			/agents [get]
+func (sh *ServiceHandlers) agents(w http.ResponseWriter, r *http.Request) {
+	if sh.inventory == nil {
+		http.Error(w, "agents aren't tracked", http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(sh.inventory.Agents())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add(headerContentType, contentTypeApplicationJSON)
+	w.Header().Add(headerContentType, contentTypeCharsetUTF8)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func getModelsByJSON(body io.ReadCloser) (*models.Metrics, error) {
 	var buf bytes.Buffer
 	_, err := buf.ReadFrom(body)
@@ -363,30 +568,69 @@ func getModelsByJSON(body io.ReadCloser) (*models.Metrics, error) {
 	return m, err
 }
 
+func metricsIDs(ms []models.Metrics) []string {
+	ids := make([]string, len(ms))
+	for i, m := range ms {
+		ids[i] = m.ID
+	}
+
+	return ids
+}
+
 // ServiceRouter return router for run server.
-func ServiceRouter(gp *compresses.GzipPool, hasher *hasher.Hasher, sh ServiceHandlers, dm Decrypter, ipChecker IPChecker) chi.Router {
+// Metrics routes require a token with the corresponding scope when authenticator has tokens.
+// Metrics routes work with the tenant of the token or the X-Tenant header.
+func ServiceRouter(gp *compresses.GzipPool, hasher *hasher.Hasher, sh ServiceHandlers, dm Decrypter, ipChecker IPChecker, a *auth.Authenticator) chi.Router {
 	r := chi.NewRouter()
 	r.Use(dm.RequestDecrypt)
 	r.Use(hasher.RequestHash)
 	r.Use(gp.RequestCompress)
+	r.Use(hasher.ResponseHash)
 	r.Use(ipChecker.RequsetIPCheck)
 	r.Use(logger.RequestLogger)
+	// agents are tracked by write requests, which are authorized
+	track := func(next http.Handler) http.Handler { return next }
+	if sh.inventory != nil {
+		track = sh.inventory.RequestTrack
+	}
+
 	r.Route("/", func(r chi.Router) {
-		r.Get("/", sh.all)
-		r.Route("/update", func(r chi.Router) {
-			r.Post("/", sh.updateByJSON)
-			r.Post("/{type}/{name}/{value}", sh.updateByURL)
-		})
-		r.Route("/value", func(r chi.Router) {
-			r.Post("/", sh.valueByJSON)
-			r.Get("/{type}/{name}", sh.valueByURL)
+		r.Group(func(r chi.Router) {
+			r.Use(a.RequestAuth)
+			r.Use(tenant.RequestTenant)
+			r.Use(identity.RequestIdentity)
+			r.With(a.RequireScope(auth.ScopeRead)).Get("/", sh.all)
+			r.Route("/update", func(r chi.Router) {
+				r.Use(a.RequireScope(auth.ScopeWrite), track)
+				r.Post("/", sh.updateByJSON)
+				r.Post("/{type}/{name}/{value}", sh.updateByURL)
+			})
+			r.Route("/value", func(r chi.Router) {
+				r.Use(a.RequireScope(auth.ScopeRead))
+				r.Post("/", sh.valueByJSON)
+				r.Get("/{type}/{name}", sh.valueByURL)
+			})
+			r.Route("/updates", func(r chi.Router) {
+				r.Use(a.RequireScope(auth.ScopeWrite), track)
+				r.Post("/", sh.updates)
+			})
+			r.Route("/agent/config", func(r chi.Router) {
+				r.Use(a.RequireScope(auth.ScopeWrite), track)
+				r.Get("/", sh.agentConfig)
+			})
+			r.Route("/agents", func(r chi.Router) {
+				r.Use(a.RequireScope(auth.ScopeAdmin))
+				r.Get("/", sh.agents)
+			})
+			r.Route("/tenants", func(r chi.Router) {
+				r.Use(a.RequireScope(auth.ScopeAdmin))
+				r.Get("/", sh.tenants)
+				r.Get("/{tenant}", sh.tenantAll)
+			})
 		})
 		r.Route("/ping", func(r chi.Router) {
 			r.Get("/", sh.ping)
 		})
-		r.Route("/updates", func(r chi.Router) {
-			r.Post("/", sh.updates)
-		})
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL("swagger/doc.json")))
 	})
 
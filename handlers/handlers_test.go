@@ -1,16 +1,27 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/DarkOmap/metricsService/internal/auth"
 	"github.com/DarkOmap/metricsService/internal/compresses"
 	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/DarkOmap/metricsService/internal/identity"
+	"github.com/DarkOmap/metricsService/internal/inventory"
+	"github.com/DarkOmap/metricsService/internal/ip"
 	"github.com/DarkOmap/metricsService/internal/models"
+	"github.com/DarkOmap/metricsService/internal/parameters"
 	"github.com/DarkOmap/metricsService/internal/storage"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
@@ -33,7 +44,7 @@ func TestServiceHandlers_updateByJSON(t *testing.T) {
 
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -130,7 +141,7 @@ func TestServiceHandlers_updateByJSON(t *testing.T) {
 		ipcmo := new(IPCheckerMockedObject)
 		sh := NewServiceHandlers(ms)
 		h := hasher.NewHasher(make([]byte, 0), 1)
-		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 		srv := httptest.NewServer(r)
 		defer srv.Close()
@@ -159,7 +170,7 @@ func TestServiceHandlers_updateByURL(t *testing.T) {
 	ipcmo := new(IPCheckerMockedObject)
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -229,7 +240,7 @@ func TestServiceHandlers_updateByURL(t *testing.T) {
 		ipcmo := new(IPCheckerMockedObject)
 		sh := NewServiceHandlers(ms)
 		h := hasher.NewHasher(make([]byte, 0), 1)
-		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 		srv := httptest.NewServer(r)
 		defer srv.Close()
@@ -273,7 +284,7 @@ func TestServiceHandlers_valueByURL(t *testing.T) {
 	ipcmo := new(IPCheckerMockedObject)
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -354,7 +365,7 @@ func TestServiceHandlers_all(t *testing.T) {
 	ipcmo := new(IPCheckerMockedObject)
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -438,7 +449,7 @@ func TestServiceHandlers_all(t *testing.T) {
 		ipcmo := new(IPCheckerMockedObject)
 		sh := NewServiceHandlers(ms)
 		h := hasher.NewHasher(make([]byte, 0), 1)
-		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 		srv := httptest.NewServer(r)
 		defer srv.Close()
@@ -475,7 +486,7 @@ func TestServiceHandlers_valueByJSON(t *testing.T) {
 	ipcmo := new(IPCheckerMockedObject)
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -558,7 +569,7 @@ func TestServiceHandlers_valueByJSON(t *testing.T) {
 		sh := NewServiceHandlers(ms)
 		ipcmo := new(IPCheckerMockedObject)
 		h := hasher.NewHasher(make([]byte, 0), 1)
-		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+		r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 		srv := httptest.NewServer(r)
 		defer srv.Close()
@@ -574,7 +585,7 @@ func TestServiceHandlers_ping(t *testing.T) {
 	ipcmo := new(IPCheckerMockedObject)
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -602,7 +613,7 @@ func TestServiceHandlers_updates(t *testing.T) {
 	ipcmo := new(IPCheckerMockedObject)
 	sh := NewServiceHandlers(ms)
 	h := hasher.NewHasher(make([]byte, 0), 1)
-	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, nil)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -651,3 +662,229 @@ func TestServiceHandlers_updates(t *testing.T) {
 		assert.Equal(t, http.StatusOK, res.StatusCode())
 	})
 }
+
+func TestServiceRouter_auth(t *testing.T) {
+	ms := new(StorageMockedObject)
+	ms.On("UpdateByMetrics", *models.NewMetricsForGauge("app_test", 12)).Return(models.NewMetricsForGauge("app_test", 12), nil)
+	ms.On("ValueByMetrics", models.Metrics{ID: "test", MType: "gauge"}).Return(models.NewMetricsForGauge("test", 12), nil)
+	ms.On("GetAll").Return(map[string]fmt.Stringer{
+		"app_test": storage.Gauge(1),
+		"test":     storage.Gauge(2),
+	}, nil)
+
+	a, err := auth.NewAuthenticator("./testdata/tokens.json")
+	require.NoError(t, err)
+
+	dmo := new(DecrypterMockedObject)
+	ipcmo := new(IPCheckerMockedObject)
+	sh := NewServiceHandlers(ms)
+	h := hasher.NewHasher(make([]byte, 0), 1)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, a)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name, method, url, token string
+		code                     int
+	}{
+		{"without token", http.MethodPost, "/update/gauge/app_test/12", "", http.StatusUnauthorized},
+		{"write allowed prefix", http.MethodPost, "/update/gauge/app_test/12", "write-token", http.StatusOK},
+		{"write wrong prefix", http.MethodPost, "/update/gauge/test/12", "write-token", http.StatusForbidden},
+		{"write with read scope", http.MethodPost, "/update/gauge/app_test/12", "read-token", http.StatusForbidden},
+		{"read with write scope", http.MethodGet, "/value/gauge/test", "write-token", http.StatusForbidden},
+		{"read", http.MethodGet, "/value/gauge/test", "read-token", http.StatusOK},
+		{"ping without token", http.MethodGet, "/ping", "", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := resty.New().R()
+			if tt.token != "" {
+				req.SetAuthToken(tt.token)
+			}
+
+			ms.On("PingDB").Return(fmt.Errorf("test error"))
+
+			res, err := req.Execute(tt.method, srv.URL+tt.url)
+			require.NoError(t, err)
+			require.Equal(t, tt.code, res.StatusCode())
+		})
+	}
+
+	t.Run("all filtered by prefix", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken("app-read-token").Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Contains(t, string(res.Body()), "<td>app_test</td>")
+		require.NotContains(t, string(res.Body()), "<td>test</td>")
+	})
+}
+
+func TestServiceRouter_tenants(t *testing.T) {
+	ms, err := storage.NewMemStorage(context.Background(), parameters.ServerParameters{
+		FileStoragePath: filepath.Join(t.TempDir(), "metrics.json"),
+	})
+	require.NoError(t, err)
+	defer ms.Close()
+
+	a, err := auth.NewAuthenticator("./testdata/tokens.json")
+	require.NoError(t, err)
+
+	dmo := new(DecrypterMockedObject)
+	ipcmo := new(IPCheckerMockedObject)
+	sh := NewServiceHandlers(ms)
+	h := hasher.NewHasher(make([]byte, 0), 1)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, a)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name, method, url, token, tenant, body string
+		code                                   int
+	}{
+		{"write own tenant", http.MethodPost, "/update/gauge/HeapAlloc/1", "team-a-token", "", "", http.StatusOK},
+		{"write other tenant", http.MethodPost, "/update/gauge/HeapAlloc/3", "team-a-token", "team_b", "", http.StatusForbidden},
+		{"admin writes any tenant", http.MethodPost, "/update/gauge/HeapAlloc/2", "admin-token", "team_b", "", http.StatusOK},
+		{"invalid tenant", http.MethodPost, "/update/gauge/HeapAlloc/2", "admin-token", "team b", "", http.StatusBadRequest},
+		{"read own tenant", http.MethodGet, "/value/gauge/HeapAlloc", "team-a-token", "", "1", http.StatusOK},
+		{"admin reads any tenant", http.MethodGet, "/value/gauge/HeapAlloc", "admin-token", "team_b", "2", http.StatusOK},
+		{"default tenant is empty", http.MethodGet, "/value/gauge/HeapAlloc", "read-token", "", "", http.StatusNotFound},
+		{"list tenants", http.MethodGet, "/tenants", "admin-token", "", `["team_a","team_b"]`, http.StatusOK},
+		{"list tenants without admin", http.MethodGet, "/tenants", "team-a-token", "", "", http.StatusForbidden},
+		{"invalid tenant view", http.MethodGet, "/tenants/team%20b", "admin-token", "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := resty.New().R().SetAuthToken(tt.token)
+			if tt.tenant != "" {
+				req.SetHeader("X-Tenant", tt.tenant)
+			}
+
+			res, err := req.Execute(tt.method, srv.URL+tt.url)
+			require.NoError(t, err)
+			require.Equal(t, tt.code, res.StatusCode())
+
+			if tt.body != "" {
+				require.Equal(t, tt.body, string(res.Body()))
+			}
+		})
+	}
+
+	t.Run("tenant view", func(t *testing.T) {
+		res, err := resty.New().R().SetAuthToken("admin-token").Get(srv.URL + "/tenants/team_b")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Contains(t, string(res.Body()), "<td>2.000000</td>")
+		require.NotContains(t, string(res.Body()), "<td>1.000000</td>")
+	})
+}
+
+func TestServiceRouter_agentConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "agents"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "default.json"), []byte(`{"report_interval": 20}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "agents", "agent-1.json"), []byte(`{"report_interval": 30}`), 0o600))
+
+	a, err := auth.NewAuthenticator("./testdata/tokens.json")
+	require.NoError(t, err)
+
+	dmo := new(DecrypterMockedObject)
+	ipcmo := new(IPCheckerMockedObject)
+	sh := NewServiceHandlers(new(StorageMockedObject))
+	h := hasher.NewHasher(make([]byte, 0), 1)
+
+	t.Run("configs aren't set", func(t *testing.T) {
+		srv := httptest.NewServer(ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, a))
+		defer srv.Close()
+
+		res, err := resty.New().R().SetAuthToken("write-token").Get(srv.URL + "/agent/config")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode())
+	})
+
+	srv := httptest.NewServer(ServiceRouter(compresses.NewGzipPool(1), h, sh.WithAgentConfigs(agentconfig.NewStore(dir)), dmo, ipcmo, a))
+	defer srv.Close()
+
+	get := func(token, instance, etag string) *resty.Response {
+		req := resty.New().R().SetAuthToken(token).SetQueryParam("group", "prod")
+		if instance != "" {
+			identity.SetHeader(req.Header, identity.Identity{Instance: instance})
+		}
+
+		if etag != "" {
+			req.SetHeader("If-None-Match", etag)
+		}
+
+		res, err := req.Get(srv.URL + "/agent/config")
+		require.NoError(t, err)
+
+		return res
+	}
+
+	res := get("read-token", "agent-1", "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode())
+
+	res = get("write-token", "", "")
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Contains(t, string(res.Body()), `"report_interval":20`)
+
+	res = get("write-token", "agent-1", "")
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Equal(t, jsonCT, strings.Join(res.Header().Values("Content-Type"), "; "))
+
+	var d agentconfig.Document
+	require.NoError(t, json.Unmarshal(res.Body(), &d))
+	require.JSONEq(t, `{"report_interval": 30}`, string(d.Config))
+	require.Equal(t, `"`+d.Version+`"`, res.Header().Get("ETag"))
+
+	res = get("write-token", "agent-1", res.Header().Get("ETag"))
+	require.Equal(t, http.StatusNotModified, res.StatusCode())
+}
+
+func TestServiceRouter_agents(t *testing.T) {
+	ms := new(StorageMockedObject)
+	ms.On("UpdateByMetrics", *models.NewMetricsForGauge("app_test", 12)).Return(models.NewMetricsForGauge("app_test", 12), nil)
+
+	a, err := auth.NewAuthenticator("./testdata/tokens.json")
+	require.NoError(t, err)
+
+	dmo := new(DecrypterMockedObject)
+	ipcmo := new(IPCheckerMockedObject)
+	sh := NewServiceHandlers(ms).WithInventory(inventory.NewInventory(10*time.Second, 3, ip.NewChecker(nil, nil, nil)))
+	h := hasher.NewHasher(make([]byte, 0), 1)
+	r := ServiceRouter(compresses.NewGzipPool(1), h, sh, dmo, ipcmo, a)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req := resty.New().R().SetAuthToken("write-token")
+	identity.SetHeader(req.Header, identity.Identity{Hostname: "host", Instance: "agent-1", Version: "1.0.0"})
+
+	res, err := req.Post(srv.URL + "/update/gauge/app_test/12")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+
+	req = resty.New().R().SetAuthToken("read-token")
+	identity.SetHeader(req.Header, identity.Identity{Hostname: "host", Instance: "reader", Version: "1.0.0"})
+
+	res, err = req.Post(srv.URL + "/update/gauge/app_test/12")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, res.StatusCode())
+
+	res, err = resty.New().R().SetAuthToken("read-token").Get(srv.URL + "/agents")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, res.StatusCode())
+
+	var agents []inventory.Agent
+
+	res, err = resty.New().R().SetAuthToken("admin-token").SetResult(&agents).Get(srv.URL + "/agents")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Len(t, agents, 1, "requests without identity and unauthorized requests aren't recorded")
+	require.Equal(t, "agent-1", agents[0].Instance)
+	require.Equal(t, inventory.TransportHTTP, agents[0].Transport)
+	require.False(t, agents[0].Stale)
+}
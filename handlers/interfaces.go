@@ -3,15 +3,31 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"net/http"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/DarkOmap/metricsService/internal/inventory"
 	"github.com/DarkOmap/metricsService/internal/models"
 )
 
 // Repository it's type for work with storages.
+// Metrics are scoped by the tenant of the context.
 type Repository interface {
 	UpdateByMetrics(ctx context.Context, m models.Metrics) (*models.Metrics, error)
 	ValueByMetrics(ctx context.Context, m models.Metrics) (*models.Metrics, error)
 	GetAll(ctx context.Context) (map[string]fmt.Stringer, error)
 	PingDB(ctx context.Context) error
 	Updates(ctx context.Context, metrics []models.Metrics) error
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// AgentConfigs it's type for getting configs of agents.
+type AgentConfigs interface {
+	Get(instance, group string) (agentconfig.Document, error)
+}
+
+// Inventory it's type for tracking agents.
+type Inventory interface {
+	RequestTrack(next http.Handler) http.Handler
+	Agents() []inventory.Agent
 }
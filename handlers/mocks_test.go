@@ -53,6 +53,16 @@ func (sm *StorageMockedObject) Updates(_ context.Context, metrics []models.Metri
 	return args.Error(0)
 }
 
+func (sm *StorageMockedObject) Tenants(context.Context) ([]string, error) {
+	args := sm.Called()
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]string), args.Error(1)
+}
+
 type DecrypterMockedObject struct{}
 
 func (dmo *DecrypterMockedObject) RequestDecrypt(next http.Handler) http.Handler {
@@ -1,63 +1,127 @@
-// Package agent defines a structure that gets memory metrics and sends them to the server.
+// Package agent defines a structure that runs metrics collectors and sends their data to the server.
 package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync/atomic"
+	"sync"
 	"time"
 
+	"github.com/DarkOmap/metricsService/internal/hasher"
 	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/spool"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
 // Client it's type for sending data to server.
 type Client interface {
-	SendBatch(ctx context.Context, batch map[string]float64) error
-	SendCounter(ctx context.Context, name string, delta int64) error
+	SendBatch(ctx context.Context, gauges map[string]float64, counters map[string]int64) error
 }
 
-// MemStats it's type for reading memory statistics
-type MemStats interface {
-	ReadMemStats() error
-	GetMap() map[string]float64
-}
+const (
+	// drainTimeout it's time for finishing in-flight sends after stop of agent
+	drainTimeout = 5 * time.Second
+	// gaugeTTLIntervals it's count of report or poll intervals of the collector, the longer one,
+	// after which gauge which isn't collected again is expired
+	gaugeTTLIntervals = 2
+)
 
-// Agent it's structure for calculate and send data to server.
+// Agent it's structure for running collectors and sending their data to server.
+// Each collector runs in its own goroutine, so an error or a panic of one collector doesn't stop others.
+// Collectors feed the reporting goroutine through a channel, the reporting goroutine aggregates data
+// and dispatches reports to a pool of rateLimit senders without waiting for them, so when the server is slow
+// up to rateLimit requests are in flight. Results of requests are handled by the reporting goroutine.
+// When senders are saturated the reporting goroutine waits for them and stops reading collected data,
+// so collectors wait too.
+// Gauges which collectors stop reporting, for example of exited processes or unmounted filesystems, are expired.
 type Agent struct {
 	client         Client
-	ms             MemStats
-	pollCount      atomic.Int64
-	reportInterval uint
-	pollInterval   uint
+	gauges         map[string]gauge
+	counters       map[string]int64
+	jobs           []Job
+	mu             sync.Mutex
+	reportInterval time.Duration
+	rateLimit      uint
+	spool          *spool.Spool
+	changes        *changeFilter
+	pipeline       *Pipeline
+	label          func(name string) string
+	tasks          chan func()
+	results        chan sendResult
+	inFlight       int
+	replaying      bool
+	now            func() time.Time
+}
+
+// sendResult it's result of sending entry, batch is set if entry is replayed from spool
+type sendResult struct {
+	entry spool.Entry
+	batch *spool.Batch
+	err   error
+}
+
+// gauge it's collected value of gauge, gauge isn't sent after expiration
+type gauge struct {
+	value   float64
+	expires time.Time
+}
+
+// collection it's metrics collected by job
+type collection struct {
+	job     Job
+	metrics Metrics
 }
 
-// NewAgent create agent
-func NewAgent(client Client, ms MemStats, reportInterval, pollInterval uint) *Agent {
+// NewAgent create agent, rateLimit is count of concurrent requests to server
+func NewAgent(client Client, reportInterval, rateLimit uint, jobs ...Job) *Agent {
 	a := &Agent{
-		reportInterval: reportInterval,
-		pollInterval:   pollInterval,
+		reportInterval: time.Duration(reportInterval) * time.Second,
+		rateLimit:      max(1, rateLimit),
 		client:         client,
-		ms:             ms,
+		jobs:           jobs,
+		gauges:         make(map[string]gauge),
+		counters:       make(map[string]int64),
+		now:            time.Now,
 	}
 
 	return a
 }
 
-// Run start calculate and sending data to server.
+// Close closes collectors holding resources, it's called after Run returns
+func (a *Agent) Close() error {
+	return closeJobs(a.jobs)
+}
+
+// Run start collecting and sending data to server.
+// After cancellation of ctx agent sends collected data and waits for in-flight sends at most drainTimeout.
 func (a *Agent) Run(ctx context.Context) error {
+	sendCtx, cancelSend := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSend()
+
+	stopDrain := context.AfterFunc(ctx, func() {
+		time.AfterFunc(drainTimeout, cancelSend)
+	})
+	defer stopDrain()
+
+	stopSenders := a.startSenders()
+	defer stopSenders()
+
+	collected := make(chan collection, len(a.jobs))
 	eg, egCtx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error {
-		a.startSendReport(egCtx)
+		a.startSendReport(egCtx, sendCtx, collected)
 		return nil
 	})
 
-	eg.Go(func() error {
-		err := a.startReadMemStats(egCtx)
-		return err
-	})
+	for _, job := range a.jobs {
+		eg.Go(func() error {
+			a.startCollect(egCtx, job, collected)
+			return nil
+		})
+	}
 
 	if err := eg.Wait(); err != nil {
 		logger.Log.Error("Problem with working agent", zap.Error(err))
@@ -67,50 +131,391 @@ func (a *Agent) Run(ctx context.Context) error {
 	return nil
 }
 
-func (a *Agent) startSendReport(ctx context.Context) {
+// startSenders starts rateLimit senders, returned function stops them after finishing of in-flight sends
+func (a *Agent) startSenders() (stop func()) {
+	a.tasks = make(chan func())
+	a.results = make(chan sendResult)
+
+	var wg sync.WaitGroup
+
+	for range a.rateLimit {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for task := range a.tasks {
+				task()
+			}
+		}()
+	}
+
+	return func() {
+		a.wait()
+		close(a.tasks)
+		wg.Wait()
+	}
+}
+
+func (a *Agent) startSendReport(ctx, sendCtx context.Context, collected <-chan collection) {
 	logger.Log.Info("Send report start")
+
+	t := time.NewTicker(a.reportInterval)
+	defer t.Stop()
+
 	for {
 		select {
-		case <-time.After(time.Duration(a.reportInterval) * time.Second):
-			a.sendMemStats(ctx)
-			a.sendPollCount(ctx)
+		case c := <-collected:
+			a.merge(c.job, c.metrics)
+		case r := <-a.results:
+			a.complete(r)
+		case <-t.C:
+			a.report(sendCtx)
 		case <-ctx.Done():
+			a.drainCollected(collected)
+			a.report(sendCtx)
+			a.wait()
 			logger.Log.Info("Send report done")
 			return
 		}
 	}
 }
 
-func (a *Agent) startReadMemStats(ctx context.Context) error {
-	logger.Log.Info("Read mem stats start")
+// drainCollected merges data which collectors have already sent to the channel
+func (a *Agent) drainCollected(collected <-chan collection) {
 	for {
 		select {
-		case <-time.After(time.Duration(a.pollInterval) * time.Second):
-			err := a.ms.ReadMemStats()
-			if err != nil {
-				return fmt.Errorf("read mem stats: %w", err)
+		case c := <-collected:
+			a.merge(c.job, c.metrics)
+		default:
+			return
+		}
+	}
+}
+
+func (a *Agent) startCollect(ctx context.Context, job Job, collected chan<- collection) {
+	logger.Log.Info("Collect start", zap.String("collector", job.Name))
+	for {
+		select {
+		case <-time.After(job.Interval):
+			m, ok := a.collect(ctx, job)
+			if !ok {
+				continue
 			}
 
-			a.pollCount.Add(1)
+			select {
+			case collected <- collection{job: job, metrics: m}:
+			case <-ctx.Done():
+			}
 		case <-ctx.Done():
-			logger.Log.Info("Read mem stats done")
-			return nil
+			logger.Log.Info("Collect done", zap.String("collector", job.Name))
+			return
 		}
 	}
 }
 
-func (a *Agent) sendMemStats(ctx context.Context) {
-	msForServer := a.ms.GetMap()
-
-	err := a.client.SendBatch(ctx, msForServer)
+func (a *Agent) collect(ctx context.Context, job Job) (Metrics, bool) {
+	m, err := safeCollect(ctx, job.Collector)
 	if err != nil {
-		logger.Log.Warn("Send batch", zap.Error(err))
+		logger.Log.Warn("Collect metrics", zap.String("collector", job.Name), zap.Error(err))
+		return Metrics{}, false
+	}
+
+	return m, true
+}
+
+// merge stores collected metrics, gauges expire if the job doesn't collect them again
+func (a *Agent) merge(job Job, m Metrics) {
+	if a.pipeline != nil {
+		m = a.pipeline.Apply(m)
+	}
+
+	ttl := max(job.Interval, a.reportInterval) * gaugeTTLIntervals
+	expires := a.now().Add(ttl)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, value := range m.Gauges {
+		a.gauges[name] = gauge{value: value, expires: expires}
+	}
+
+	for name, delta := range m.Counters {
+		a.counters[name] += delta
+	}
+}
+
+func safeCollect(ctx context.Context, c Collector) (m Metrics, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("collector panic: %v", r)
+		}
+	}()
+
+	return c.Collect(ctx)
+}
+
+// SetSpool sets spool for data which failed to send.
+// Spooled data is replayed together with reports, spooled gauges are replaced with newer values of reports.
+func (a *Agent) SetSpool(s *spool.Spool) {
+	a.spool = s
+}
+
+// SetPipeline sets rules applied to collected metrics before they are stored for sending,
+// so the spool and the server get processed metrics. Agent's own counters aren't processed.
+func (a *Agent) SetPipeline(p *Pipeline) {
+	a.pipeline = p
+}
+
+// SetInstanceLabel adds instance of agent to names of sent metrics, so metrics of agents don't mix on the server.
+// Position is prefix, for example agent_1_HeapAlloc, or suffix, for example HeapAlloc_agent_1.
+// Names are changed only while sending, so the spool keeps the original names.
+func (a *Agent) SetInstanceLabel(instance, position string) error {
+	label := metricLabel(instance)
+
+	switch position {
+	case "prefix":
+		a.label = func(name string) string { return label + "_" + name }
+	case "suffix":
+		a.label = func(name string) string { return name + "_" + label }
+	default:
+		return fmt.Errorf("unknown position of instance label %s, want prefix or suffix", position)
+	}
+
+	return nil
+}
+
+// SetChangesOnly enables sending only gauges which differ from the last sent values more than epsilon.
+// Every fullRefresh reports all gauges are sent, zero fullRefresh disables it.
+// Count of skipped gauges is sent as counter SuppressedGauges.
+func (a *Agent) SetChangesOnly(epsilon float64, fullRefresh uint) {
+	a.changes = newChangeFilter(epsilon, fullRefresh)
+}
+
+// report dispatches collected data and spooled data to senders. Counters are taken for sending
+// and failed increments are returned to counters unless the spool accepts them,
+// so they are sent again with the next report.
+// Spooled gauges which the report contains are skipped, so the server doesn't get older values after newer ones.
+func (a *Agent) report(ctx context.Context) {
+	e := spool.Entry{Time: a.now(), Gauges: a.changedGauges()}
+	e.Counters = a.takeCounters()
+
+	if a.spool != nil && !a.replaying {
+		a.replay(ctx, e.Gauges)
+	}
+
+	if !e.Empty() {
+		a.dispatch(ctx, e, nil)
+	}
+}
+
+// complete handles result of sending
+func (a *Agent) complete(r sendResult) {
+	a.inFlight--
+
+	if r.err != nil {
+		logSendError("Send batch", r.err)
+	}
+
+	var applied *hasher.AppliedUpdateError
+	if errors.As(r.err, &applied) {
+		// the server has already applied the data, so it isn't sent again
+		a.mu.Lock()
+		a.counters["ResponseHashMismatches"]++
+		a.mu.Unlock()
+
+		r.err = nil
+	}
+
+	if r.batch != nil {
+		a.replaying = false
+
+		if err := a.spool.Commit(r.batch); err != nil {
+			logger.Log.Warn("Commit spool", zap.Error(err))
+		}
+
+		if r.err != nil && !a.push(r.entry) {
+			logger.Log.Error("Spooled data is lost")
+		}
+
+		return
+	}
+
+	if r.err == nil {
+		a.ackGauges(r.entry.Gauges)
+		return
+	}
+
+	if a.spool == nil || !a.push(r.entry) {
+		a.restoreCounters(r.entry.Counters)
+	}
+}
+
+// wait handles results of in-flight sends
+func (a *Agent) wait() {
+	for a.inFlight > 0 {
+		a.complete(<-a.results)
+	}
+}
+
+// takeGauges returns gauges which aren't expired, expired ones are removed
+func (a *Agent) takeGauges() map[string]float64 {
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	gauges := make(map[string]float64, len(a.gauges))
+	for name, g := range a.gauges {
+		if !now.Before(g.expires) {
+			delete(a.gauges, name)
+			continue
+		}
+
+		gauges[name] = g.value
+	}
+
+	return gauges
+}
+
+// changedGauges returns gauges for sending, unchanged gauges are skipped in changes only mode
+func (a *Agent) changedGauges() map[string]float64 {
+	gauges := a.takeGauges()
+	if a.changes == nil {
+		return gauges
+	}
+
+	changed, suppressed := a.changes.filter(gauges)
+	if suppressed != 0 {
+		a.mu.Lock()
+		a.counters["SuppressedGauges"] += int64(suppressed)
+		a.mu.Unlock()
+	}
+
+	return changed
+}
+
+// ackGauges remembers sent gauges in changes only mode, failed gauges aren't remembered
+func (a *Agent) ackGauges(sent map[string]float64) {
+	if a.changes == nil {
+		return
+	}
+
+	a.changes.remember(sent)
+}
+
+// takeCounters returns non-zero increments and removes them from counters
+func (a *Agent) takeCounters() map[string]int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	counters := make(map[string]int64, len(a.counters))
+	for name, delta := range a.counters {
+		if delta != 0 {
+			counters[name] = delta
+		}
+	}
+
+	clear(a.counters)
+
+	return counters
+}
+
+// restoreCounters returns failed increments to counters, collectors could add new increments while sending
+func (a *Agent) restoreCounters(failed map[string]int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, delta := range failed {
+		a.counters[name] += delta
+	}
+}
+
+// dispatch passes entry to senders, results of previous sends are handled while senders are saturated
+func (a *Agent) dispatch(ctx context.Context, e spool.Entry, b *spool.Batch) {
+	gauges, counters := e.Gauges, e.Counters
+	if a.label != nil {
+		gauges = make(map[string]float64, len(e.Gauges))
+		for name, value := range e.Gauges {
+			gauges[a.label(name)] = value
+		}
+
+		counters = make(map[string]int64, len(e.Counters))
+		for name, delta := range e.Counters {
+			counters[a.label(name)] = delta
+		}
+	}
+
+	task := func() {
+		a.results <- sendResult{entry: e, batch: b, err: a.client.SendBatch(ctx, gauges, counters)}
+	}
+
+	for {
+		select {
+		case a.tasks <- task:
+			a.inFlight++
+			return
+		case r := <-a.results:
+			a.complete(r)
+		}
 	}
 }
 
-func (a *Agent) sendPollCount(ctx context.Context) {
-	err := a.client.SendCounter(ctx, "PollCount", a.pollCount.Load())
+// replay dispatches spooled data, gauges which are sent with the current report are skipped
+func (a *Agent) replay(ctx context.Context, current map[string]float64) {
+	b, err := a.spool.Batch()
 	if err != nil {
-		logger.Log.Warn("Send counter", zap.Error(err))
+		logger.Log.Warn("Read spool", zap.Error(err))
+		return
+	}
+
+	if b == nil {
+		return
+	}
+
+	for name := range current {
+		delete(b.Gauges, name)
+	}
+
+	if b.Empty() {
+		if err := a.spool.Commit(b); err != nil {
+			logger.Log.Warn("Commit spool", zap.Error(err))
+		}
+
+		return
+	}
+
+	logger.Log.Info("Replay spool", zap.Int("gauges", len(b.Gauges)), zap.Int("counters", len(b.Counters)))
+
+	a.replaying = true
+	a.dispatch(ctx, b.Entry, b)
+}
+
+// push stores entry in spool, it returns false if entry isn't stored
+func (a *Agent) push(e spool.Entry) bool {
+	if e.Empty() {
+		return true
+	}
+
+	if err := a.spool.Push(e); err != nil {
+		logger.Log.Error("Push to spool", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func logSendError(msg string, err error) {
+	switch {
+	case errors.Is(err, hasher.ErrClockSkew):
+		logger.Log.Error(msg+": server rejected request timestamp, check the agent clock", zap.Error(err))
+	case errors.Is(err, hasher.ErrReplayedRequest):
+		logger.Log.Error(msg+": server rejected request as replayed", zap.Error(err))
+	case errors.Is(err, hasher.ErrNonceCacheFull):
+		logger.Log.Warn(msg+": server is overloaded with signed requests, data is sent again later", zap.Error(err))
+	case errors.As(err, new(*hasher.AppliedUpdateError)):
+		logger.Log.Error(msg+": server applied request, but its response isn't verified", zap.Error(err))
+	default:
+		logger.Log.Warn(msg, zap.Error(err))
 	}
 }
@@ -5,10 +5,14 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/DarkOmap/metricsService/internal/hasher"
 	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/spool"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -18,13 +22,7 @@ type ClientMockedObject struct {
 	mock.Mock
 }
 
-func (c *ClientMockedObject) SendBatch(context.Context, map[string]float64) error {
-	args := c.Called()
-
-	return args.Error(0)
-}
-
-func (c *ClientMockedObject) SendCounter(context.Context, string, int64) error {
+func (c *ClientMockedObject) SendBatch(context.Context, map[string]float64, map[string]int64) error {
 	args := c.Called()
 
 	return args.Error(0)
@@ -51,14 +49,14 @@ func TestNewAgent(t *testing.T) {
 	ms := new(MSModckedObkect)
 
 	t.Run("positive test", func(t *testing.T) {
-		gotA := NewAgent(c, ms, 10, 10)
-
-		require.Equal(t, &Agent{
-			reportInterval: 10,
-			pollInterval:   10,
-			client:         c,
-			ms:             ms,
-		}, gotA)
+		job := Job{Collector: NewMemStatsCollector(ms), Name: "memstats", Interval: time.Second}
+		gotA := NewAgent(c, 10, 5, job)
+
+		require.Equal(t, 10*time.Second, gotA.reportInterval)
+		require.Equal(t, uint(5), gotA.rateLimit)
+		require.Equal(t, c, gotA.client)
+		require.Len(t, gotA.jobs, 1)
+		require.Equal(t, "memstats", gotA.jobs[0].Name)
 	})
 }
 
@@ -67,13 +65,12 @@ func TestAgent_Run(t *testing.T) {
 		t.Parallel()
 		c := new(ClientMockedObject)
 		c.On("SendBatch").Return(nil)
-		c.On("SendCounter").Return(nil)
 		ms := new(MSModckedObkect)
 		ms.On("ReadMemStats").Return(nil)
 		ms.On("GetMap").Return(map[string]float64{"test": 1})
 
-		a := NewAgent(c, ms, 1, 1)
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		a := NewAgent(c, 1, 1, Job{Collector: NewMemStatsCollector(ms), Name: "memstats", Interval: 100 * time.Millisecond})
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
 
 		err := a.Run(ctx)
@@ -81,29 +78,95 @@ func TestAgent_Run(t *testing.T) {
 		require.NoError(t, err)
 
 		ms.AssertExpectations(t)
+		c.AssertExpectations(t)
 	})
 
-	t.Run("negative test", func(t *testing.T) {
+	t.Run("collector error doesn't stop agent", func(t *testing.T) {
 		t.Parallel()
 		c := new(ClientMockedObject)
 		c.On("SendBatch").Return(nil)
-		c.On("SendCounter").Return(nil)
 		ms := new(MSModckedObkect)
 		ms.On("ReadMemStats").Return(fmt.Errorf("test error"))
-		ms.On("GetMap").Return(map[string]float64{"test": 1})
 
-		a := NewAgent(c, ms, 1, 1)
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		failing := Job{Collector: NewMemStatsCollector(ms), Name: "failing", Interval: 100 * time.Millisecond}
+		panicking := Job{
+			Collector: CollectorFunc(func(context.Context) (Metrics, error) { panic("test panic") }),
+			Name:      "panicking",
+			Interval:  100 * time.Millisecond,
+		}
+		working := Job{
+			Collector: CollectorFunc(func(context.Context) (Metrics, error) {
+				return Metrics{Gauges: map[string]float64{"test": 1}, Counters: map[string]int64{"events": 1}}, nil
+			}),
+			Name:     "working",
+			Interval: 100 * time.Millisecond,
+		}
+
+		a := NewAgent(c, 1, 1, failing, panicking, working)
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
 
 		err := a.Run(ctx)
 
-		require.Error(t, err)
+		require.NoError(t, err)
 
 		ms.AssertExpectations(t)
+		c.AssertCalled(t, "SendBatch")
 	})
 }
 
+func TestAgent_collect(t *testing.T) {
+	a := NewAgent(new(ClientMockedObject), 1, 1)
+	job := Job{
+		Collector: CollectorFunc(func(context.Context) (Metrics, error) {
+			return Metrics{Gauges: map[string]float64{"gauge": 1.5}, Counters: map[string]int64{"counter": 2}}, nil
+		}),
+		Name: "test",
+	}
+
+	for range 2 {
+		m, ok := a.collect(context.Background(), job)
+		require.True(t, ok)
+		a.merge(job, m)
+	}
+
+	require.Equal(t, map[string]float64{"gauge": 1.5}, a.takeGauges())
+	require.Equal(t, map[string]int64{"counter": 4}, a.counters, "poll count is reported by memstats collector only")
+
+	t.Run("error", func(t *testing.T) {
+		_, ok := a.collect(context.Background(), Job{
+			Collector: CollectorFunc(func(context.Context) (Metrics, error) { return Metrics{}, fmt.Errorf("test error") }),
+			Name:      "error",
+		})
+		require.False(t, ok)
+	})
+}
+
+func TestAgent_merge_expiration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	a := NewAgent(new(ClientMockedObject), 10, 1)
+	a.now = func() time.Time { return now }
+
+	process := Job{Name: "process", Interval: 2 * time.Second}
+	scrape := Job{Name: "scrape", Interval: time.Minute}
+
+	a.merge(process, Metrics{Gauges: map[string]float64{"ProcessRSS_app": 1, "ProcessCount_app": 1}})
+	a.merge(scrape, Metrics{Gauges: map[string]float64{"ScrapeUp_target": 1}})
+
+	now = start.Add(15 * time.Second)
+	a.merge(process, Metrics{Gauges: map[string]float64{"ProcessCount_app": 0}})
+
+	now = start.Add(25 * time.Second)
+	require.Equal(t, map[string]float64{"ProcessCount_app": 0, "ScrapeUp_target": 1}, a.takeGauges(),
+		"gauge isn't sent after two report intervals without collection")
+
+	now = start.Add(2 * time.Minute)
+	require.Empty(t, a.takeGauges(), "interval of slow collector is longer than report interval")
+	require.Empty(t, a.gauges)
+}
+
 type testingSink struct {
 	*bytes.Buffer
 }
@@ -119,31 +182,33 @@ func TestAgent_sendBatch(t *testing.T) {
 	t.Run("positive tets", func(t *testing.T) {
 		c := new(ClientMockedObject)
 		c.On("SendBatch").Return(nil)
-		ms := new(MSModckedObkect)
-		ms.On("GetMap").Return(map[string]float64{"test": 1})
-
-		a := NewAgent(c, ms, 1, 1)
 
-		a.sendMemStats(context.Background())
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+		a.merge(Job{}, Metrics{Gauges: map[string]float64{"test": 1}})
+		a.report(context.Background())
+		a.wait()
 
 		logs := sink.String()
 
 		require.Empty(t, logs)
+		c.AssertCalled(t, "SendBatch")
 	})
 
 	t.Run("negative tets", func(t *testing.T) {
 		c := new(ClientMockedObject)
 		c.On("SendBatch").Return(fmt.Errorf("test error"))
-		ms := new(MSModckedObkect)
-		ms.On("GetMap").Return(map[string]float64{"test": 1})
-
-		a := NewAgent(c, ms, 1, 1)
 
-		a.sendMemStats(context.Background())
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+		a.merge(Job{}, Metrics{Gauges: map[string]float64{"test": 1}})
+		a.report(context.Background())
+		a.wait()
 
 		logs := sink.String()
 
 		require.NotEmpty(t, logs)
+		require.Zero(t, a.inFlight)
 	})
 }
 
@@ -154,29 +219,328 @@ func TestAgent_sendCounter(t *testing.T) {
 
 	t.Run("positive tets", func(t *testing.T) {
 		c := new(ClientMockedObject)
-		c.On("SendCounter").Return(nil)
-		ms := new(MSModckedObkect)
-
-		a := NewAgent(c, ms, 1, 1)
+		c.On("SendBatch").Return(nil)
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+		a.counters["PollCount"] = 1
 
-		a.sendPollCount(context.Background())
+		a.report(context.Background())
+		a.wait()
 
 		logs := sink.String()
 
 		require.Empty(t, logs)
+		require.Empty(t, a.counters)
 	})
 
 	t.Run("negative tets", func(t *testing.T) {
 		c := new(ClientMockedObject)
-		c.On("SendCounter").Return(fmt.Errorf("test error"))
-		ms := new(MSModckedObkect)
-
-		a := NewAgent(c, ms, 1, 1)
+		c.On("SendBatch").Return(fmt.Errorf("test error"))
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+		a.counters["PollCount"] = 1
 
-		a.sendPollCount(context.Background())
+		a.report(context.Background())
+		a.wait()
 
 		logs := sink.String()
 
 		require.NotEmpty(t, logs)
+		require.Equal(t, map[string]int64{"PollCount": 1}, a.counters, "failed increments are returned to counters")
+	})
+}
+
+// recordingClient stores sent data, it fails all requests while unavailable is set
+type recordingClient struct {
+	mu          sync.Mutex
+	unavailable bool
+	requests    int
+	batches     []map[string]float64
+	counters    map[string]int64
+}
+
+func (c *recordingClient) SendBatch(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.unavailable {
+		return fmt.Errorf("server is unavailable")
+	}
+
+	c.requests++
+
+	if len(gauges) != 0 {
+		c.batches = append(c.batches, gauges)
+	}
+
+	if c.counters == nil {
+		c.counters = make(map[string]int64)
+	}
+
+	for name, delta := range counters {
+		c.counters[name] += delta
+	}
+
+	return nil
+}
+
+func TestAgent_report(t *testing.T) {
+	c := &recordingClient{unavailable: true}
+	s, err := spool.NewSpool(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	a := NewAgent(c, 1, 1)
+	defer a.startSenders()()
+	a.SetSpool(s)
+
+	a.merge(Job{}, Metrics{Gauges: map[string]float64{"gauge": 1}})
+	a.counters["counter"] = 2
+	a.report(context.Background())
+	a.wait()
+
+	a.merge(Job{}, Metrics{Gauges: map[string]float64{"gauge": 2}})
+	a.counters["counter"] = 3
+	a.report(context.Background())
+	a.wait()
+
+	n, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, n, "failed reports are spooled")
+
+	c.unavailable = false
+	a.merge(Job{}, Metrics{Gauges: map[string]float64{"gauge": 3}})
+	a.counters["counter"] = 4
+	a.report(context.Background())
+	a.wait()
+
+	n, err = s.Len()
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	require.Equal(t, []map[string]float64{{"gauge": 3}}, c.batches, "spooled gauges are replaced with newer ones")
+	require.Equal(t, int64(9), c.counters["counter"])
+}
+
+func TestAgent_report_counters(t *testing.T) {
+	t.Run("poll count is sent as increment", func(t *testing.T) {
+		ms := new(MSModckedObkect)
+		ms.On("ReadMemStats").Return(nil)
+		ms.On("GetMap").Return(map[string]float64{"test": 1})
+
+		c := &recordingClient{}
+		a := NewAgent(c, 1, 1, Job{Collector: NewMemStatsCollector(ms), Name: "memstats"})
+		defer a.startSenders()()
+
+		for range 3 {
+			m, ok := a.collect(context.Background(), a.jobs[0])
+			require.True(t, ok)
+			a.merge(a.jobs[0], m)
+			a.report(context.Background())
+			a.wait()
+		}
+
+		require.Equal(t, int64(3), c.counters["PollCount"])
+		require.Empty(t, a.counters)
+	})
+
+	t.Run("failed increments are retried", func(t *testing.T) {
+		c := &recordingClient{unavailable: true}
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+
+		a.counters["counter"] = 2
+		a.report(context.Background())
+		a.wait()
+		require.Equal(t, map[string]int64{"counter": 2}, a.counters)
+
+		c.unavailable = false
+		a.counters["counter"] += 3
+		a.report(context.Background())
+		a.wait()
+		a.report(context.Background())
+		a.wait()
+
+		require.Equal(t, int64(5), c.counters["counter"])
+		require.Empty(t, a.counters)
+	})
+
+	t.Run("unverified response of applied update", func(t *testing.T) {
+		c := new(ClientMockedObject)
+		c.On("SendBatch").Return(&hasher.AppliedUpdateError{Err: hasher.ErrResponseHash})
+
+		s, err := spool.NewSpool(t.TempDir(), 0, 0)
+		require.NoError(t, err)
+
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+		a.SetSpool(s)
+
+		a.counters["counter"] = 2
+		a.report(context.Background())
+		a.wait()
+
+		n, err := s.Len()
+		require.NoError(t, err)
+		require.Zero(t, n, "applied increments aren't spooled")
+		require.Equal(t, map[string]int64{"ResponseHashMismatches": 1}, a.counters, "applied increments aren't sent again")
 	})
+
+	t.Run("counters are sent with gauges in one request", func(t *testing.T) {
+		c := &recordingClient{}
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+
+		a.merge(Job{}, Metrics{Gauges: map[string]float64{"gauge": 1}})
+		a.counters["first"] = 1
+		a.counters["second"] = 2
+		a.report(context.Background())
+		a.wait()
+
+		require.Equal(t, 1, c.requests)
+		require.Equal(t, []map[string]float64{{"gauge": 1}}, c.batches)
+		require.Equal(t, map[string]int64{"first": 1, "second": 2}, c.counters)
+		require.Empty(t, a.counters)
+	})
+}
+
+func TestAgent_report_changesOnly(t *testing.T) {
+	c := &recordingClient{}
+	a := NewAgent(c, 1, 1)
+	defer a.startSenders()()
+	a.SetChangesOnly(0.5, 3)
+
+	report := func(gauges map[string]float64) {
+		a.merge(Job{}, Metrics{Gauges: gauges})
+		a.report(context.Background())
+		a.wait()
+	}
+
+	report(map[string]float64{"same": 1, "small": 1, "big": 1})
+	report(map[string]float64{"same": 1, "small": 1.3, "big": 2})
+	report(map[string]float64{"same": 1, "small": 1.6, "big": 2})
+	report(map[string]float64{"same": 1, "small": 1.6, "big": 2})
+
+	require.Equal(t, []map[string]float64{
+		{"same": 1, "small": 1, "big": 1},
+		{"big": 2},
+		{"small": 1.6},
+		{"same": 1, "small": 1.6, "big": 2},
+	}, c.batches, "difference is compared with the last sent value, every third report is full")
+	require.Equal(t, int64(4), c.counters["SuppressedGauges"])
+
+	t.Run("failed gauges are sent again", func(t *testing.T) {
+		c := &recordingClient{unavailable: true}
+		a := NewAgent(c, 1, 1)
+		defer a.startSenders()()
+		a.SetChangesOnly(0, 0)
+
+		a.merge(Job{}, Metrics{Gauges: map[string]float64{"gauge": 1}})
+		a.report(context.Background())
+		a.wait()
+
+		c.unavailable = false
+		a.report(context.Background())
+		a.wait()
+
+		require.Equal(t, []map[string]float64{{"gauge": 1}}, c.batches)
+	})
+}
+
+func TestAgent_SetInstanceLabel(t *testing.T) {
+	for _, tt := range []struct {
+		position string
+		want     string
+	}{
+		{position: "prefix", want: "agent_1_HeapAlloc"},
+		{position: "suffix", want: "HeapAlloc_agent_1"},
+	} {
+		t.Run(tt.position, func(t *testing.T) {
+			c := &recordingClient{}
+			a := NewAgent(c, 1, 1)
+			defer a.startSenders()()
+			require.NoError(t, a.SetInstanceLabel("agent-1", tt.position))
+
+			a.merge(Job{}, Metrics{Gauges: map[string]float64{"HeapAlloc": 1}})
+			a.counters["HeapAlloc"] = 2
+			a.report(context.Background())
+			a.wait()
+
+			require.Equal(t, []map[string]float64{{tt.want: 1}}, c.batches)
+			require.Equal(t, map[string]int64{tt.want: 2}, c.counters)
+		})
+	}
+
+	require.Error(t, NewAgent(nil, 1, 1).SetInstanceLabel("agent-1", "middle"))
+}
+
+// slowClient counts concurrent requests and blocks every request for delay
+type slowClient struct {
+	delay    time.Duration
+	inFlight atomic.Int64
+	maxSeen  atomic.Int64
+	sent     atomic.Int64
+}
+
+func (c *slowClient) do() error {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+
+	for {
+		seen := c.maxSeen.Load()
+		if n <= seen || c.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+
+	time.Sleep(c.delay)
+	c.sent.Add(1)
+
+	return nil
+}
+
+func (c *slowClient) SendBatch(context.Context, map[string]float64, map[string]int64) error {
+	return c.do()
+}
+
+func TestAgent_Run_rateLimit(t *testing.T) {
+	c := &slowClient{delay: 100 * time.Millisecond}
+	job := Job{
+		Collector: CollectorFunc(func(context.Context) (Metrics, error) {
+			return Metrics{Counters: map[string]int64{"events": 1}}, nil
+		}),
+		Name:     "test",
+		Interval: 5 * time.Millisecond,
+	}
+
+	a := NewAgent(c, 1, 3, job)
+	a.reportInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, a.Run(ctx))
+
+	require.Equal(t, int64(3), c.maxSeen.Load(), "reports don't wait for sends, count of concurrent requests equals rate limit")
+	require.Zero(t, c.inFlight.Load())
+	require.Empty(t, a.counters)
+}
+
+func TestAgent_Run_drain(t *testing.T) {
+	c := &slowClient{delay: 200 * time.Millisecond}
+	job := Job{
+		Collector: CollectorFunc(func(context.Context) (Metrics, error) {
+			return Metrics{Gauges: map[string]float64{"gauge": 1}, Counters: map[string]int64{"events": 1}}, nil
+		}),
+		Name:     "test",
+		Interval: 10 * time.Millisecond,
+	}
+
+	a := NewAgent(c, 100, 2, job)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, a.Run(ctx))
+
+	require.Equal(t, int64(1), c.sent.Load(), "collected data is sent after cancellation")
+	require.Zero(t, c.inFlight.Load())
+	require.Empty(t, a.counters)
 }
@@ -0,0 +1,277 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+)
+
+// containerCgroupMarkers are parts of cgroup paths created by container runtimes
+var containerCgroupMarkers = []string{"docker", "kubepods", "containerd", "libpod", "lxc"}
+
+// newCgroupCollector returns collector of resources of the agent's cgroup v2, which are limits and usage
+// of the container when the agent runs in a container. Gauge CgroupContainer is 1 if a container is detected.
+// Like host collectors it uses HOST_PROC, HOST_SYS and HOST_ROOT environment variables.
+func newCgroupCollector(parameters.AgentParameters) (Collector, error) {
+	root := hostPath("HOST_SYS", "/sys", "fs", "cgroup")
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 isn't mounted at %s: %w", root, err)
+	}
+
+	cgroup, err := selfCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(root, cgroup)
+	if _, err := os.Stat(dir); err != nil {
+		// without cgroup namespace the path is relative to the host's hierarchy,
+		// but only the container's cgroup is mounted
+		dir = root
+	}
+
+	container := 0.0
+	if inContainer(cgroup) {
+		container = 1
+	}
+
+	d := newDeltas()
+
+	return CollectorFunc(func(context.Context) (Metrics, error) {
+		m := NewMetrics()
+		m.Gauges["CgroupContainer"] = container
+
+		if err := readCgroupMemory(dir, m); err != nil {
+			return Metrics{}, err
+		}
+
+		if err := readCgroupPids(dir, m); err != nil {
+			return Metrics{}, err
+		}
+
+		if err := readCgroupCPU(dir, m, d); err != nil {
+			return Metrics{}, err
+		}
+
+		if err := readCgroupIO(dir, m, d); err != nil {
+			return Metrics{}, err
+		}
+
+		return m, nil
+	}), nil
+}
+
+// hostPath joins elems with value of environment variable or its default value
+func hostPath(env, def string, elems ...string) string {
+	root := os.Getenv(env)
+	if root == "" {
+		root = def
+	}
+
+	return filepath.Join(append([]string{root}, elems...)...)
+}
+
+// selfCgroup returns path of the agent's cgroup v2 relative to the hierarchy root
+func selfCgroup() (string, error) {
+	data, err := os.ReadFile(hostPath("HOST_PROC", "/proc", "self", "cgroup"))
+	if err != nil {
+		return "", fmt.Errorf("read cgroup of agent: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("agent isn't in cgroup v2 hierarchy")
+}
+
+func inContainer(cgroup string) bool {
+	if os.Getenv("container") != "" {
+		return true
+	}
+
+	for _, name := range []string{".dockerenv", "run/.containerenv"} {
+		if _, err := os.Stat(hostPath("HOST_ROOT", "/", name)); err == nil {
+			return true
+		}
+	}
+
+	for _, marker := range containerCgroupMarkers {
+		if strings.Contains(cgroup, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readCgroupMemory(dir string, m Metrics) error {
+	current, ok, err := readCgroupValue(dir, "memory.current")
+	if err != nil || !ok {
+		return err
+	}
+
+	m.Gauges["CgroupMemoryCurrent"] = float64(current)
+
+	limit, ok, err := readCgroupValue(dir, "memory.max")
+	if err != nil || !ok {
+		return err
+	}
+
+	m.Gauges["CgroupMemoryMax"] = float64(limit)
+	m.Gauges["CgroupMemoryUtilization"] = float64(current) / float64(limit) * 100
+
+	return nil
+}
+
+func readCgroupPids(dir string, m Metrics) error {
+	current, ok, err := readCgroupValue(dir, "pids.current")
+	if err != nil || !ok {
+		return err
+	}
+
+	m.Gauges["CgroupPidsCurrent"] = float64(current)
+
+	limit, ok, err := readCgroupValue(dir, "pids.max")
+	if err != nil || !ok {
+		return err
+	}
+
+	m.Gauges["CgroupPidsMax"] = float64(limit)
+
+	return nil
+}
+
+// cgroupCPUCounters maps keys of cpu.stat to names of counters
+var cgroupCPUCounters = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_periods":     "CgroupCPUPeriods",
+	"nr_throttled":   "CgroupCPUThrottledPeriods",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+func readCgroupCPU(dir string, m Metrics, d *deltas) error {
+	data, err := readCgroupFile(dir, "cpu.stat")
+	if err != nil || data == nil {
+		return err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), " ")
+		name, known := cgroupCPUCounters[key]
+
+		if !ok || !known {
+			continue
+		}
+
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse cpu.stat %s: %w", key, err)
+		}
+
+		d.add(m, name, v)
+	}
+
+	return nil
+}
+
+// cgroupIOCounters maps keys of io.stat to bases of counter names
+var cgroupIOCounters = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReadCount",
+	"wios":   "CgroupIOWriteCount",
+}
+
+func readCgroupIO(dir string, m Metrics, d *deltas) error {
+	data, err := readCgroupFile(dir, "io.stat")
+	if err != nil || data == nil {
+		return err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		device := blockDeviceName(fields[0])
+
+		for _, f := range fields[1:] {
+			key, value, _ := strings.Cut(f, "=")
+
+			base, ok := cgroupIOCounters[key]
+			if !ok {
+				continue
+			}
+
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse io.stat %s of %s: %w", key, fields[0], err)
+			}
+
+			d.add(m, metricName(base, device), v)
+		}
+	}
+
+	return nil
+}
+
+// blockDeviceName returns name of block device by its major:minor numbers, for example sda for 8:0.
+// The numbers are returned if the device isn't found.
+func blockDeviceName(id string) string {
+	target, err := os.Readlink(hostPath("HOST_SYS", "/sys", "dev", "block", id))
+	if err != nil {
+		return id
+	}
+
+	return filepath.Base(target)
+}
+
+// readCgroupValue reads file with a single number, false means that file is absent or value is max
+func readCgroupValue(dir, name string) (uint64, bool, error) {
+	data, err := readCgroupFile(dir, name)
+	if err != nil || data == nil {
+		return 0, false, err
+	}
+
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, false, nil
+	}
+
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	return v, true, nil
+}
+
+// readCgroupFile returns nil without error if file is absent because its controller isn't enabled
+func readCgroupFile(dir, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return data, nil
+}
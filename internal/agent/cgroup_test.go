@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupCollector(t *testing.T) {
+	t.Setenv("HOST_PROC", "./testdata/proc")
+	t.Setenv("HOST_SYS", "./testdata/sys")
+	t.Setenv("HOST_ROOT", "./testdata/root")
+	t.Setenv("container", "")
+
+	c, err := newCgroupCollector(parameters.AgentParameters{})
+	require.NoError(t, err)
+
+	m, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		"CgroupContainer":         1,
+		"CgroupMemoryCurrent":     104857600,
+		"CgroupMemoryMax":         536870912,
+		"CgroupMemoryUtilization": 19.53125,
+		"CgroupPidsCurrent":       12,
+	}, m.Gauges, "unlimited pids.max isn't reported")
+	require.Empty(t, m.Counters, "first collection only remembers values")
+
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{
+		"CgroupCPUUsageUsec":        0,
+		"CgroupCPUUserUsec":         0,
+		"CgroupCPUSystemUsec":       0,
+		"CgroupCPUPeriods":          0,
+		"CgroupCPUThrottledPeriods": 0,
+		"CgroupCPUThrottledUsec":    0,
+		"CgroupIOReadBytes_sda":     0,
+		"CgroupIOWriteBytes_sda":    0,
+		"CgroupIOReadCount_sda":     0,
+		"CgroupIOWriteCount_sda":    0,
+		"CgroupIOReadBytes_253_0":   0,
+		"CgroupIOWriteBytes_253_0":  0,
+		"CgroupIOReadCount_253_0":   0,
+		"CgroupIOWriteCount_253_0":  0,
+	}, m.Counters)
+
+	t.Run("not in container", func(t *testing.T) {
+		t.Setenv("HOST_ROOT", t.TempDir())
+
+		c, err := newCgroupCollector(parameters.AgentParameters{})
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, float64(0), m.Gauges["CgroupContainer"])
+	})
+
+	t.Run("without cgroup v2", func(t *testing.T) {
+		t.Setenv("HOST_SYS", t.TempDir())
+
+		_, err := newCgroupCollector(parameters.AgentParameters{})
+		require.Error(t, err)
+	})
+}
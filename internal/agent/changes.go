@@ -0,0 +1,45 @@
+package agent
+
+import "math"
+
+// changeFilter skips gauges which differ from the last sent values at most by epsilon.
+// Every fullRefresh reports all gauges are sent, so the server recovers lost values.
+type changeFilter struct {
+	epsilon     float64
+	fullRefresh uint
+	reports     uint
+	last        map[string]float64
+}
+
+func newChangeFilter(epsilon float64, fullRefresh uint) *changeFilter {
+	return &changeFilter{epsilon: epsilon, fullRefresh: fullRefresh, last: make(map[string]float64)}
+}
+
+// filter returns changed gauges and count of suppressed ones, it's called once per report
+func (f *changeFilter) filter(gauges map[string]float64) (map[string]float64, int) {
+	full := f.fullRefresh != 0 && f.reports%f.fullRefresh == 0
+	f.reports++
+
+	if full {
+		return gauges, 0
+	}
+
+	changed := make(map[string]float64, len(gauges))
+
+	for name, value := range gauges {
+		if last, ok := f.last[name]; ok && math.Abs(value-last) <= f.epsilon {
+			continue
+		}
+
+		changed[name] = value
+	}
+
+	return changed, len(gauges) - len(changed)
+}
+
+// remember stores gauges accepted by the server or the spool
+func (f *changeFilter) remember(gauges map[string]float64) {
+	for name, value := range gauges {
+		f.last[name] = value
+	}
+}
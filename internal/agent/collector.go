@@ -0,0 +1,286 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/memstats"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+)
+
+// Metrics contains values collected by a collector.
+// Counters contain increments since the previous collection.
+type Metrics struct {
+	Gauges   map[string]float64
+	Counters map[string]int64
+}
+
+// NewMetrics create empty Metrics
+func NewMetrics() Metrics {
+	return Metrics{
+		Gauges:   make(map[string]float64),
+		Counters: make(map[string]int64),
+	}
+}
+
+// Collector it's type for collecting metrics.
+// Collectors holding resources between collections implement io.Closer, they are closed by Agent.Close.
+type Collector interface {
+	Collect(ctx context.Context) (Metrics, error)
+}
+
+// CollectorFunc it's function implementing Collector
+type CollectorFunc func(ctx context.Context) (Metrics, error)
+
+// Collect calls f
+func (f CollectorFunc) Collect(ctx context.Context) (Metrics, error) {
+	return f(ctx)
+}
+
+// Job it's collector with its name and poll interval
+type Job struct {
+	Collector Collector
+	Name      string
+	Interval  time.Duration
+}
+
+// Factory creates collector by agent's parameters
+type Factory func(p parameters.AgentParameters) (Collector, error)
+
+// DefaultCollectors contains names of collectors enabled when parameters don't contain any
+var DefaultCollectors = []string{"memstats", "cpu"}
+
+// Registry stores collector factories by names
+type Registry struct {
+	factories map[string]Factory
+}
+
+// NewRegistry create Registry with built-in collectors
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]Factory)}
+	r.Register("memstats", func(parameters.AgentParameters) (Collector, error) {
+		ms, err := memstats.NewForServer()
+		if err != nil {
+			return nil, fmt.Errorf("create mem stats: %w", err)
+		}
+
+		return NewMemStatsCollector(ms), nil
+	})
+	r.Register("cpu", newCPUCollector)
+	r.Register("load", newLoadCollector)
+	r.Register("diskio", newDiskIOCollector)
+	r.Register("net", newNetCollector)
+	r.Register("filesystem", newFilesystemCollector)
+	r.Register("process", newProcessCollector)
+	r.Register("scrape", newScrapeCollector)
+	r.Register("exec", newExecCollector)
+	r.Register("log", newLogCollector)
+	r.Register("probe", newProbeCollector)
+	r.Register("runtime", newRuntimeCollector)
+	r.Register("cgroup", newCgroupCollector)
+
+	return r
+}
+
+// Register adds collector factory, factory with the same name is replaced
+func (r *Registry) Register(name string, f Factory) {
+	r.factories[name] = f
+}
+
+// Names returns sorted names of registered collectors
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// Jobs creates jobs for collectors enabled in parameters
+func (r *Registry) Jobs(p parameters.AgentParameters) ([]Job, error) {
+	names := p.Collectors
+	if len(names) == 0 {
+		names = DefaultCollectors
+	}
+
+	jobs := make([]Job, 0, len(names))
+
+	for _, name := range names {
+		f, ok := r.factories[name]
+		if !ok {
+			closeJobs(jobs)
+			return nil, fmt.Errorf("unknown collector %s, available collectors: %v", name, r.Names())
+		}
+
+		c, err := f(p)
+		if err != nil {
+			closeJobs(jobs)
+			return nil, fmt.Errorf("create collector %s: %w", name, err)
+		}
+
+		interval := p.PollInterval
+		if i, ok := p.CollectorIntervals[name]; ok && i != 0 {
+			interval = i
+		}
+
+		jobs = append(jobs, Job{
+			Collector: c,
+			Name:      name,
+			Interval:  time.Duration(interval) * time.Second,
+		})
+	}
+
+	return jobs, nil
+}
+
+// closeJobs closes collectors implementing io.Closer
+func closeJobs(jobs []Job) error {
+	var errs []error
+
+	for _, job := range jobs {
+		c, ok := job.Collector.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		if err := c.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close collector %s: %w", job.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MemStats it's type for reading memory statistics, GetMap returns new map on every call
+type MemStats interface {
+	ReadMemStats() error
+	GetMap() map[string]float64
+}
+
+// NewMemStatsCollector returns collector of memory statistics gauges and PollCount counter,
+// which is incremented on every collection.
+func NewMemStatsCollector(ms MemStats) Collector {
+	return CollectorFunc(func(context.Context) (Metrics, error) {
+		if err := ms.ReadMemStats(); err != nil {
+			return Metrics{}, fmt.Errorf("read mem stats: %w", err)
+		}
+
+		return Metrics{Gauges: ms.GetMap(), Counters: map[string]int64{"PollCount": 1}}, nil
+	})
+}
+
+// metricName returns name of metric for the labeled value, for example DiskReadBytes_sda.
+// Characters of label that aren't letters, digits or '_' are replaced with '_',
+// empty label, for example of mount point "/", is replaced with rootfs, so it differs from "/root".
+func metricName(base, label string) string {
+	return base + "_" + metricLabel(label)
+}
+
+func metricLabel(label string) string {
+	label = strings.Trim(invalidNameChars.ReplaceAllString(label, "_"), "_")
+	if label == "" {
+		return "rootfs"
+	}
+
+	return label
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// deltas converts cumulative counters into increments between observations.
+// The first observation of a counter gives no increment, a decreased value is treated as a counter reset.
+type deltas struct {
+	prev map[string]uint64
+}
+
+func newDeltas() *deltas {
+	return &deltas{prev: make(map[string]uint64)}
+}
+
+func (d *deltas) add(m Metrics, name string, value uint64) {
+	prev, ok := d.prev[name]
+	d.prev[name] = value
+
+	if !ok {
+		return
+	}
+
+	m.Counters[name] += increment(prev, value)
+}
+
+// increment returns difference between cumulative values, decreased value is treated as a counter reset
+func increment(prev, cur uint64) int64 {
+	if cur < prev {
+		return int64(cur)
+	}
+
+	return int64(cur - prev)
+}
+
+// nameFilter matches names by include and exclude regular expressions.
+// Empty include list includes everything, exclude list wins over include one.
+type nameFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newNameFilter(include, exclude []string) (nameFilter, error) {
+	var (
+		f   nameFilter
+		err error
+	)
+
+	if f.include, err = compileAll(include); err != nil {
+		return f, fmt.Errorf("compile include patterns: %w", err)
+	}
+
+	if f.exclude, err = compileAll(exclude); err != nil {
+		return f, fmt.Errorf("compile exclude patterns: %w", err)
+	}
+
+	return f, nil
+}
+
+func (f nameFilter) match(name string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, re := range f.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, re)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+// closingCollector records that it's closed
+type closingCollector struct {
+	CollectorFunc
+	closed bool
+}
+
+func (c *closingCollector) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRegistry_Jobs(t *testing.T) {
+	r := NewRegistry()
+	r.Register("test", func(parameters.AgentParameters) (Collector, error) {
+		return CollectorFunc(func(context.Context) (Metrics, error) { return NewMetrics(), nil }), nil
+	})
+	r.Register("error", func(parameters.AgentParameters) (Collector, error) {
+		return nil, fmt.Errorf("test error")
+	})
+
+	t.Run("default collectors", func(t *testing.T) {
+		jobs, err := r.Jobs(parameters.AgentParameters{PollInterval: 2})
+		require.NoError(t, err)
+		require.Len(t, jobs, 2)
+		require.Equal(t, "memstats", jobs[0].Name)
+		require.Equal(t, "cpu", jobs[1].Name)
+		require.Equal(t, 2*time.Second, jobs[0].Interval)
+	})
+
+	t.Run("collector interval", func(t *testing.T) {
+		jobs, err := r.Jobs(parameters.AgentParameters{
+			PollInterval:       2,
+			Collectors:         []string{"memstats", "test"},
+			CollectorIntervals: map[string]uint{"test": 30},
+		})
+		require.NoError(t, err)
+		require.Len(t, jobs, 2)
+		require.Equal(t, 2*time.Second, jobs[0].Interval)
+		require.Equal(t, "test", jobs[1].Name)
+		require.Equal(t, 30*time.Second, jobs[1].Interval)
+	})
+
+	t.Run("unknown collector", func(t *testing.T) {
+		_, err := r.Jobs(parameters.AgentParameters{Collectors: []string{"unknown"}})
+		require.Error(t, err)
+	})
+
+	t.Run("factory error", func(t *testing.T) {
+		_, err := r.Jobs(parameters.AgentParameters{Collectors: []string{"error"}})
+		require.Error(t, err)
+	})
+
+	t.Run("created collectors are closed on error", func(t *testing.T) {
+		c := &closingCollector{}
+		r := NewRegistry()
+		r.Register("closing", func(parameters.AgentParameters) (Collector, error) { return c, nil })
+
+		_, err := r.Jobs(parameters.AgentParameters{Collectors: []string{"closing", "unknown"}})
+		require.Error(t, err)
+		require.True(t, c.closed)
+	})
+
+	t.Run("cpu utilization is reported by cpu collector", func(t *testing.T) {
+		jobs, err := r.Jobs(parameters.AgentParameters{Collectors: []string{"memstats", "cpu"}})
+		require.NoError(t, err)
+
+		m, err := jobs[0].Collector.Collect(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, m.Gauges, "HeapAlloc")
+		require.NotContains(t, m.Gauges, "CPUutilization1")
+
+		m, err = jobs[1].Collector.Collect(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, m.Gauges, "CPUutilization1")
+	})
+
+	t.Run("names", func(t *testing.T) {
+		require.Equal(t, []string{"cgroup", "cpu", "diskio", "error", "exec", "filesystem", "load", "log", "memstats", "net", "probe", "process", "runtime", "scrape", "test"}, r.Names())
+	})
+}
+
+func TestNewMemStatsCollector(t *testing.T) {
+	t.Run("positive test", func(t *testing.T) {
+		ms := new(MSModckedObkect)
+		ms.On("ReadMemStats").Return(nil)
+		ms.On("GetMap").Return(map[string]float64{"test": 1})
+
+		m, err := NewMemStatsCollector(ms).Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"test": 1}, m.Gauges)
+		require.Equal(t, map[string]int64{"PollCount": 1}, m.Counters)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		ms := new(MSModckedObkect)
+		ms.On("ReadMemStats").Return(fmt.Errorf("test error"))
+
+		_, err := NewMemStatsCollector(ms).Collect(context.Background())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/models"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExecTimeout = 10 * time.Second
+	maxExecOutput      = 1 << 20
+)
+
+// newExecCollector returns collector of metrics printed by commands.
+// Every line of output in lines format is "name type value" where type is gauge or counter,
+// counter value is an increment. Output in json format is object or array of objects in the server's format.
+// Every command also gets gauges ExecSuccess_<name>, ExecExitCode_<name>, ExecDuration_<name> in seconds
+// and counter ExecParseErrors_<name>, so failed commands don't stop the agent.
+func newExecCollector(p parameters.AgentParameters) (Collector, error) {
+	if len(p.Exec) == 0 {
+		return nil, fmt.Errorf("exec commands aren't set")
+	}
+
+	commands := make([]*execCommand, 0, len(p.Exec))
+	names := make(map[string]bool, len(p.Exec))
+
+	for _, ep := range p.Exec {
+		c, err := newExecCommand(ep)
+		if err != nil {
+			return nil, fmt.Errorf("exec command %s: %w", ep.Name, err)
+		}
+
+		if names[c.label] {
+			return nil, fmt.Errorf("duplicate exec command name %s", ep.Name)
+		}
+
+		names[c.label] = true
+		commands = append(commands, c)
+	}
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		var (
+			res = NewMetrics()
+			now = time.Now()
+			mu  sync.Mutex
+			wg  sync.WaitGroup
+		)
+
+		for _, c := range commands {
+			if !c.due(now) {
+				continue
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				m := c.run(ctx)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				maps.Copy(res.Gauges, m.Gauges)
+
+				for name, delta := range m.Counters {
+					res.Counters[name] += delta
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		return res, nil
+	}), nil
+}
+
+type execCommand struct {
+	params   parameters.ExecParameters
+	label    string
+	interval time.Duration
+	timeout  time.Duration
+	lastRun  time.Time
+}
+
+func newExecCommand(ep parameters.ExecParameters) (*execCommand, error) {
+	if ep.Name == "" {
+		return nil, fmt.Errorf("name isn't set")
+	}
+
+	if len(ep.Command) == 0 {
+		return nil, fmt.Errorf("command isn't set")
+	}
+
+	switch ep.Format {
+	case "", "lines", "json":
+	default:
+		return nil, fmt.Errorf("unknown format %s, want lines or json", ep.Format)
+	}
+
+	c := &execCommand{
+		params:   ep,
+		label:    metricLabel(ep.Name),
+		interval: time.Duration(ep.Interval) * time.Second,
+		timeout:  defaultExecTimeout,
+	}
+
+	if ep.Timeout != 0 {
+		c.timeout = time.Duration(ep.Timeout) * time.Second
+	}
+
+	return c, nil
+}
+
+// due returns true if command's interval has elapsed, it's called from one goroutine
+func (c *execCommand) due(now time.Time) bool {
+	if !c.lastRun.IsZero() && now.Sub(c.lastRun) < c.interval {
+		return false
+	}
+
+	c.lastRun = now
+
+	return true
+}
+
+func (c *execCommand) run(ctx context.Context) Metrics {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+
+	cmd := exec.CommandContext(ctx, c.params.Command[0], c.params.Command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+
+	m := NewMetrics()
+	m.Gauges["ExecDuration_"+c.label] = time.Since(start).Seconds()
+	m.Gauges["ExecExitCode_"+c.label] = float64(cmd.ProcessState.ExitCode())
+	m.Counters["ExecParseErrors_"+c.label] = 0
+
+	if err != nil {
+		logger.Log.Warn("Run command",
+			zap.String("name", c.params.Name),
+			zap.String("stderr", strings.TrimSpace(stderr.String())),
+			zap.Error(err),
+		)
+
+		m.Gauges["ExecSuccess_"+c.label] = 0
+
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			m.Gauges["ExecExitCode_"+c.label] = -1
+		}
+
+		return m
+	}
+
+	m.Gauges["ExecSuccess_"+c.label] = 1
+
+	errs := parseExecOutput(m, stdout.Bytes(), c.params.Format)
+	for _, err := range errs {
+		logger.Log.Warn("Parse command output", zap.String("name", c.params.Name), zap.Error(err))
+	}
+
+	m.Counters["ExecParseErrors_"+c.label] = int64(len(errs))
+
+	return m
+}
+
+// parseExecOutput adds metrics from output to m, invalid lines are skipped and returned as errors
+func parseExecOutput(m Metrics, output []byte, format string) []error {
+	if format == "json" {
+		parsed, err := parsePushedJSON(bytes.TrimSpace(output))
+		if err != nil {
+			return []error{err}
+		}
+
+		maps.Copy(m.Gauges, parsed.Gauges)
+
+		for name, delta := range parsed.Counters {
+			m.Counters[name] += delta
+		}
+
+		return nil
+	}
+
+	var errs []error
+
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			errs = append(errs, fmt.Errorf("invalid line %q, want name type value", line))
+			continue
+		}
+
+		metric, err := models.NewMetricsByStrings(fields[0], fields[1], fields[2])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid line %q: %w", line, err))
+			continue
+		}
+
+		if err := addPushedMetric(m, metric); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("read output: %w", err))
+	}
+
+	return errs
+}
+
+// limitedBuffer keeps first maxExecOutput bytes and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := maxExecOutput - b.Len(); rest > 0 {
+		b.Buffer.Write(p[:min(len(p), rest)])
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecCollector(t *testing.T) {
+	collect := func(t *testing.T, commands ...parameters.ExecParameters) Metrics {
+		c, err := newExecCollector(parameters.AgentParameters{Exec: commands})
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		return m
+	}
+
+	t.Run("lines", func(t *testing.T) {
+		m := collect(t, parameters.ExecParameters{
+			Name:    "queue",
+			Command: []string{"sh", "-c", `printf '# comment\nqueue_size gauge 12.5\njobs counter 3\nbroken line\njobs counter x\n'`},
+		})
+
+		require.Equal(t, 12.5, m.Gauges["queue_size"])
+		require.Equal(t, int64(3), m.Counters["jobs"])
+		require.Equal(t, float64(1), m.Gauges["ExecSuccess_queue"])
+		require.Equal(t, float64(0), m.Gauges["ExecExitCode_queue"])
+		require.Contains(t, m.Gauges, "ExecDuration_queue")
+		require.Equal(t, int64(2), m.Counters["ExecParseErrors_queue"])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		m := collect(t, parameters.ExecParameters{
+			Name:    "json",
+			Format:  "json",
+			Command: []string{"echo", `[{"id":"queue_size","type":"gauge","value":7}]`},
+		})
+
+		require.Equal(t, float64(7), m.Gauges["queue_size"])
+		require.Equal(t, int64(0), m.Counters["ExecParseErrors_json"])
+	})
+
+	t.Run("non-zero exit", func(t *testing.T) {
+		m := collect(t, parameters.ExecParameters{
+			Name:    "failing",
+			Command: []string{"sh", "-c", "echo 'value gauge 1'; exit 3"},
+		})
+
+		require.NotContains(t, m.Gauges, "value")
+		require.Equal(t, float64(0), m.Gauges["ExecSuccess_failing"])
+		require.Equal(t, float64(3), m.Gauges["ExecExitCode_failing"])
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		m := collect(t, parameters.ExecParameters{Name: "missing", Command: []string{"./surely-missing-command"}})
+
+		require.Equal(t, float64(0), m.Gauges["ExecSuccess_missing"])
+		require.Equal(t, float64(-1), m.Gauges["ExecExitCode_missing"])
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		m := collect(t, parameters.ExecParameters{Name: "slow", Command: []string{"sleep", "10"}, Timeout: 1})
+
+		require.Equal(t, float64(0), m.Gauges["ExecSuccess_slow"])
+		require.Less(t, time.Since(start), 3*time.Second)
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		c, err := newExecCollector(parameters.AgentParameters{Exec: []parameters.ExecParameters{
+			{Name: "every", Command: []string{"true"}},
+			{Name: "rare", Command: []string{"true"}, Interval: 3600},
+		}})
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, m.Gauges, "ExecSuccess_every")
+		require.Contains(t, m.Gauges, "ExecSuccess_rare")
+
+		m, err = c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, m.Gauges, "ExecSuccess_every")
+		require.NotContains(t, m.Gauges, "ExecSuccess_rare")
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			commands []parameters.ExecParameters
+		}{
+			{name: "empty"},
+			{name: "without name", commands: []parameters.ExecParameters{{Command: []string{"true"}}}},
+			{name: "without command", commands: []parameters.ExecParameters{{Name: "test"}}},
+			{name: "unknown format", commands: []parameters.ExecParameters{{Name: "test", Command: []string{"true"}, Format: "xml"}}},
+			{name: "duplicate name", commands: []parameters.ExecParameters{
+				{Name: "test", Command: []string{"true"}},
+				{Name: "test", Command: []string{"true"}},
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := newExecCollector(parameters.AgentParameters{Exec: tt.commands})
+				require.Error(t, err)
+			})
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"go.uber.org/zap"
+)
+
+// newCPUCollector returns collector of per-core CPU utilization gauges CPUutilization1..N.
+// Utilization is calculated between collections, the first one gives utilization since boot.
+func newCPUCollector(parameters.AgentParameters) (Collector, error) {
+	var prev []cpu.TimesStat
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		times, err := cpu.TimesWithContext(ctx, true)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("get cpu times: %w", err)
+		}
+
+		if len(prev) != len(times) {
+			prev = make([]cpu.TimesStat, len(times))
+		}
+
+		m := NewMetrics()
+		for i, t := range times {
+			m.Gauges["CPUutilization"+strconv.Itoa(i+1)] = cpuBusyPercent(prev[i], t)
+		}
+
+		prev = times
+
+		return m, nil
+	}), nil
+}
+
+func cpuBusyPercent(prev, cur cpu.TimesStat) float64 {
+	busy := func(t cpu.TimesStat) (float64, float64) {
+		total := t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+		return total, total - t.Idle - t.Iowait
+	}
+
+	prevTotal, prevBusy := busy(prev)
+	curTotal, curBusy := busy(cur)
+
+	if curTotal <= prevTotal || curBusy <= prevBusy {
+		return 0
+	}
+
+	return min(100, (curBusy-prevBusy)/(curTotal-prevTotal)*100)
+}
+
+// newLoadCollector returns collector of load average gauges Load1, Load5 and Load15.
+func newLoadCollector(parameters.AgentParameters) (Collector, error) {
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		avg, err := load.AvgWithContext(ctx)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("get load average: %w", err)
+		}
+
+		m := NewMetrics()
+		m.Gauges["Load1"] = avg.Load1
+		m.Gauges["Load5"] = avg.Load5
+		m.Gauges["Load15"] = avg.Load15
+
+		return m, nil
+	}), nil
+}
+
+// newDiskIOCollector returns collector of disk I/O counters per device,
+// for example DiskReadBytes_sda. Devices are filtered by host parameters.
+func newDiskIOCollector(p parameters.AgentParameters) (Collector, error) {
+	f, err := newNameFilter(p.Host.IncludeDevices, p.Host.ExcludeDevices)
+	if err != nil {
+		return nil, fmt.Errorf("create device filter: %w", err)
+	}
+
+	d := newDeltas()
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		counters, err := disk.IOCountersWithContext(ctx)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("get disk io counters: %w", err)
+		}
+
+		m := NewMetrics()
+		for name, c := range counters {
+			if !f.match(name) {
+				continue
+			}
+
+			d.add(m, metricName("DiskReadBytes", name), c.ReadBytes)
+			d.add(m, metricName("DiskWriteBytes", name), c.WriteBytes)
+			d.add(m, metricName("DiskReadCount", name), c.ReadCount)
+			d.add(m, metricName("DiskWriteCount", name), c.WriteCount)
+		}
+
+		return m, nil
+	}), nil
+}
+
+// newNetCollector returns collector of network counters per interface,
+// for example NetBytesRecv_eth0. Interfaces are filtered by host parameters.
+func newNetCollector(p parameters.AgentParameters) (Collector, error) {
+	f, err := newNameFilter(p.Host.IncludeDevices, p.Host.ExcludeDevices)
+	if err != nil {
+		return nil, fmt.Errorf("create device filter: %w", err)
+	}
+
+	d := newDeltas()
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		counters, err := net.IOCountersWithContext(ctx, true)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("get network io counters: %w", err)
+		}
+
+		m := NewMetrics()
+		for _, c := range counters {
+			if !f.match(c.Name) {
+				continue
+			}
+
+			d.add(m, metricName("NetBytesSent", c.Name), c.BytesSent)
+			d.add(m, metricName("NetBytesRecv", c.Name), c.BytesRecv)
+			d.add(m, metricName("NetPacketsSent", c.Name), c.PacketsSent)
+			d.add(m, metricName("NetPacketsRecv", c.Name), c.PacketsRecv)
+		}
+
+		return m, nil
+	}), nil
+}
+
+// newFilesystemCollector returns collector of filesystem usage gauges per mount point,
+// for example FilesystemUsedBytes_home. Physical partitions are filtered by host parameters.
+// Mount points with the same label, for example /var/lib and /var_lib, are reported once.
+func newFilesystemCollector(p parameters.AgentParameters) (Collector, error) {
+	devices, err := newNameFilter(p.Host.IncludeDevices, p.Host.ExcludeDevices)
+	if err != nil {
+		return nil, fmt.Errorf("create device filter: %w", err)
+	}
+
+	mounts, err := newNameFilter(p.Host.IncludeMounts, p.Host.ExcludeMounts)
+	if err != nil {
+		return nil, fmt.Errorf("create mount filter: %w", err)
+	}
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		partitions, err := disk.PartitionsWithContext(ctx, false)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("get partitions: %w", err)
+		}
+
+		m := NewMetrics()
+		for _, part := range partitions {
+			if !devices.match(part.Device) || !mounts.match(part.Mountpoint) {
+				continue
+			}
+
+			if _, ok := m.Gauges[metricName("FilesystemTotalBytes", part.Mountpoint)]; ok {
+				logger.Log.Warn("Skip mount with the same label", zap.String("mount", part.Mountpoint))
+				continue
+			}
+
+			usage, err := disk.UsageWithContext(ctx, part.Mountpoint)
+			if err != nil {
+				logger.Log.Warn("Get filesystem usage", zap.String("mount", part.Mountpoint), zap.Error(err))
+				continue
+			}
+
+			m.Gauges[metricName("FilesystemTotalBytes", part.Mountpoint)] = float64(usage.Total)
+			m.Gauges[metricName("FilesystemUsedBytes", part.Mountpoint)] = float64(usage.Used)
+			m.Gauges[metricName("FilesystemFreeBytes", part.Mountpoint)] = float64(usage.Free)
+			m.Gauges[metricName("FilesystemUsedPercent", part.Mountpoint)] = usage.UsedPercent
+		}
+
+		return m, nil
+	}), nil
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostCollectors(t *testing.T) {
+	t.Setenv("HOST_PROC", "./testdata/proc")
+
+	p := parameters.AgentParameters{
+		Host: parameters.HostParameters{
+			ExcludeDevices: []string{"^loop", "^lo$"},
+			IncludeMounts:  []string{"^/$"},
+		},
+	}
+
+	t.Run("cpu", func(t *testing.T) {
+		c, err := newCPUCollector(p)
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"CPUutilization1": 20, "CPUutilization2": 20}, m.Gauges)
+
+		m, err = c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"CPUutilization1": 0, "CPUutilization2": 0}, m.Gauges)
+	})
+
+	t.Run("load", func(t *testing.T) {
+		c, err := newLoadCollector(p)
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"Load1": 0.5, "Load5": 0.25, "Load15": 0.1}, m.Gauges)
+	})
+
+	t.Run("disk io", func(t *testing.T) {
+		proc := t.TempDir()
+		t.Setenv("HOST_PROC", proc)
+
+		writeProcFile(t, proc, "diskstats", "   7       0 loop0 10 0 20 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n   8       0 sda 100 0 200 50 300 0 400 60 0 70 110 0 0 0 0 0 0\n")
+
+		c, err := newDiskIOCollector(p)
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, m.Counters, "first collection only remembers values")
+
+		writeProcFile(t, proc, "diskstats", "   7       0 loop0 20 0 40 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n   8       0 sda 150 0 260 50 330 0 500 60 0 70 110 0 0 0 0 0 0\n")
+
+		m, err = c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{
+			"DiskReadBytes_sda":  60 * 512,
+			"DiskWriteBytes_sda": 100 * 512,
+			"DiskReadCount_sda":  50,
+			"DiskWriteCount_sda": 30,
+		}, m.Counters)
+	})
+
+	t.Run("net", func(t *testing.T) {
+		proc := t.TempDir()
+		t.Setenv("HOST_PROC", proc)
+
+		header := "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n"
+
+		writeProcFile(t, proc, "net/dev", header+"    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0\n"+
+			"  eth0:    5000      50    0    0    0     0          0         0     2000      20    0    0    0     0       0          0\n")
+
+		c, err := newNetCollector(p)
+		require.NoError(t, err)
+
+		_, err = c.Collect(context.Background())
+		require.NoError(t, err)
+
+		writeProcFile(t, proc, "net/dev", header+"    lo:    2000      20    0    0    0     0          0         0     2000      20    0    0    0     0       0          0\n"+
+			"  eth0:    5600      56    0    0    0     0          0         0     2300      23    0    0    0     0       0          0\n")
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{
+			"NetBytesSent_eth0":   300,
+			"NetBytesRecv_eth0":   600,
+			"NetPacketsSent_eth0": 3,
+			"NetPacketsRecv_eth0": 6,
+		}, m.Counters)
+	})
+
+	t.Run("filesystem", func(t *testing.T) {
+		c, err := newFilesystemCollector(p)
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, m.Gauges, "FilesystemTotalBytes_rootfs")
+		require.Contains(t, m.Gauges, "FilesystemUsedPercent_rootfs")
+		require.NotContains(t, m.Gauges, "FilesystemTotalBytes_home")
+	})
+
+	t.Run("filesystem of root and /root", func(t *testing.T) {
+		proc := t.TempDir()
+		t.Setenv("HOST_PROC", proc)
+
+		writeProcFile(t, proc, "1/mounts", "/dev/sda1 / ext4 rw 0 0\n/dev/sda2 /root ext4 rw 0 0\n")
+		writeProcFile(t, proc, "filesystems", "\text4\n")
+
+		c, err := newFilesystemCollector(parameters.AgentParameters{})
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, m.Gauges, "FilesystemTotalBytes_rootfs")
+		require.Contains(t, m.Gauges, "FilesystemTotalBytes_root", "mounts don't collide")
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := newNetCollector(parameters.AgentParameters{
+			Host: parameters.HostParameters{IncludeDevices: []string{"("}},
+		})
+		require.Error(t, err)
+	})
+}
+
+func writeProcFile(t *testing.T, proc, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(proc, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func Test_deltas(t *testing.T) {
+	d := newDeltas()
+	m := NewMetrics()
+
+	d.add(m, "test", 10)
+	require.Empty(t, m.Counters)
+
+	d.add(m, "test", 15)
+	require.Equal(t, int64(5), m.Counters["test"])
+
+	m = NewMetrics()
+	d.add(m, "test", 3)
+	require.Equal(t, int64(3), m.Counters["test"], "decreased value is a reset")
+}
+
+func Test_metricName(t *testing.T) {
+	require.Equal(t, "FilesystemUsedBytes_rootfs", metricName("FilesystemUsedBytes", "/"))
+	require.Equal(t, "FilesystemUsedBytes_root", metricName("FilesystemUsedBytes", "/root"))
+	require.Equal(t, "FilesystemUsedBytes_var_lib", metricName("FilesystemUsedBytes", "/var/lib/"))
+	require.Equal(t, "NetBytesRecv_eth0", metricName("NetBytesRecv", "eth0"))
+}
@@ -0,0 +1,287 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	maxPushBody      = 1 << 20
+	maxUDPPacket     = 64 << 10
+	shutdownListener = 5 * time.Second
+)
+
+// Listener accepts metrics pushed by local processes over HTTP and UDP.
+// Every line of request body or UDP packet is name:value|type where type is c for counter and g for gauge,
+// also body or packet may contain JSON object or array of objects in the server's format.
+// Listener aggregates pushed metrics and it's a Collector returning metrics pushed since the previous collection,
+// so gauges which aren't pushed again expire like gauges of other collectors.
+type Listener struct {
+	httpAddr string
+	udpAddr  string
+	metrics  Metrics
+	mu       sync.Mutex
+}
+
+// NewListener create Listener, empty address disables the corresponding endpoint
+func NewListener(httpAddr, udpAddr string) *Listener {
+	return &Listener{
+		httpAddr: httpAddr,
+		udpAddr:  udpAddr,
+		metrics:  NewMetrics(),
+	}
+}
+
+// Collect returns metrics pushed since the previous collection
+func (l *Listener) Collect(context.Context) (Metrics, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := l.metrics
+	l.metrics = NewMetrics()
+
+	return m, nil
+}
+
+// Run serves endpoints until ctx is done
+func (l *Listener) Run(ctx context.Context) error {
+	var (
+		lis  net.Listener
+		conn net.PacketConn
+		err  error
+	)
+
+	if l.httpAddr != "" {
+		if lis, err = net.Listen("tcp", l.httpAddr); err != nil {
+			return fmt.Errorf("listen http %s: %w", l.httpAddr, err)
+		}
+	}
+
+	if l.udpAddr != "" {
+		if conn, err = net.ListenPacket("udp", l.udpAddr); err != nil {
+			if lis != nil {
+				lis.Close()
+			}
+
+			return fmt.Errorf("listen udp %s: %w", l.udpAddr, err)
+		}
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+
+	if lis != nil {
+		eg.Go(func() error { return l.serveHTTP(egCtx, lis) })
+	}
+
+	if conn != nil {
+		eg.Go(func() error { return l.serveUDP(egCtx, conn) })
+	}
+
+	if err := eg.Wait(); err != nil {
+		return fmt.Errorf("serve listener: %w", err)
+	}
+
+	return nil
+}
+
+// Router returns router of HTTP endpoint
+func (l *Listener) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/metrics", l.push)
+
+	return r
+}
+
+func (l *Listener) serveHTTP(ctx context.Context, lis net.Listener) error {
+	srv := &http.Server{Handler: l.Router(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownListener)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Warn("Shutdown push listener", zap.Error(err))
+		}
+	}()
+
+	logger.Log.Info("Push listener start", zap.String("http", lis.Addr().String()))
+
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve http: %w", err)
+	}
+
+	return nil
+}
+
+func (l *Listener) serveUDP(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	logger.Log.Info("Push listener start", zap.String("udp", conn.LocalAddr().String()))
+
+	buf := make([]byte, maxUDPPacket)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("read udp: %w", err)
+		}
+
+		if err := l.add(buf[:n]); err != nil {
+			logger.Log.Warn("Parse pushed metrics", zap.String("from", addr.String()), zap.Error(err))
+		}
+	}
+}
+
+func (l *Listener) push(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := l.add(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// add parses data and aggregates metrics, nothing is added if data contains an invalid metric
+func (l *Listener) add(data []byte) error {
+	m, err := parsePushed(data)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	maps.Copy(l.metrics.Gauges, m.Gauges)
+
+	for name, delta := range m.Counters {
+		l.metrics.Counters[name] += delta
+	}
+
+	return nil
+}
+
+func parsePushed(data []byte) (Metrics, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) != 0 && (data[0] == '{' || data[0] == '[') {
+		return parsePushedJSON(data)
+	}
+
+	m := NewMetrics()
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, maxPushBody)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		if err := addPushedLine(m, line); err != nil {
+			return Metrics{}, err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return Metrics{}, fmt.Errorf("read lines: %w", err)
+	}
+
+	return m, nil
+}
+
+func addPushedLine(m Metrics, line string) error {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid line %q, want name:value|type", line)
+	}
+
+	value, mType, ok := strings.Cut(rest, "|")
+	if !ok {
+		return fmt.Errorf("invalid line %q, want name:value|type", line)
+	}
+
+	switch mType {
+	case "c":
+		mType = models.TypeCounter
+	case "g":
+		mType = models.TypeGauge
+	default:
+		return fmt.Errorf("invalid type in line %q, want c or g", line)
+	}
+
+	metric, err := models.NewMetricsByStrings(name, mType, value)
+	if err != nil {
+		return fmt.Errorf("invalid line %q: %w", line, err)
+	}
+
+	return addPushedMetric(m, metric)
+}
+
+func parsePushedJSON(data []byte) (Metrics, error) {
+	var metrics []*models.Metrics
+
+	if data[0] == '{' {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return Metrics{}, fmt.Errorf("unmarshal json: %w", err)
+	}
+
+	m := NewMetrics()
+	for _, metric := range metrics {
+		if err := addPushedMetric(m, metric); err != nil {
+			return Metrics{}, err
+		}
+	}
+
+	return m, nil
+}
+
+func addPushedMetric(m Metrics, metric *models.Metrics) error {
+	if metric == nil || metric.ID == "" {
+		return fmt.Errorf("metric without id")
+	}
+
+	switch {
+	case metric.MType == models.TypeCounter && metric.Delta != nil:
+		m.Counters[metric.ID] += *metric.Delta
+	case metric.MType == models.TypeGauge && metric.Value != nil:
+		m.Gauges[metric.ID] = *metric.Value
+	default:
+		return fmt.Errorf("invalid metric %s with type %s", metric.ID, metric.MType)
+	}
+
+	return nil
+}
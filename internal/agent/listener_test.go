@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parsePushed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Metrics
+		wantErr bool
+	}{
+		{
+			name: "lines",
+			data: "requests:1|c\nrequests:2|c\n\ntemperature:36.6|g\ntemperature:37|g\n",
+			want: Metrics{Gauges: map[string]float64{"temperature": 37}, Counters: map[string]int64{"requests": 3}},
+		},
+		{
+			name: "json object",
+			data: `{"id":"requests","type":"counter","delta":5}`,
+			want: Metrics{Gauges: map[string]float64{}, Counters: map[string]int64{"requests": 5}},
+		},
+		{
+			name: "json array",
+			data: `[{"id":"requests","type":"counter","delta":5},{"id":"temperature","type":"gauge","value":1.5}]`,
+			want: Metrics{Gauges: map[string]float64{"temperature": 1.5}, Counters: map[string]int64{"requests": 5}},
+		},
+		{name: "without type", data: "requests:1", wantErr: true},
+		{name: "unknown type", data: "requests:1|ms", wantErr: true},
+		{name: "invalid counter", data: "requests:1.5|c", wantErr: true},
+		{name: "without name", data: ":1|c", wantErr: true},
+		{name: "one invalid line", data: "requests:1|c\nrequests|c", wantErr: true},
+		{name: "json without value", data: `{"id":"temperature","type":"gauge"}`, wantErr: true},
+		{name: "invalid json", data: `{"id":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePushed([]byte(tt.data))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	t.Run("http", func(t *testing.T) {
+		l := NewListener("", "")
+		srv := httptest.NewServer(l.Router())
+		defer srv.Close()
+
+		client := resty.New()
+
+		res, err := client.R().SetBody("requests:1|c\ntemperature:1|g").Post(srv.URL + "/metrics")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		res, err = client.R().SetBody(`{"id":"requests","type":"counter","delta":2}`).Post(srv.URL + "/metrics")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		res, err = client.R().SetBody("requests:1|x").Post(srv.URL + "/metrics")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+
+		m, err := l.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{"requests": 3}, m.Counters)
+		require.Equal(t, map[string]float64{"temperature": 1}, m.Gauges)
+
+		m, err = l.Collect(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, m.Counters, "collect resets aggregated metrics")
+	})
+
+	t.Run("udp", func(t *testing.T) {
+		l := NewListener("", "")
+		conn, err := net.ListenPacket("udp", "localhost:0")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- l.serveUDP(ctx, conn) }()
+
+		client, err := net.Dial("udp", conn.LocalAddr().String())
+		require.NoError(t, err)
+		defer client.Close()
+
+		_, err = client.Write([]byte("requests:1|c"))
+		require.NoError(t, err)
+		_, err = client.Write([]byte("broken"))
+		require.NoError(t, err)
+		_, err = client.Write([]byte("requests:2|c"))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return l.metrics.Counters["requests"] == 3
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		err := NewListener("invalid address", "").Run(context.Background())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,430 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxLogRead limits data read from one file per collection, the rest is read by next collections
+	maxLogRead = 16 << 20
+	// fingerprintSize it's size of file beginning identifying file after restart of agent
+	fingerprintSize = 256
+)
+
+// logCollector collects metrics derived from lines of log files by regex rules.
+// Files are kept open between collections, so the rest of rotated file is read before the new file,
+// Close closes them.
+// A file which is shorter than read offset is treated as truncated and read from the beginning.
+// Read offsets are saved to the state file and restored after restart if beginning of file is the same,
+// without state new files are read from the end. The state file is loaded by the first collection,
+// so a collector created while the previous one is still running gets its last offsets.
+type logCollector struct {
+	files     []*logFile
+	stateFile string
+	loaded    bool
+}
+
+func newLogCollector(p parameters.AgentParameters) (Collector, error) {
+	if len(p.Logs) == 0 {
+		return nil, fmt.Errorf("log files aren't set")
+	}
+
+	files := make([]*logFile, 0, len(p.Logs))
+
+	for _, lp := range p.Logs {
+		f, err := newLogFile(lp)
+		if err != nil {
+			return nil, fmt.Errorf("log file %s: %w", lp.Path, err)
+		}
+
+		files = append(files, f)
+	}
+
+	return &logCollector{files: files, stateFile: p.LogStateFile}, nil
+}
+
+// Collect reads new lines of files and saves read offsets
+func (c *logCollector) Collect(context.Context) (Metrics, error) {
+	if !c.loaded {
+		saved, err := loadLogState(c.stateFile)
+		if err != nil {
+			return Metrics{}, err
+		}
+
+		for _, f := range c.files {
+			f.saved = saved[f.params.Path]
+		}
+
+		c.loaded = true
+	}
+
+	m := NewMetrics()
+	values := make(map[string]*logValues)
+	state := make(map[string]logFileState, len(c.files))
+
+	for _, f := range c.files {
+		if err := f.collect(m, values); err != nil {
+			logger.Log.Warn("Tail log file", zap.String("path", f.params.Path), zap.Error(err))
+		}
+
+		state[f.params.Path] = f.state()
+	}
+
+	for name, v := range values {
+		m.Gauges[name] = v.value()
+	}
+
+	if err := saveLogState(c.stateFile, state); err != nil {
+		logger.Log.Warn("Save log state", zap.Error(err))
+	}
+
+	return m, nil
+}
+
+// Close closes open files
+func (c *logCollector) Close() error {
+	var errs []error
+
+	for _, f := range c.files {
+		if f.file == nil {
+			continue
+		}
+
+		if err := f.file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close log file %s: %w", f.params.Path, err))
+		}
+
+		f.file = nil
+	}
+
+	return errors.Join(errs...)
+}
+
+type logRule struct {
+	name      string
+	re        *regexp.Regexp
+	group     int
+	aggregate string
+}
+
+func newLogRule(rp parameters.LogRuleParameters) (logRule, error) {
+	if rp.Name == "" {
+		return logRule{}, fmt.Errorf("rule name isn't set")
+	}
+
+	re, err := regexp.Compile(rp.Pattern)
+	if err != nil {
+		return logRule{}, fmt.Errorf("compile pattern of rule %s: %w", rp.Name, err)
+	}
+
+	r := logRule{name: rp.Name, re: re, group: -1, aggregate: rp.Aggregate}
+
+	if rp.Group != "" {
+		r.group = re.SubexpIndex(rp.Group)
+		if n, err := strconv.Atoi(rp.Group); err == nil {
+			r.group = n
+		}
+
+		if r.group <= 0 || r.group > re.NumSubexp() {
+			return logRule{}, fmt.Errorf("rule %s doesn't have group %s", rp.Name, rp.Group)
+		}
+	}
+
+	switch r.aggregate {
+	case "":
+		r.aggregate = "last"
+	case "last", "avg", "max":
+	default:
+		return logRule{}, fmt.Errorf("unknown aggregate %s of rule %s, want last, avg or max", rp.Aggregate, rp.Name)
+	}
+
+	return r, nil
+}
+
+// apply counts matched line or adds captured value
+func (r logRule) apply(line string, m Metrics, values map[string]*logValues) {
+	if r.group < 0 {
+		if r.re.MatchString(line) {
+			m.Counters[r.name]++
+		}
+
+		return
+	}
+
+	match := r.re.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+
+	v, err := strconv.ParseFloat(match[r.group], 64)
+	if err != nil {
+		return
+	}
+
+	lv, ok := values[r.name]
+	if !ok {
+		lv = &logValues{aggregate: r.aggregate}
+		values[r.name] = lv
+	}
+
+	lv.add(v)
+}
+
+// logValues aggregates captured values over collection interval
+type logValues struct {
+	aggregate string
+	last      float64
+	sum       float64
+	max       float64
+	count     int
+}
+
+func (v *logValues) add(value float64) {
+	if v.count == 0 || value > v.max {
+		v.max = value
+	}
+
+	v.last = value
+	v.sum += value
+	v.count++
+}
+
+func (v *logValues) value() float64 {
+	switch v.aggregate {
+	case "avg":
+		return v.sum / float64(v.count)
+	case "max":
+		return v.max
+	default:
+		return v.last
+	}
+}
+
+// logFileState it's saved read offset of file with fingerprint of file beginning
+type logFileState struct {
+	Offset          int64  `json:"offset"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int    `json:"fingerprint_size"`
+}
+
+type logFile struct {
+	params parameters.LogParameters
+	rules  []logRule
+	saved  *logFileState
+
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+func newLogFile(lp parameters.LogParameters) (*logFile, error) {
+	if lp.Path == "" {
+		return nil, fmt.Errorf("path isn't set")
+	}
+
+	if len(lp.Rules) == 0 {
+		return nil, fmt.Errorf("rules aren't set")
+	}
+
+	f := &logFile{params: lp}
+
+	for _, rp := range lp.Rules {
+		r, err := newLogRule(rp)
+		if err != nil {
+			return nil, err
+		}
+
+		f.rules = append(f.rules, r)
+	}
+
+	return f, nil
+}
+
+func (f *logFile) collect(m Metrics, values map[string]*logValues) error {
+	info, err := os.Stat(f.params.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("stat file: %w", err)
+	}
+
+	if f.file == nil {
+		if info == nil {
+			// file created later is read from the beginning
+			f.saved = &logFileState{}
+			return nil
+		}
+
+		return f.open(info, m, values)
+	}
+
+	switch {
+	case info == nil:
+		// file is rotated and the new one isn't created yet
+		return f.read(m, values)
+	case !os.SameFile(info, f.info):
+		if err := f.read(m, values); err != nil {
+			return err
+		}
+
+		f.file.Close()
+		f.file = nil
+		f.saved = &logFileState{}
+
+		return f.open(info, m, values)
+	case info.Size() < f.offset:
+		f.offset = 0
+	}
+
+	return f.read(m, values)
+}
+
+// open opens file for the first time, saved offset is used if beginning of file is the same
+func (f *logFile) open(info os.FileInfo, m Metrics, values map[string]*logValues) error {
+	file, err := os.Open(f.params.Path)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+
+	offset := info.Size()
+
+	if f.saved != nil {
+		offset = 0
+
+		fp, err := fingerprint(file, f.saved.FingerprintSize)
+		if err == nil && fp == f.saved.Fingerprint && f.saved.Offset <= info.Size() {
+			offset = f.saved.Offset
+		}
+	}
+
+	f.file, f.info, f.offset = file, info, offset
+
+	return f.read(m, values)
+}
+
+// read applies rules to complete lines after offset
+func (f *logFile) read(m Metrics, values map[string]*logValues) error {
+	r := bufio.NewReader(io.NewSectionReader(f.file, f.offset, maxLogRead))
+
+	var read int64
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read file: %w", err)
+		}
+
+		// incomplete line is read by next collections unless it's longer than the read limit
+		if !strings.HasSuffix(line, "\n") && (read+int64(len(line)) < maxLogRead || line == "") {
+			break
+		}
+
+		read += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		for _, rule := range f.rules {
+			rule.apply(line, m, values)
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	f.offset += read
+
+	return nil
+}
+
+func (f *logFile) state() logFileState {
+	s := logFileState{Offset: f.offset}
+
+	if f.file == nil {
+		return s
+	}
+
+	s.FingerprintSize = int(min(f.offset, fingerprintSize))
+	s.Fingerprint, _ = fingerprint(f.file, s.FingerprintSize)
+
+	return s
+}
+
+func fingerprint(r io.ReaderAt, size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := r.ReadAt(buf, 0); err != nil && !(errors.Is(err, io.EOF) && size == 0) {
+		return "", err
+	}
+
+	sum := sha256.Sum256(buf)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func loadLogState(path string) (map[string]*logFileState, error) {
+	state := make(map[string]*logFileState)
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read log state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unmarshal log state: %w", err)
+	}
+
+	return state, nil
+}
+
+func saveLogState(path string, state map[string]logFileState) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal log state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create log state: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write log state: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close log state: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename log state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogCollector(t *testing.T) {
+	rules := []parameters.LogRuleParameters{
+		{Name: "AppErrors", Pattern: "ERROR"},
+		{Name: "AppLatency", Pattern: `latency=(?P<ms>\d+)ms`, Group: "ms", Aggregate: "max"},
+		{Name: "AppLatencyAvg", Pattern: `latency=(\d+)ms`, Group: "1", Aggregate: "avg"},
+	}
+
+	appendLog := func(t *testing.T, path, data string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		defer f.Close()
+
+		_, err = f.WriteString(data)
+		require.NoError(t, err)
+	}
+
+	newCollector := func(t *testing.T, path, stateFile string) Collector {
+		c, err := newLogCollector(parameters.AgentParameters{
+			Logs:         []parameters.LogParameters{{Path: path, Rules: rules}},
+			LogStateFile: stateFile,
+		})
+		require.NoError(t, err)
+
+		return c
+	}
+
+	collect := func(t *testing.T, c Collector) Metrics {
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		return m
+	}
+
+	t.Run("tail", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		stateFile := filepath.Join(dir, "state.json")
+		appendLog(t, path, "ERROR before start\n")
+
+		c := newCollector(t, path, stateFile)
+		m := collect(t, c)
+		require.Empty(t, m.Counters, "existing file is read from the end")
+
+		appendLog(t, path, "ERROR a\nINFO latency=10ms\nINFO latency=30ms\nERROR incomplete")
+		m = collect(t, c)
+		require.Equal(t, int64(1), m.Counters["AppErrors"])
+		require.Equal(t, float64(30), m.Gauges["AppLatency"])
+		require.Equal(t, float64(20), m.Gauges["AppLatencyAvg"])
+
+		appendLog(t, path, " line\n")
+		m = collect(t, c)
+		require.Equal(t, int64(1), m.Counters["AppErrors"], "incomplete line is read after completion")
+		require.NotContains(t, m.Gauges, "AppLatency", "gauge is set only when values are captured")
+
+		t.Run("rotation", func(t *testing.T) {
+			require.NoError(t, os.Rename(path, path+".1"))
+			appendLog(t, path+".1", "ERROR in rotated file\n")
+			appendLog(t, path, "ERROR in new file\n")
+
+			m := collect(t, c)
+			require.Equal(t, int64(2), m.Counters["AppErrors"])
+		})
+
+		t.Run("truncation", func(t *testing.T) {
+			require.NoError(t, os.Truncate(path, 0))
+			appendLog(t, path, "ERROR\n")
+
+			m := collect(t, c)
+			require.Equal(t, int64(1), m.Counters["AppErrors"])
+		})
+
+		t.Run("restart", func(t *testing.T) {
+			appendLog(t, path, "ERROR while agent is down\n")
+
+			m := collect(t, newCollector(t, path, stateFile))
+			require.Equal(t, int64(1), m.Counters["AppErrors"], "offset is restored from state")
+		})
+
+		t.Run("replaced while agent is down", func(t *testing.T) {
+			require.NoError(t, os.Remove(path))
+			appendLog(t, path, "INFO new file\nERROR new file\n")
+
+			m := collect(t, newCollector(t, path, stateFile))
+			require.Equal(t, int64(1), m.Counters["AppErrors"], "file with other beginning is read from the beginning")
+		})
+	})
+
+	t.Run("replacement created while previous collector runs", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		stateFile := filepath.Join(dir, "state.json")
+		appendLog(t, path, "INFO start\n")
+
+		previous := newCollector(t, path, stateFile)
+		collect(t, previous)
+
+		next := newCollector(t, path, stateFile)
+		appendLog(t, path, "ERROR read by previous collector\n")
+		m := collect(t, previous)
+		require.Equal(t, int64(1), m.Counters["AppErrors"])
+
+		appendLog(t, path, "ERROR after replacement\n")
+		m = collect(t, next)
+		require.Equal(t, int64(1), m.Counters["AppErrors"], "state is loaded by the first collection, so lines aren't counted twice")
+	})
+
+	t.Run("file created later", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+
+		c := newCollector(t, path, "")
+		m := collect(t, c)
+		require.Empty(t, m.Counters)
+
+		appendLog(t, path, "ERROR\n")
+		m = collect(t, c)
+		require.Equal(t, int64(1), m.Counters["AppErrors"])
+	})
+
+	t.Run("close", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		appendLog(t, path, "ERROR\n")
+
+		c := newCollector(t, path, "")
+		collect(t, c)
+
+		lc := c.(*logCollector)
+		require.NotNil(t, lc.files[0].file)
+
+		require.NoError(t, NewAgent(nil, 1, 1, Job{Collector: c, Name: "log"}).Close())
+		require.Nil(t, lc.files[0].file, "agent closes open files")
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name string
+			logs []parameters.LogParameters
+		}{
+			{name: "empty"},
+			{name: "without path", logs: []parameters.LogParameters{{Rules: rules}}},
+			{name: "without rules", logs: []parameters.LogParameters{{Path: "app.log"}}},
+			{name: "without rule name", logs: []parameters.LogParameters{{Path: "app.log", Rules: []parameters.LogRuleParameters{{Pattern: "ERROR"}}}}},
+			{name: "invalid pattern", logs: []parameters.LogParameters{{Path: "app.log", Rules: []parameters.LogRuleParameters{{Name: "a", Pattern: "("}}}}},
+			{name: "unknown group", logs: []parameters.LogParameters{{Path: "app.log", Rules: []parameters.LogRuleParameters{{Name: "a", Pattern: "(a)", Group: "b"}}}}},
+			{name: "unknown aggregate", logs: []parameters.LogParameters{{Path: "app.log", Rules: []parameters.LogRuleParameters{{Name: "a", Pattern: "(a)", Group: "1", Aggregate: "min"}}}}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := newLogCollector(parameters.AgentParameters{Logs: tt.logs})
+				require.Error(t, err)
+			})
+		}
+	})
+}
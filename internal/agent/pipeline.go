@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+)
+
+// Pipeline it's ordered list of rules filtering, renaming and scaling collected metrics.
+// Scaling is applied only to gauges, because counters are integer increments.
+type Pipeline struct {
+	rules []metricRule
+}
+
+type metricRule struct {
+	action      string
+	re          *regexp.Regexp
+	replacement string
+	prefix      string
+	factor      float64
+}
+
+// NewPipeline create pipeline from rules of agent's parameters
+func NewPipeline(rules []parameters.MetricRuleParameters) (*Pipeline, error) {
+	p := &Pipeline{rules: make([]metricRule, 0, len(rules))}
+
+	for i, rp := range rules {
+		r, err := newMetricRule(rp)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		p.rules = append(p.rules, r)
+	}
+
+	return p, nil
+}
+
+func newMetricRule(rp parameters.MetricRuleParameters) (metricRule, error) {
+	switch rp.Action {
+	case "allow", "deny", "rename":
+		if rp.Pattern == "" {
+			return metricRule{}, fmt.Errorf("pattern of %s rule isn't set", rp.Action)
+		}
+	case "prefix":
+		if rp.Prefix == "" {
+			return metricRule{}, fmt.Errorf("prefix isn't set")
+		}
+	case "scale":
+		if rp.Factor == 0 {
+			return metricRule{}, fmt.Errorf("factor isn't set")
+		}
+	default:
+		return metricRule{}, fmt.Errorf("unknown action %s, want allow, deny, rename, prefix or scale", rp.Action)
+	}
+
+	re, err := regexp.Compile(rp.Pattern)
+	if err != nil {
+		return metricRule{}, fmt.Errorf("compile pattern: %w", err)
+	}
+
+	return metricRule{
+		action:      rp.Action,
+		re:          re,
+		replacement: rp.Replacement,
+		prefix:      rp.Prefix,
+		factor:      rp.Factor,
+	}, nil
+}
+
+// Apply returns metrics processed by rules. Gauges renamed to the same name keep the last value,
+// counters renamed to the same name are summed.
+func (p *Pipeline) Apply(m Metrics) Metrics {
+	res := NewMetrics()
+
+	for name, value := range m.Gauges {
+		if name, value, ok := p.apply(name, value, true); ok {
+			res.Gauges[name] = value
+		}
+	}
+
+	for name, delta := range m.Counters {
+		if name, _, ok := p.apply(name, 0, false); ok {
+			res.Counters[name] += delta
+		}
+	}
+
+	return res
+}
+
+// apply returns new name and value of metric, false means that metric is dropped
+func (p *Pipeline) apply(name string, value float64, gauge bool) (string, float64, bool) {
+	for _, r := range p.rules {
+		matched := r.re.MatchString(name)
+
+		switch r.action {
+		case "allow":
+			if !matched {
+				return "", 0, false
+			}
+		case "deny":
+			if matched {
+				return "", 0, false
+			}
+		case "rename":
+			if matched {
+				name = r.re.ReplaceAllString(name, r.replacement)
+			}
+		case "prefix":
+			if matched {
+				name = r.prefix + name
+			}
+		case "scale":
+			if matched && gauge {
+				value *= r.factor
+			}
+		}
+	}
+
+	return name, value, name != ""
+}
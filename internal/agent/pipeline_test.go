@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_Apply(t *testing.T) {
+	p, err := NewPipeline([]parameters.MetricRuleParameters{
+		{Action: "deny", Pattern: "^RandomValue$"},
+		{Action: "allow", Pattern: "^(Heap|Random|Poll|Disk)"},
+		{Action: "rename", Pattern: "^Heap(.*)$", Replacement: "heap_${1}_bytes"},
+		{Action: "rename", Pattern: "^Disk(Read|Write)Bytes_.*$", Replacement: "disk_${1}_bytes"},
+		{Action: "scale", Pattern: "_bytes$", Factor: 1.0 / (1 << 20)},
+		{Action: "prefix", Prefix: "prod_"},
+	})
+	require.NoError(t, err)
+
+	m := p.Apply(Metrics{
+		Gauges: map[string]float64{
+			"RandomValue": 0.5,
+			"HeapAlloc":   2 << 20,
+			"Alloc":       1,
+		},
+		Counters: map[string]int64{
+			"PollCount":          1,
+			"DiskReadBytes_sda":  10,
+			"DiskReadBytes_sdb":  5,
+			"DiskWriteBytes_sda": 1,
+		},
+	})
+
+	require.Equal(t, map[string]float64{"prod_heap_Alloc_bytes": 2}, m.Gauges)
+	require.Equal(t, map[string]int64{
+		"prod_PollCount":        1,
+		"prod_disk_Read_bytes":  15,
+		"prod_disk_Write_bytes": 1,
+	}, m.Counters, "counters aren't scaled and are summed after renaming to the same name")
+
+	t.Run("invalid rules", func(t *testing.T) {
+		tests := []struct {
+			name string
+			rule parameters.MetricRuleParameters
+		}{
+			{name: "unknown action", rule: parameters.MetricRuleParameters{Action: "keep", Pattern: "a"}},
+			{name: "without pattern", rule: parameters.MetricRuleParameters{Action: "deny"}},
+			{name: "invalid pattern", rule: parameters.MetricRuleParameters{Action: "deny", Pattern: "("}},
+			{name: "without prefix", rule: parameters.MetricRuleParameters{Action: "prefix"}},
+			{name: "without factor", rule: parameters.MetricRuleParameters{Action: "scale"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := NewPipeline([]parameters.MetricRuleParameters{tt.rule})
+				require.Error(t, err)
+			})
+		}
+	})
+}
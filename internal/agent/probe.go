@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultProbeTimeout = 5 * time.Second
+	maxProbeBody        = 1 << 20
+)
+
+// newProbeCollector returns collector of synthetic HTTP GET and TCP connect checks.
+// Every probe gets gauges ProbeSuccess_<name>, ProbeLatency_<name> in seconds and counter ProbeFailures_<name>,
+// HTTP probes also get ProbeStatus_<name> and ProbeTLSExpiryDays_<name> for HTTPS targets.
+func newProbeCollector(p parameters.AgentParameters) (Collector, error) {
+	if len(p.Probes) == 0 {
+		return nil, fmt.Errorf("probes aren't set")
+	}
+
+	client := resty.New()
+	insecureClient := resty.New().SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	probes := make([]*probe, 0, len(p.Probes))
+	names := make(map[string]bool, len(p.Probes))
+
+	for _, pp := range p.Probes {
+		c := client
+		if pp.Insecure {
+			c = insecureClient
+		}
+
+		pr, err := newProbe(pp, c)
+		if err != nil {
+			return nil, fmt.Errorf("probe %s: %w", pp.Name, err)
+		}
+
+		if names[pr.label] {
+			return nil, fmt.Errorf("duplicate probe name %s", pp.Name)
+		}
+
+		names[pr.label] = true
+		probes = append(probes, pr)
+	}
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		var (
+			res = NewMetrics()
+			mu  sync.Mutex
+			wg  sync.WaitGroup
+		)
+
+		for _, pr := range probes {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				m := NewMetrics()
+
+				start := time.Now()
+				err := pr.check(ctx, m)
+				m.Gauges["ProbeLatency_"+pr.label] = time.Since(start).Seconds()
+				m.Gauges["ProbeSuccess_"+pr.label] = 1
+				m.Counters["ProbeFailures_"+pr.label] = 0
+
+				if err != nil {
+					logger.Log.Warn("Probe target", zap.String("probe", pr.params.Name), zap.Error(err))
+					m.Gauges["ProbeSuccess_"+pr.label] = 0
+					m.Counters["ProbeFailures_"+pr.label] = 1
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				maps.Copy(res.Gauges, m.Gauges)
+
+				for name, delta := range m.Counters {
+					res.Counters[name] += delta
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		return res, nil
+	}), nil
+}
+
+type probe struct {
+	params  parameters.ProbeParameters
+	label   string
+	timeout time.Duration
+	body    *regexp.Regexp
+	client  *resty.Client
+}
+
+func newProbe(pp parameters.ProbeParameters, client *resty.Client) (*probe, error) {
+	if pp.Name == "" {
+		return nil, fmt.Errorf("name isn't set")
+	}
+
+	pr := &probe{
+		params:  pp,
+		label:   metricLabel(pp.Name),
+		timeout: defaultProbeTimeout,
+		client:  client,
+	}
+
+	if pp.Timeout != 0 {
+		pr.timeout = time.Duration(pp.Timeout) * time.Second
+	}
+
+	switch pp.Type {
+	case "", "http":
+		pr.params.Type = "http"
+
+		if pp.URL == "" {
+			return nil, fmt.Errorf("url isn't set")
+		}
+
+		if pp.Body != "" {
+			re, err := regexp.Compile(pp.Body)
+			if err != nil {
+				return nil, fmt.Errorf("compile body pattern: %w", err)
+			}
+
+			pr.body = re
+		}
+	case "tcp":
+		if pp.Address == "" {
+			return nil, fmt.Errorf("address isn't set")
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %s, want http or tcp", pp.Type)
+	}
+
+	return pr, nil
+}
+
+func (pr *probe) check(ctx context.Context, m Metrics) error {
+	ctx, cancel := context.WithTimeout(ctx, pr.timeout)
+	defer cancel()
+
+	if pr.params.Type == "tcp" {
+		return pr.checkTCP(ctx)
+	}
+
+	return pr.checkHTTP(ctx, m)
+}
+
+func (pr *probe) checkTCP(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", pr.params.Address)
+	if err != nil {
+		return fmt.Errorf("connect %s: %w", pr.params.Address, err)
+	}
+
+	return conn.Close()
+}
+
+func (pr *probe) checkHTTP(ctx context.Context, m Metrics) error {
+	resp, err := pr.client.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		Get(pr.params.URL)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", pr.params.URL, err)
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	m.Gauges["ProbeStatus_"+pr.label] = float64(resp.StatusCode())
+
+	if state := resp.RawResponse.TLS; state != nil && len(state.PeerCertificates) > 0 {
+		m.Gauges["ProbeTLSExpiryDays_"+pr.label] = time.Until(state.PeerCertificates[0].NotAfter).Hours() / 24
+	}
+
+	if pr.params.Status != 0 && resp.StatusCode() != pr.params.Status ||
+		pr.params.Status == 0 && (resp.StatusCode() < 200 || resp.StatusCode() > 299) {
+		return fmt.Errorf("get %s: unexpected status %s", pr.params.URL, resp.Status())
+	}
+
+	if pr.body == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxProbeBody))
+	if err != nil {
+		return fmt.Errorf("read %s: %w", pr.params.URL, err)
+	}
+
+	if !pr.body.Match(data) {
+		return fmt.Errorf("get %s: body doesn't match %s", pr.params.URL, pr.params.Body)
+	}
+
+	return nil
+}
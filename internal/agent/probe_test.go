@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeCollector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer srv.Close()
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	collect := func(t *testing.T, probes ...parameters.ProbeParameters) Metrics {
+		c, err := newProbeCollector(parameters.AgentParameters{Probes: probes})
+		require.NoError(t, err)
+
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		return m
+	}
+
+	t.Run("http", func(t *testing.T) {
+		m := collect(t,
+			parameters.ProbeParameters{Name: "ok", URL: srv.URL, Body: `"status":"ok"`},
+			parameters.ProbeParameters{Name: "missing", URL: srv.URL + "/missing"},
+			parameters.ProbeParameters{Name: "expected missing", URL: srv.URL + "/missing", Status: http.StatusNotFound},
+			parameters.ProbeParameters{Name: "body", URL: srv.URL, Body: "error"},
+		)
+
+		require.Equal(t, float64(1), m.Gauges["ProbeSuccess_ok"])
+		require.Equal(t, float64(200), m.Gauges["ProbeStatus_ok"])
+		require.Contains(t, m.Gauges, "ProbeLatency_ok")
+		require.Equal(t, int64(0), m.Counters["ProbeFailures_ok"])
+		require.NotContains(t, m.Gauges, "ProbeTLSExpiryDays_ok")
+
+		require.Equal(t, float64(0), m.Gauges["ProbeSuccess_missing"])
+		require.Equal(t, int64(1), m.Counters["ProbeFailures_missing"])
+		require.Equal(t, float64(1), m.Gauges["ProbeSuccess_expected_missing"])
+		require.Equal(t, float64(0), m.Gauges["ProbeSuccess_body"])
+	})
+
+	t.Run("https", func(t *testing.T) {
+		m := collect(t,
+			parameters.ProbeParameters{Name: "insecure", URL: tlsSrv.URL, Insecure: true},
+			parameters.ProbeParameters{Name: "verified", URL: tlsSrv.URL},
+		)
+
+		require.Equal(t, float64(1), m.Gauges["ProbeSuccess_insecure"])
+		require.Greater(t, m.Gauges["ProbeTLSExpiryDays_insecure"], float64(0))
+		require.Equal(t, float64(0), m.Gauges["ProbeSuccess_verified"], "certificate of test server isn't trusted")
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		m := collect(t,
+			parameters.ProbeParameters{Name: "open", Type: "tcp", Address: l.Addr().String()},
+			parameters.ProbeParameters{Name: "closed", Type: "tcp", Address: closedAddr},
+		)
+
+		require.Equal(t, float64(1), m.Gauges["ProbeSuccess_open"])
+		require.Equal(t, float64(0), m.Gauges["ProbeSuccess_closed"])
+		require.Equal(t, int64(1), m.Counters["ProbeFailures_closed"])
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(3 * time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer slow.Close()
+
+		start := time.Now()
+		m := collect(t, parameters.ProbeParameters{Name: "slow", URL: slow.URL, Timeout: 1})
+		require.Equal(t, float64(0), m.Gauges["ProbeSuccess_slow"])
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			probes []parameters.ProbeParameters
+		}{
+			{name: "empty"},
+			{name: "without name", probes: []parameters.ProbeParameters{{URL: srv.URL}}},
+			{name: "without url", probes: []parameters.ProbeParameters{{Name: "a"}}},
+			{name: "without address", probes: []parameters.ProbeParameters{{Name: "a", Type: "tcp"}}},
+			{name: "unknown type", probes: []parameters.ProbeParameters{{Name: "a", Type: "icmp", Address: "localhost"}}},
+			{name: "invalid body pattern", probes: []parameters.ProbeParameters{{Name: "a", URL: srv.URL, Body: "("}}},
+			{name: "duplicate name", probes: []parameters.ProbeParameters{{Name: "a", URL: srv.URL}, {Name: "a", URL: srv.URL}}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := newProbeCollector(parameters.AgentParameters{Probes: tt.probes})
+				require.Error(t, err)
+			})
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+)
+
+// newProcessCollector returns collector of per-process metrics, for example ProcessRSS_server.
+// Gauges are ProcessCount, ProcessRSS, ProcessOpenFDs and ProcessThreads,
+// counters are ProcessCPUTime in milliseconds, ProcessReadBytes and ProcessWriteBytes.
+// Values of all processes matched by the same entry are summed. Processes are resolved
+// on every collection, so restarted processes are picked up with their new PIDs.
+func newProcessCollector(p parameters.AgentParameters) (Collector, error) {
+	if len(p.Processes) == 0 {
+		return nil, fmt.Errorf("processes aren't set")
+	}
+
+	watches := make([]*processWatch, 0, len(p.Processes))
+	labels := make(map[string]bool, len(p.Processes))
+
+	for _, pp := range p.Processes {
+		w, err := newProcessWatch(pp)
+		if err != nil {
+			return nil, fmt.Errorf("process %s: %w", pp.Label, err)
+		}
+
+		if labels[w.label] {
+			return nil, fmt.Errorf("duplicate process label %s", pp.Label)
+		}
+
+		labels[w.label] = true
+		watches = append(watches, w)
+	}
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		m := NewMetrics()
+		l := &processList{}
+
+		for _, w := range watches {
+			procs, err := w.resolve(ctx, l)
+			if err != nil {
+				logger.Log.Warn("Resolve process", zap.String("label", w.params.Label), zap.Error(err))
+				continue
+			}
+
+			w.collect(ctx, m, procs)
+		}
+
+		return m, nil
+	}), nil
+}
+
+// processWatch keeps state of one configured process entry between collections
+type processWatch struct {
+	params  parameters.ProcessParameters
+	label   string
+	pattern *regexp.Regexp
+
+	prev      map[int32]processCounters
+	collected bool
+}
+
+type processCounters struct {
+	createTime int64
+	cpuTime    uint64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+func newProcessWatch(pp parameters.ProcessParameters) (*processWatch, error) {
+	if pp.Label == "" {
+		return nil, fmt.Errorf("label isn't set")
+	}
+
+	selectors := 0
+	for _, s := range []string{pp.PIDFile, pp.Name, pp.Pattern} {
+		if s != "" {
+			selectors++
+		}
+	}
+
+	if selectors != 1 {
+		return nil, fmt.Errorf("exactly one of pid_file, name or pattern must be set")
+	}
+
+	w := &processWatch{
+		params: pp,
+		label:  metricLabel(pp.Label),
+		prev:   make(map[int32]processCounters),
+	}
+
+	if pp.Pattern != "" {
+		re, err := regexp.Compile(pp.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile pattern: %w", err)
+		}
+
+		w.pattern = re
+	}
+
+	return w, nil
+}
+
+// resolve returns running processes matched by the watch.
+// Missing PID file or process means that nothing is running.
+func (w *processWatch) resolve(ctx context.Context, l *processList) ([]*process.Process, error) {
+	if w.params.PIDFile != "" {
+		data, err := os.ReadFile(w.params.PIDFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("read pid file: %w", err)
+		}
+
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse pid file: %w", err)
+		}
+
+		p, err := process.NewProcessWithContext(ctx, int32(pid))
+		if errors.Is(err, process.ErrorProcessNotRunning) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("get process %d: %w", pid, err)
+		}
+
+		return []*process.Process{p}, nil
+	}
+
+	all, err := l.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*process.Process
+
+	for _, p := range all {
+		if w.params.Name != "" {
+			if name, err := p.NameWithContext(ctx); err == nil && name == w.params.Name {
+				res = append(res, p)
+			}
+
+			continue
+		}
+
+		if cmdline, err := p.CmdlineWithContext(ctx); err == nil && w.pattern.MatchString(cmdline) {
+			res = append(res, p)
+		}
+	}
+
+	return res, nil
+}
+
+func (w *processWatch) collect(ctx context.Context, m Metrics, procs []*process.Process) {
+	cur := make(map[int32]processCounters, len(procs))
+
+	var (
+		count, rss, fds, threads    float64
+		cpuTime, readBytes, written int64
+		hasIncrements               bool
+	)
+
+	for _, p := range procs {
+		mem, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			// process has exited after resolving
+			continue
+		}
+
+		times, err := p.TimesWithContext(ctx)
+		if err != nil {
+			continue
+		}
+
+		c := processCounters{cpuTime: uint64((times.User + times.System) * 1000)}
+		c.createTime, _ = p.CreateTimeWithContext(ctx)
+
+		count++
+		rss += float64(mem.RSS)
+
+		if n, err := p.NumThreadsWithContext(ctx); err == nil {
+			threads += float64(n)
+		}
+
+		// open FDs and I/O counters aren't available for processes of other users without privileges
+		if n, err := p.NumFDsWithContext(ctx); err == nil {
+			fds += float64(n)
+		}
+
+		if io, err := p.IOCountersWithContext(ctx); err == nil {
+			c.readBytes, c.writeBytes = io.ReadBytes, io.WriteBytes
+		}
+
+		cur[p.Pid] = c
+
+		prev, ok := w.prev[p.Pid]
+		if !ok || prev.createTime != c.createTime {
+			// processes running on the first collection give no increments,
+			// processes appeared later (restarted or reused PID) are counted from zero
+			if !w.collected {
+				continue
+			}
+
+			prev = processCounters{}
+		}
+
+		hasIncrements = true
+		cpuTime += increment(prev.cpuTime, c.cpuTime)
+		readBytes += increment(prev.readBytes, c.readBytes)
+		written += increment(prev.writeBytes, c.writeBytes)
+	}
+
+	w.prev = cur
+	w.collected = true
+
+	m.Gauges["ProcessCount_"+w.label] = count
+	if count == 0 {
+		return
+	}
+
+	m.Gauges["ProcessRSS_"+w.label] = rss
+	m.Gauges["ProcessOpenFDs_"+w.label] = fds
+	m.Gauges["ProcessThreads_"+w.label] = threads
+
+	if hasIncrements {
+		m.Counters["ProcessCPUTime_"+w.label] += cpuTime
+		m.Counters["ProcessReadBytes_"+w.label] += readBytes
+		m.Counters["ProcessWriteBytes_"+w.label] += written
+	}
+}
+
+// processList lists running processes at most once per collection
+type processList struct {
+	procs []*process.Process
+	err   error
+	done  bool
+}
+
+func (l *processList) get(ctx context.Context) ([]*process.Process, error) {
+	if !l.done {
+		l.procs, l.err = process.ProcessesWithContext(ctx)
+		l.done = true
+	}
+
+	if l.err != nil {
+		return nil, fmt.Errorf("list processes: %w", l.err)
+	}
+
+	return l.procs, nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	self, err := process.NewProcess(int32(os.Getpid()))
+	require.NoError(t, err)
+
+	selfName, err := self.Name()
+	require.NoError(t, err)
+
+	collect := func(t *testing.T, c Collector) Metrics {
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		return m
+	}
+
+	t.Run("pid file", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "agent.pid")
+		require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600))
+
+		c, err := newProcessCollector(parameters.AgentParameters{
+			Processes: []parameters.ProcessParameters{{Label: "agent-test", PIDFile: pidFile}},
+		})
+		require.NoError(t, err)
+
+		m := collect(t, c)
+		require.Equal(t, float64(1), m.Gauges["ProcessCount_agent_test"])
+		require.Greater(t, m.Gauges["ProcessRSS_agent_test"], float64(0))
+		require.Greater(t, m.Gauges["ProcessThreads_agent_test"], float64(0))
+		require.Greater(t, m.Gauges["ProcessOpenFDs_agent_test"], float64(0))
+		require.Empty(t, m.Counters, "first observation gives no increments")
+
+		m = collect(t, c)
+		require.Contains(t, m.Counters, "ProcessCPUTime_agent_test")
+		require.Contains(t, m.Counters, "ProcessReadBytes_agent_test")
+		require.Contains(t, m.Counters, "ProcessWriteBytes_agent_test")
+	})
+
+	t.Run("name and pattern", func(t *testing.T) {
+		c, err := newProcessCollector(parameters.AgentParameters{
+			Processes: []parameters.ProcessParameters{
+				{Label: "by_name", Name: selfName},
+				{Label: "by_pattern", Pattern: `agent\.test`},
+				{Label: "missing", Name: "surely-not-running-process"},
+			},
+		})
+		require.NoError(t, err)
+
+		m := collect(t, c)
+		require.GreaterOrEqual(t, m.Gauges["ProcessCount_by_name"], float64(1))
+		require.GreaterOrEqual(t, m.Gauges["ProcessCount_by_pattern"], float64(1))
+		require.Equal(t, float64(0), m.Gauges["ProcessCount_missing"])
+		require.NotContains(t, m.Gauges, "ProcessRSS_missing")
+	})
+
+	t.Run("restarted process", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "sleep.pid")
+
+		c, err := newProcessCollector(parameters.AgentParameters{
+			Processes: []parameters.ProcessParameters{{Label: "sleep", PIDFile: pidFile}},
+		})
+		require.NoError(t, err)
+
+		m := collect(t, c)
+		require.Equal(t, float64(0), m.Gauges["ProcessCount_sleep"])
+
+		cmd := exec.Command("sleep", "10")
+		require.NoError(t, cmd.Start())
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+
+		require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0o600))
+
+		m = collect(t, c)
+		require.Equal(t, float64(1), m.Gauges["ProcessCount_sleep"])
+		require.Contains(t, m.Counters, "ProcessCPUTime_sleep", "process appeared after first collection is counted from zero")
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			processes []parameters.ProcessParameters
+		}{
+			{name: "empty"},
+			{name: "without label", processes: []parameters.ProcessParameters{{Name: "test"}}},
+			{name: "without selector", processes: []parameters.ProcessParameters{{Label: "test"}}},
+			{name: "several selectors", processes: []parameters.ProcessParameters{{Label: "test", Name: "test", Pattern: "test"}}},
+			{name: "invalid pattern", processes: []parameters.ProcessParameters{{Label: "test", Pattern: "("}}},
+			{name: "duplicate label", processes: []parameters.ProcessParameters{{Label: "a-b", Name: "a"}, {Label: "a_b", Name: "b"}}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := newProcessCollector(parameters.AgentParameters{Processes: tt.processes})
+				require.Error(t, err)
+			})
+		}
+	})
+}
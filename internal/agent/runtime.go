@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+)
+
+// DefaultRuntimeQuantiles contains quantiles of histograms reported when parameters don't contain any
+var DefaultRuntimeQuantiles = []float64{0.5, 0.9, 0.99}
+
+// newRuntimeCollector returns collector of all metrics supported by runtime/metrics.
+// Unlike memstats collector it doesn't stop the world. Names are converted to our convention,
+// for example /sched/goroutines:goroutines is RuntimeSchedGoroutines and /gc/heap/allocs:bytes is RuntimeGcHeapAllocsBytes.
+// Cumulative values become counters, other values become gauges.
+// Histograms become gauges of quantiles like RuntimeSchedLatenciesSeconds_p99,
+// cumulative histograms are calculated over observations since the previous collection.
+func newRuntimeCollector(p parameters.AgentParameters) (Collector, error) {
+	quantiles := p.RuntimeQuantiles
+	if len(quantiles) == 0 {
+		quantiles = DefaultRuntimeQuantiles
+	}
+
+	for _, q := range quantiles {
+		if q < 0 || q > 1 || math.IsNaN(q) {
+			return nil, fmt.Errorf("invalid runtime quantile %v, want value from 0 to 1", q)
+		}
+	}
+
+	descs := metrics.All()
+	samples := make([]metrics.Sample, 0, len(descs))
+	cumulative := make(map[string]bool, len(descs))
+	names := make(map[string]string, len(descs))
+
+	for _, d := range descs {
+		if d.Kind == metrics.KindBad {
+			continue
+		}
+
+		samples = append(samples, metrics.Sample{Name: d.Name})
+		cumulative[d.Name] = d.Cumulative
+		names[d.Name] = runtimeMetricName(d.Name)
+	}
+
+	counters := newDeltas()
+	floatCounters := newFloatDeltas()
+	histograms := make(map[string][]uint64)
+
+	return CollectorFunc(func(context.Context) (Metrics, error) {
+		metrics.Read(samples)
+
+		m := NewMetrics()
+
+		for _, s := range samples {
+			name := names[s.Name]
+
+			switch s.Value.Kind() {
+			case metrics.KindUint64:
+				if cumulative[s.Name] {
+					counters.add(m, name, s.Value.Uint64())
+				} else {
+					m.Gauges[name] = float64(s.Value.Uint64())
+				}
+			case metrics.KindFloat64:
+				if cumulative[s.Name] {
+					floatCounters.add(m, s.Name, name, s.Value.Float64())
+				} else {
+					m.Gauges[name] = s.Value.Float64()
+				}
+			case metrics.KindFloat64Histogram:
+				h := s.Value.Float64Histogram()
+				counts := h.Counts
+
+				if cumulative[s.Name] {
+					counts = histogramDelta(histograms[s.Name], h.Counts)
+					histograms[s.Name] = append(histograms[s.Name][:0], h.Counts...)
+				}
+
+				for _, q := range quantiles {
+					if v, ok := histogramQuantile(counts, h.Buckets, q); ok {
+						m.Gauges[name+"_"+quantileSuffix(q)] = v
+					}
+				}
+			}
+		}
+
+		return m, nil
+	}), nil
+}
+
+// runtimeMetricName converts name of runtime metric to CamelCase with unit,
+// unit isn't repeated if the name already ends with it
+func runtimeMetricName(name string) string {
+	path, unit, _ := strings.Cut(name, ":")
+
+	base := "Runtime" + camelCase(path)
+	if u := camelCase(unit); !strings.HasSuffix(base, u) {
+		base += u
+	}
+
+	return base
+}
+
+func camelCase(s string) string {
+	var b strings.Builder
+
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]))
+		b.WriteString(part[1:])
+	}
+
+	return b.String()
+}
+
+// quantileSuffix returns suffix of quantile gauge, for example p99 for 0.99 and p99_9 for 0.999
+func quantileSuffix(q float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(q*100, 'f', -1, 64), ".", "_")
+}
+
+// histogramDelta returns counts observed since prev, all counts are returned if buckets are changed
+func histogramDelta(prev, cur []uint64) []uint64 {
+	if len(prev) != len(cur) {
+		return cur
+	}
+
+	res := make([]uint64, len(cur))
+	for i := range cur {
+		res[i] = uint64(increment(prev[i], cur[i]))
+	}
+
+	return res
+}
+
+// histogramQuantile returns quantile q of histogram interpolating linearly inside the bucket,
+// false means that histogram is empty. Infinite bounds of bucket are replaced with the finite one.
+func histogramQuantile(counts []uint64, buckets []float64, q float64) (float64, bool) {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := q * float64(total)
+
+	var cum float64
+
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+
+		if cum+float64(c) < rank {
+			cum += float64(c)
+			continue
+		}
+
+		lower, upper := buckets[i], buckets[i+1]
+
+		switch {
+		case math.IsInf(lower, -1):
+			return upper, true
+		case math.IsInf(upper, 1):
+			return lower, true
+		}
+
+		frac := min(max((rank-cum)/float64(c), 0), 1)
+
+		return lower + (upper-lower)*frac, true
+	}
+
+	return 0, false
+}
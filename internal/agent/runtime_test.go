@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_runtimeMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "/sched/goroutines:goroutines", want: "RuntimeSchedGoroutines"},
+		{name: "/gc/heap/allocs:bytes", want: "RuntimeGcHeapAllocsBytes"},
+		{name: "/cpu/classes/gc/mark/assist:cpu-seconds", want: "RuntimeCpuClassesGcMarkAssistCpuSeconds"},
+		{name: "/godebug/non-default-behavior/http2client:events", want: "RuntimeGodebugNonDefaultBehaviorHttp2clientEvents"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, runtimeMetricName(tt.name))
+		})
+	}
+}
+
+func Test_histogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 0, 10, 20, math.Inf(1)}
+
+	tests := []struct {
+		name   string
+		counts []uint64
+		q      float64
+		want   float64
+		wantOk bool
+	}{
+		{name: "empty", counts: []uint64{0, 0, 0, 0}, q: 0.5},
+		{name: "interpolation", counts: []uint64{0, 4, 4, 0}, q: 0.75, want: 15, wantOk: true},
+		{name: "upper bound", counts: []uint64{0, 4, 4, 0}, q: 1, want: 20, wantOk: true},
+		{name: "infinite upper bound", counts: []uint64{0, 0, 0, 2}, q: 0.99, want: 20, wantOk: true},
+		{name: "infinite lower bound", counts: []uint64{2, 0, 0, 0}, q: 0.5, want: 0, wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := histogramQuantile(tt.counts, buckets, tt.q)
+			require.Equal(t, tt.wantOk, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	require.Equal(t, "p99_9", quantileSuffix(0.999))
+	require.Equal(t, []uint64{1, 0, 2}, histogramDelta([]uint64{1, 2, 3}, []uint64{2, 2, 5}))
+}
+
+var runtimeTestSink []byte
+
+func TestRuntimeCollector(t *testing.T) {
+	c, err := newRuntimeCollector(parameters.AgentParameters{RuntimeQuantiles: []float64{0.5, 0.99}})
+	require.NoError(t, err)
+
+	m, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, m.Gauges["RuntimeSchedGoroutines"], float64(0))
+	require.Contains(t, m.Gauges, "RuntimeMemoryClassesTotalBytes")
+	require.Empty(t, m.Counters, "first collection gives no increments")
+
+	runtimeTestSink = make([]byte, 1<<20)
+
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, m.Counters["RuntimeGcHeapAllocsBytes"], int64(0))
+
+	_, err = newRuntimeCollector(parameters.AgentParameters{RuntimeQuantiles: []float64{1.5}})
+	require.Error(t, err)
+}
@@ -0,0 +1,439 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultScrapeTimeout = 5 * time.Second
+	maxScrapeBody        = 10 << 20
+)
+
+// newScrapeCollector returns collector of metrics scraped from Prometheus endpoints.
+// Names of series contain their labels, for example http_requests_total{code="200"} is http_requests_total_code_200.
+// Prometheus counters, histogram buckets and sums become increments between scrapes, other series become gauges.
+// Every target also gets gauges ScrapeUp_<name> and ScrapeDuration_<name> in seconds.
+func newScrapeCollector(p parameters.AgentParameters) (Collector, error) {
+	if len(p.Scrape) == 0 {
+		return nil, fmt.Errorf("scrape targets aren't set")
+	}
+
+	client := resty.New()
+	targets := make([]*scrapeTarget, 0, len(p.Scrape))
+	names := make(map[string]bool, len(p.Scrape))
+
+	for _, sp := range p.Scrape {
+		t, err := newScrapeTarget(sp, client)
+		if err != nil {
+			return nil, fmt.Errorf("scrape target %s: %w", sp.Name, err)
+		}
+
+		if names[t.label] {
+			return nil, fmt.Errorf("duplicate scrape target name %s", sp.Name)
+		}
+
+		names[t.label] = true
+		targets = append(targets, t)
+	}
+
+	return CollectorFunc(func(ctx context.Context) (Metrics, error) {
+		var (
+			res = NewMetrics()
+			mu  sync.Mutex
+			wg  sync.WaitGroup
+		)
+
+		for _, t := range targets {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				start := time.Now()
+				m, err := t.scrape(ctx)
+				duration := time.Since(start).Seconds()
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				res.Gauges["ScrapeDuration_"+t.label] = duration
+
+				if err != nil {
+					logger.Log.Warn("Scrape target", zap.String("target", t.params.Name), zap.Error(err))
+					res.Gauges["ScrapeUp_"+t.label] = 0
+					return
+				}
+
+				res.Gauges["ScrapeUp_"+t.label] = 1
+				maps.Copy(res.Gauges, m.Gauges)
+
+				for name, delta := range m.Counters {
+					res.Counters[name] += delta
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		return res, nil
+	}), nil
+}
+
+type relabelRule struct {
+	re          *regexp.Regexp
+	replacement string
+	drop        bool
+}
+
+type scrapeTarget struct {
+	params  parameters.ScrapeParameters
+	label   string
+	timeout time.Duration
+	relabel []relabelRule
+	deltas  *floatDeltas
+	client  *resty.Client
+}
+
+func newScrapeTarget(sp parameters.ScrapeParameters, client *resty.Client) (*scrapeTarget, error) {
+	if sp.Name == "" {
+		return nil, fmt.Errorf("name isn't set")
+	}
+
+	if sp.URL == "" {
+		return nil, fmt.Errorf("url isn't set")
+	}
+
+	t := &scrapeTarget{
+		params:  sp,
+		label:   metricLabel(sp.Name),
+		timeout: defaultScrapeTimeout,
+		deltas:  newFloatDeltas(),
+		client:  client,
+	}
+
+	if sp.Timeout != 0 {
+		t.timeout = time.Duration(sp.Timeout) * time.Second
+	}
+
+	for _, r := range sp.Relabel {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile relabel pattern: %w", err)
+		}
+
+		t.relabel = append(t.relabel, relabelRule{re: re, replacement: r.Replacement, drop: r.Drop})
+	}
+
+	return t, nil
+}
+
+func (t *scrapeTarget) scrape(ctx context.Context) (Metrics, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	resp, err := t.client.R().
+		SetContext(ctx).
+		SetHeader("Accept", "text/plain").
+		SetDoNotParseResponse(true).
+		Get(t.params.URL)
+	if err != nil {
+		return Metrics{}, fmt.Errorf("get %s: %w", t.params.URL, err)
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.StatusCode() != http.StatusOK {
+		return Metrics{}, fmt.Errorf("get %s: unexpected status %s", t.params.URL, resp.Status())
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxScrapeBody))
+	if err != nil {
+		return Metrics{}, fmt.Errorf("read %s: %w", t.params.URL, err)
+	}
+
+	samples, err := parseExposition(string(data))
+	if err != nil {
+		return Metrics{}, fmt.Errorf("parse %s: %w", t.params.URL, err)
+	}
+
+	m := NewMetrics()
+	seen := make(map[string]bool, len(samples))
+
+	for _, s := range samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+
+		name, ok := t.rename(s.name)
+		if !ok {
+			continue
+		}
+
+		if !s.counter {
+			m.Gauges[name] = s.value
+			continue
+		}
+
+		seen[s.name] = true
+		t.deltas.add(m, s.name, name, s.value)
+	}
+
+	t.deltas.retain(seen)
+
+	return m, nil
+}
+
+// rename applies relabel rules and prefix to series name, false means that series is dropped
+func (t *scrapeTarget) rename(name string) (string, bool) {
+	for _, r := range t.relabel {
+		if !r.re.MatchString(name) {
+			continue
+		}
+
+		if r.drop {
+			return "", false
+		}
+
+		name = r.re.ReplaceAllString(name, r.replacement)
+	}
+
+	if name == "" {
+		return "", false
+	}
+
+	return t.params.Prefix + name, true
+}
+
+// floatDeltas converts cumulative float counters of Prometheus into integer increments.
+// Fractional parts of increments are carried over to the next scrapes.
+type floatDeltas struct {
+	prev map[string]float64
+	rest map[string]float64
+}
+
+func newFloatDeltas() *floatDeltas {
+	return &floatDeltas{prev: make(map[string]float64), rest: make(map[string]float64)}
+}
+
+func (d *floatDeltas) add(m Metrics, key, name string, value float64) {
+	prev, ok := d.prev[key]
+	d.prev[key] = value
+
+	if !ok {
+		return
+	}
+
+	inc := value - prev
+	if value < prev {
+		inc = value
+	}
+
+	inc += d.rest[key]
+	whole := math.Floor(inc)
+	d.rest[key] = inc - whole
+
+	m.Counters[name] += int64(whole)
+}
+
+// retain forgets series which are absent in the last scrape
+func (d *floatDeltas) retain(seen map[string]bool) {
+	for key := range d.prev {
+		if !seen[key] {
+			delete(d.prev, key)
+			delete(d.rest, key)
+		}
+	}
+}
+
+type sample struct {
+	name    string
+	value   float64
+	counter bool
+}
+
+// parseExposition parses Prometheus text exposition format
+func parseExposition(data string) ([]sample, error) {
+	types := make(map[string]string)
+
+	var samples []sample
+
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+
+			continue
+		}
+
+		s, err := parseSample(line, types)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		samples = append(samples, s)
+	}
+
+	return samples, nil
+}
+
+func parseSample(line string, types map[string]string) (sample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample{}, fmt.Errorf("invalid sample %q", line)
+	}
+
+	name, rest := line[:end], line[end:]
+
+	var labels [][2]string
+
+	if rest[0] == '{' {
+		var err error
+
+		labels, rest, err = parseLabels(rest[1:])
+		if err != nil {
+			return sample{}, fmt.Errorf("invalid labels of %s: %w", name, err)
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample{}, fmt.Errorf("invalid value of %s", name)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample{}, fmt.Errorf("invalid value of %s: %w", name, err)
+	}
+
+	return sample{
+		name:    seriesName(name, labels),
+		value:   value,
+		counter: isCounterSample(name, types),
+	}, nil
+}
+
+// parseLabels parses labels after '{' and returns rest of line after '}'
+func parseLabels(s string) ([][2]string, string, error) {
+	var labels [][2]string
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated labels")
+		}
+
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("invalid label %q", s)
+		}
+
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var (
+			value   strings.Builder
+			escaped bool
+			closed  = -1
+		)
+
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+
+			switch {
+			case escaped:
+				if c == 'n' {
+					c = '\n'
+				}
+
+				value.WriteByte(c)
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				closed = i
+			default:
+				value.WriteByte(c)
+			}
+
+			if closed >= 0 {
+				break
+			}
+		}
+
+		if closed < 0 {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+
+		labels = append(labels, [2]string{name, value.String()})
+		s = s[closed+1:]
+	}
+}
+
+// seriesName returns name of series with sorted labels, for example http_requests_total_code_200_method_get
+func seriesName(name string, labels [][2]string) string {
+	slices.SortFunc(labels, func(a, b [2]string) int { return strings.Compare(a[0], b[0]) })
+
+	parts := []string{name}
+	for _, l := range labels {
+		parts = append(parts, l[0], l[1])
+	}
+
+	for i, part := range parts {
+		parts[i] = strings.Trim(invalidNameChars.ReplaceAllString(part, "_"), "_")
+	}
+
+	return strings.Join(slices.DeleteFunc(parts, func(part string) bool { return part == "" }), "_")
+}
+
+// isCounterSample returns true for samples of counters and cumulative parts of histograms and summaries
+func isCounterSample(name string, types map[string]string) bool {
+	if t, ok := types[name]; ok {
+		return t == "counter"
+	}
+
+	for _, suffix := range []string{"_total", "_bucket", "_sum", "_count"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+
+		switch types[family] {
+		case "counter":
+			return suffix == "_total"
+		case "histogram":
+			return suffix != "_total"
+		case "summary":
+			return suffix == "_sum" || suffix == "_count"
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseExposition(t *testing.T) {
+	data := `# HELP http_requests_total Count of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 10
+http_requests_total{code="500",method="get"} 2 1712345678000
+# TYPE temperature gauge
+temperature 36.6
+# TYPE latency histogram
+latency_bucket{le="0.5"} 3
+latency_bucket{le="+Inf"} 4
+latency_sum 1.5
+latency_count 4
+# TYPE rpc summary
+rpc{quantile="0.99"} 0.2
+rpc_count 7
+untyped_value{path="C:\\dir \"a\""} 1
+`
+
+	samples, err := parseExposition(data)
+	require.NoError(t, err)
+	require.Equal(t, []sample{
+		{name: "http_requests_total_code_200_method_get", value: 10, counter: true},
+		{name: "http_requests_total_code_500_method_get", value: 2, counter: true},
+		{name: "temperature", value: 36.6},
+		{name: "latency_bucket_le_0_5", value: 3, counter: true},
+		{name: "latency_bucket_le_Inf", value: 4, counter: true},
+		{name: "latency_sum", value: 1.5, counter: true},
+		{name: "latency_count", value: 4, counter: true},
+		{name: "rpc_quantile_0_99", value: 0.2},
+		{name: "rpc_count", value: 7, counter: true},
+		{name: "untyped_value_path_C_dir_a", value: 1},
+	}, samples)
+
+	for _, invalid := range []string{"metric", "metric{a=\"b} 1", "metric{a=b} 1", "metric one", "metric 1 2 3"} {
+		_, err := parseExposition(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestScrapeCollector(t *testing.T) {
+	var requests atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		fmt.Fprintf(w, "# TYPE requests_total counter\nrequests_total %d\n", n*10)
+		fmt.Fprintf(w, "# TYPE cpu_seconds_total counter\ncpu_seconds_total %f\n", float64(n)*0.6)
+		fmt.Fprint(w, "# TYPE temperature gauge\ntemperature 36.6\n")
+		fmt.Fprint(w, "# TYPE go_goroutines gauge\ngo_goroutines 5\n")
+	}))
+	defer srv.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	c, err := newScrapeCollector(parameters.AgentParameters{Scrape: []parameters.ScrapeParameters{
+		{
+			Name:   "app",
+			URL:    srv.URL,
+			Prefix: "app_",
+			Relabel: []parameters.RelabelParameters{
+				{Pattern: "^go_", Drop: true},
+				{Pattern: "^(.*)_total$", Replacement: "${1}"},
+			},
+		},
+		{Name: "broken", URL: broken.URL},
+	}})
+	require.NoError(t, err)
+
+	m, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, float64(1), m.Gauges["ScrapeUp_app"])
+	require.Equal(t, float64(0), m.Gauges["ScrapeUp_broken"])
+	require.Contains(t, m.Gauges, "ScrapeDuration_app")
+	require.Equal(t, 36.6, m.Gauges["app_temperature"])
+	require.NotContains(t, m.Gauges, "app_go_goroutines")
+	require.Empty(t, m.Counters, "first scrape gives no increments")
+
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(10), m.Counters["app_requests"])
+	require.Equal(t, int64(0), m.Counters["app_cpu_seconds"])
+
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), m.Counters["app_cpu_seconds"], "fractional increments are carried over")
+
+	t.Run("timeout", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(3 * time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer slow.Close()
+
+		c, err := newScrapeCollector(parameters.AgentParameters{Scrape: []parameters.ScrapeParameters{
+			{Name: "slow", URL: slow.URL, Timeout: 1},
+		}})
+		require.NoError(t, err)
+
+		start := time.Now()
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, float64(0), m.Gauges["ScrapeUp_slow"])
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			targets []parameters.ScrapeParameters
+		}{
+			{name: "empty"},
+			{name: "without name", targets: []parameters.ScrapeParameters{{URL: srv.URL}}},
+			{name: "without url", targets: []parameters.ScrapeParameters{{Name: "app"}}},
+			{name: "invalid pattern", targets: []parameters.ScrapeParameters{
+				{Name: "app", URL: srv.URL, Relabel: []parameters.RelabelParameters{{Pattern: "("}}},
+			}},
+			{name: "duplicate name", targets: []parameters.ScrapeParameters{{Name: "app", URL: srv.URL}, {Name: "app", URL: srv.URL}}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := newScrapeCollector(parameters.AgentParameters{Scrape: tt.targets})
+				require.Error(t, err)
+			})
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Package agentconfig defines configs of agents which are managed on the server.
+// The server serves config documents by instance or group of agent,
+// agents poll them and restart their work with new parameters.
+package agentconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+)
+
+// Agent config errors
+var (
+	ErrNotFound    = errors.New("agent config isn't found")
+	ErrNotModified = errors.New("agent config isn't modified")
+)
+
+// localOnly fields can't be managed by the server: identity, credentials and polling of agent,
+// commands executed by agent, files read or written by agent, local endpoints
+// and spool which is shared by restarted agents.
+// Paths of logs and pid files of processes are checked separately, so the server can change rules of them.
+var localOnly = []string{
+	"instance", "group", "tenant", "token", "hash_key", "crypto_key", "config_poll_interval", "exec",
+	"output_file", "record_file", "log_state_file", "push_http_address", "spool_dir", "spool_max_size", "spool_max_age",
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]{0,127}$`)
+
+// Document it's versioned config of agent, Config contains fields of agent's config file
+type Document struct {
+	Version string          `json:"version"`
+	Config  json.RawMessage `json:"config,omitempty" swaggertype:"object"`
+}
+
+// Store reads config documents from directory.
+// Config of agent is agents/<instance>.json, config of group is groups/<group>.json
+// and default config is default.json, the first existing one is served.
+type Store struct {
+	dir string
+}
+
+// NewStore create Store
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Get returns config document of agent, version is hash of the config
+func (s *Store) Get(instance, group string) (Document, error) {
+	var paths []string
+
+	if validName.MatchString(instance) {
+		paths = append(paths, filepath.Join(s.dir, "agents", instance+".json"))
+	}
+
+	if validName.MatchString(group) {
+		paths = append(paths, filepath.Join(s.dir, "groups", group+".json"))
+	}
+
+	paths = append(paths, filepath.Join(s.dir, "default.json"))
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return Document{}, fmt.Errorf("read agent config: %w", err)
+		}
+
+		data = bytes.TrimSpace(data)
+		if !json.Valid(data) {
+			return Document{}, fmt.Errorf("agent config %s isn't valid json", path)
+		}
+
+		sum := sha256.Sum256(data)
+
+		return Document{Version: hex.EncodeToString(sum[:8]), Config: data}, nil
+	}
+
+	return Document{}, ErrNotFound
+}
+
+// Apply returns base parameters overridden by top level fields of the config document,
+// so lists like rules or probes are replaced as a whole.
+// Unknown or local only fields, empty address and zero intervals make the document invalid.
+func Apply(base parameters.AgentParameters, d Document) (parameters.AgentParameters, error) {
+	dec := json.NewDecoder(bytes.NewReader(d.Config))
+	dec.DisallowUnknownFields()
+
+	var check parameters.AgentParameters
+	if err := dec.Decode(&check); err != nil {
+		return base, fmt.Errorf("decode agent config %s: %w", d.Version, err)
+	}
+
+	data, err := json.Marshal(base)
+	if err != nil {
+		return base, fmt.Errorf("marshal base parameters: %w", err)
+	}
+
+	var fields, override map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return base, fmt.Errorf("unmarshal base parameters: %w", err)
+	}
+
+	if err := json.Unmarshal(d.Config, &override); err != nil {
+		return base, fmt.Errorf("decode agent config %s: %w", d.Version, err)
+	}
+
+	for _, name := range localOnly {
+		if _, ok := override[name]; ok {
+			return base, fmt.Errorf("agent config %s: field %s can be set only locally", d.Version, name)
+		}
+	}
+
+	maps.Copy(fields, override)
+
+	if data, err = json.Marshal(fields); err != nil {
+		return base, fmt.Errorf("marshal agent config %s: %w", d.Version, err)
+	}
+
+	var p parameters.AgentParameters
+	if err := json.Unmarshal(data, &p); err != nil {
+		return base, fmt.Errorf("apply agent config %s: %w", d.Version, err)
+	}
+
+	if p.ListenAddr == "" {
+		return base, fmt.Errorf("agent config %s: address isn't set", d.Version)
+	}
+
+	if err := checkPaths(base, p); err != nil {
+		return base, fmt.Errorf("agent config %s: %w", d.Version, err)
+	}
+
+	if p.ReportInterval == 0 || p.PollInterval == 0 {
+		return base, fmt.Errorf("agent config %s: intervals must be positive", d.Version)
+	}
+
+	return p, nil
+}
+
+// checkPaths checks that logs and pid files of processes are configured locally
+func checkPaths(base, p parameters.AgentParameters) error {
+	paths := make(map[string]bool)
+	for _, l := range base.Logs {
+		paths[l.Path] = true
+	}
+
+	for _, l := range p.Logs {
+		if !paths[l.Path] {
+			return fmt.Errorf("log %s can be set only locally", l.Path)
+		}
+	}
+
+	pidFiles := make(map[string]bool)
+	for _, pp := range base.Processes {
+		pidFiles[pp.PIDFile] = true
+	}
+
+	for _, pp := range p.Processes {
+		if pp.PIDFile != "" && !pidFiles[pp.PIDFile] {
+			return fmt.Errorf("pid file %s can be set only locally", pp.PIDFile)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package agentconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Get(t *testing.T) {
+	s := NewStore("./testdata/configs")
+
+	tests := []struct {
+		name, instance, group string
+		want                  string
+	}{
+		{name: "agent config", instance: "agent-1", group: "prod", want: "localhost:9090"},
+		{name: "group config", instance: "agent-2", group: "prod", want: "prod_"},
+		{name: "default config", instance: "agent-2", group: "dev", want: `"report_interval": 20`},
+		{name: "invalid names", instance: "../configs/agents/agent-1", group: "../default", want: `"report_interval": 20`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := s.Get(tt.instance, tt.group)
+			require.NoError(t, err)
+			require.Contains(t, string(d.Config), tt.want)
+			require.Len(t, d.Version, 16)
+
+			again, err := s.Get(tt.instance, tt.group)
+			require.NoError(t, err)
+			require.Equal(t, d, again, "version doesn't change without changing config")
+		})
+	}
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := s.Get("", "broken")
+		require.Error(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := NewStore(t.TempDir()).Get("agent-1", "prod")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestApply(t *testing.T) {
+	base := parameters.AgentParameters{
+		ListenAddr:     "localhost:8080",
+		ReportInterval: 10,
+		PollInterval:   2,
+		Group:          "prod",
+		Rules:          []parameters.MetricRuleParameters{{Action: "deny", Pattern: "^Random"}},
+		Logs:           []parameters.LogParameters{{Path: "/var/log/app.log"}},
+		Processes:      []parameters.ProcessParameters{{Label: "app", PIDFile: "/run/app.pid"}},
+	}
+
+	t.Run("override", func(t *testing.T) {
+		p, err := Apply(base, Document{Version: "1", Config: json.RawMessage(`{
+			"address": "localhost:9090",
+			"report_interval": 30,
+			"rules": [{"action": "prefix", "prefix": "prod_"}]
+		}`)})
+		require.NoError(t, err)
+
+		want := base
+		want.ListenAddr = "localhost:9090"
+		want.ReportInterval = 30
+		want.Rules = []parameters.MetricRuleParameters{{Action: "prefix", Prefix: "prod_"}}
+		require.Equal(t, want, p, "lists are replaced as a whole")
+
+		require.Equal(t, "^Random", base.Rules[0].Pattern, "base isn't changed")
+	})
+
+	t.Run("rules of local paths", func(t *testing.T) {
+		p, err := Apply(base, Document{Version: "1", Config: json.RawMessage(`{
+			"logs": [{"path": "/var/log/app.log", "rules": [{"name": "errors", "pattern": "ERROR"}]}],
+			"processes": [{"label": "app", "pid_file": "/run/app.pid"}, {"label": "sshd", "name": "sshd"}]
+		}`)})
+		require.NoError(t, err)
+		require.Len(t, p.Logs[0].Rules, 1)
+		require.Len(t, p.Processes, 2)
+	})
+
+	tests := []struct {
+		name, config string
+	}{
+		{name: "invalid json", config: `{"report_interval": "10"}`},
+		{name: "unknown field", config: `{"report": 10}`},
+		{name: "local only field", config: `{"exec": [{"name": "sh", "command": ["sh"]}]}`},
+		{name: "log state file", config: `{"log_state_file": "/tmp/state"}`},
+		{name: "hash key", config: `{"hash_key": "key"}`},
+		{name: "crypto key", config: `{"crypto_key": "/tmp/key.pem"}`},
+		{name: "token", config: `{"token": "token"}`},
+		{name: "tenant", config: `{"tenant": "other"}`},
+		{name: "push address", config: `{"push_http_address": "0.0.0.0:8125"}`},
+		{name: "log path", config: `{"logs": [{"path": "/etc/shadow"}]}`},
+		{name: "pid file", config: `{"processes": [{"label": "app", "pid_file": "/tmp/other.pid"}]}`},
+		{name: "zero interval", config: `{"poll_interval": 0}`},
+		{name: "empty address", config: `{"address": ""}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Apply(base, Document{Version: "2", Config: json.RawMessage(tt.config)})
+			require.Error(t, err)
+			require.Equal(t, base, p)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package agentconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DarkOmap/metricsService/internal/auth"
+	"github.com/DarkOmap/metricsService/internal/identity"
+	"github.com/DarkOmap/metricsService/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Getter describes getting config of agent
+type Getter interface {
+	Get(instance, group string) (Document, error)
+}
+
+type grpcServer struct {
+	proto.UnimplementedAgentConfigsServer
+	configs Getter
+}
+
+// RegisterServer registers the grpc service returning configs of agents
+func RegisterServer(s grpc.ServiceRegistrar, configs Getter) {
+	proto.RegisterAgentConfigsServer(s, &grpcServer{configs: configs})
+}
+
+// AgentConfig returns config of agent from the request context
+func (s *grpcServer) AgentConfig(ctx context.Context, in *proto.AgentConfigRequest) (*proto.AgentConfigResponse, error) {
+	if err := auth.Check(ctx, auth.ScopeWrite); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	id, _ := identity.FromContext(ctx)
+
+	d, err := s.configs.Get(id.Instance, in.GetGroup())
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &proto.AgentConfigResponse{Version: d.Version}
+
+	// the applied config isn't sent again
+	if d.Version != in.GetVersion() {
+		resp.Config = d.Config
+	}
+
+	return resp, nil
+}
+
+// GetGRPC requests config of agent by grpc connection.
+// It returns ErrNotFound if the server hasn't config for agent and ErrNotModified if version isn't changed.
+func GetGRPC(ctx context.Context, cc grpc.ClientConnInterface, group, version string) (Document, error) {
+	resp, err := proto.NewAgentConfigsClient(cc).AgentConfig(ctx, &proto.AgentConfigRequest{Group: group, Version: version})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return Document{}, ErrNotFound
+		}
+
+		return Document{}, fmt.Errorf("get agent config: %w", err)
+	}
+
+	d := Document{Version: resp.GetVersion(), Config: resp.GetConfig()}
+
+	if d.Version == version && len(d.Config) == 0 {
+		return d, ErrNotModified
+	}
+
+	return d, nil
+}
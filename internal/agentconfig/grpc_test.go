@@ -0,0 +1,68 @@
+package agentconfig
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/identity"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestGetGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(identity.InterceptorIdentity))
+	RegisterServer(s, NewStore("./testdata/configs"))
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			require.FailNow(t, err.Error())
+		}
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(
+		lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(identity.InterceptorAddIdentity(identity.Identity{Instance: "agent-1"})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	d, err := GetGRPC(ctx, conn, "prod", "")
+	require.NoError(t, err)
+	require.Contains(t, string(d.Config), "localhost:9090", "config of agent is found by identity")
+
+	_, err = GetGRPC(ctx, conn, "prod", d.Version)
+	require.ErrorIs(t, err, ErrNotModified)
+
+	t.Run("not found", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+
+		s := grpc.NewServer()
+		RegisterServer(s, NewStore(t.TempDir()))
+
+		go func() {
+			if err := s.Serve(lis); err != nil {
+				require.FailNow(t, err.Error())
+			}
+		}()
+
+		defer s.Stop()
+
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = GetGRPC(ctx, conn, "prod", "")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+}
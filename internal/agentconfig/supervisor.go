@@ -0,0 +1,215 @@
+package agentconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"go.uber.org/zap"
+)
+
+// Agent describes the running agent with its client
+type Agent interface {
+	Run(ctx context.Context) error
+	AgentConfig(ctx context.Context, group, version string) (Document, error)
+	Close() error
+}
+
+// Factory creates agent by parameters
+type Factory func(p parameters.AgentParameters) (Agent, error)
+
+// Supervisor runs agent and restarts it when the server returns new config.
+// New config is applied only if it's valid and the server can be reached with it,
+// otherwise the running agent keeps working and the version is rejected.
+// If agent with applied config stops with error, for example it can't listen on the address,
+// the version is rejected and agent is restarted with the previous config.
+// If the server removes config, agent is restarted with local parameters.
+type Supervisor struct {
+	base     parameters.AgentParameters
+	factory  Factory
+	interval time.Duration
+	running  applied
+	previous applied
+	rejected string
+}
+
+// applied it's parameters of agent with version of config, empty version means local parameters
+type applied struct {
+	params  parameters.AgentParameters
+	version string
+}
+
+// NewSupervisor create Supervisor, base it's local parameters of agent
+func NewSupervisor(base parameters.AgentParameters, factory Factory) *Supervisor {
+	return &Supervisor{
+		base:     base,
+		factory:  factory,
+		interval: time.Duration(base.ConfigPollInterval) * time.Second,
+		running:  applied{params: base},
+		previous: applied{params: base},
+	}
+}
+
+// Run runs agent until ctx is canceled. Config is polled every ConfigPollInterval seconds,
+// zero interval means that agent works with local parameters only.
+func (s *Supervisor) Run(ctx context.Context) error {
+	current, err := s.factory(s.base)
+	if err != nil {
+		return fmt.Errorf("create agent: %w", err)
+	}
+
+	if s.interval == 0 {
+		defer current.Close()
+		return current.Run(ctx)
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		runCtx, stop := context.WithCancel(ctx)
+		done := make(chan error, 1)
+
+		go func() {
+			done <- current.Run(runCtx)
+		}()
+
+		next, err := s.watch(ctx, current, ticker.C, done)
+		stop()
+
+		if next == nil {
+			current.Close()
+
+			if ctx.Err() != nil || s.running.version == "" {
+				return err
+			}
+
+			if next, err = s.rollback(err); err != nil {
+				return err
+			}
+
+			current = next
+
+			continue
+		}
+
+		<-done
+		if err := current.Close(); err != nil {
+			logger.Log.Warn("Close replaced agent", zap.Error(err))
+		}
+
+		current = next
+	}
+}
+
+// rollback rejects the running version after failure of agent and creates agent with the previous config
+func (s *Supervisor) rollback(failure error) (Agent, error) {
+	logger.Log.Error("Agent with applied config is stopped, restore previous config",
+		zap.String("version", s.running.version),
+		zap.String("previous version", s.previous.version),
+		zap.Error(failure),
+	)
+
+	next, err := s.factory(s.previous.params)
+	if err != nil {
+		return nil, fmt.Errorf("create agent with previous config: %w", err)
+	}
+
+	s.rejected = s.running.version
+	s.running, s.previous = s.previous, applied{params: s.base}
+
+	return next, nil
+}
+
+// watch polls config until new agent is created, nil agent means that running agent is stopped
+func (s *Supervisor) watch(ctx context.Context, current Agent, tick <-chan time.Time, done <-chan error) (Agent, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, <-done
+		case err := <-done:
+			return nil, err
+		case <-tick:
+			if next := s.poll(ctx, current); next != nil {
+				return next, nil
+			}
+		}
+	}
+}
+
+// poll returns agent with new config or nil if config isn't changed or is rejected
+func (s *Supervisor) poll(ctx context.Context, current Agent) Agent {
+	d, err := current.AgentConfig(ctx, s.base.Group, s.running.version)
+
+	switch {
+	case errors.Is(err, ErrNotModified):
+		return nil
+	case errors.Is(err, ErrNotFound):
+		if s.running.version == "" {
+			return nil
+		}
+
+		logger.Log.Info("Agent config is removed, restore local parameters", zap.String("version", s.running.version))
+
+		next, err := s.factory(s.base)
+		if err != nil {
+			logger.Log.Error("Create agent with local parameters", zap.Error(err))
+			return nil
+		}
+
+		s.running, s.previous = applied{params: s.base}, s.running
+
+		return next
+	case err != nil:
+		logger.Log.Warn("Get agent config", zap.Error(err))
+		return nil
+	}
+
+	if d.Version == s.running.version || d.Version == s.rejected {
+		return nil
+	}
+
+	p, err := Apply(s.base, d)
+	if err != nil {
+		logger.Log.Error("Reject agent config", zap.String("version", d.Version), zap.Error(err))
+		s.rejected = d.Version
+
+		return nil
+	}
+
+	next, err := s.candidate(ctx, p, d.Version)
+	if err != nil {
+		logger.Log.Error("Reject agent config", zap.String("version", d.Version), zap.Error(err))
+		s.rejected = d.Version
+
+		return nil
+	}
+
+	logger.Log.Info("Apply agent config", zap.String("version", d.Version))
+	s.running, s.previous = applied{params: p, version: d.Version}, s.running
+
+	return next
+}
+
+// candidate creates agent by parameters of config and checks that the server serves the same config for it
+func (s *Supervisor) candidate(ctx context.Context, p parameters.AgentParameters, version string) (Agent, error) {
+	next, err := s.factory(p)
+	if err != nil {
+		return nil, fmt.Errorf("create agent: %w", err)
+	}
+
+	if _, err := next.AgentConfig(ctx, s.base.Group, version); !errors.Is(err, ErrNotModified) {
+		next.Close()
+
+		if err == nil {
+			err = errors.New("server returns other version")
+		}
+
+		return nil, fmt.Errorf("check server with new config: %w", err)
+	}
+
+	return next, nil
+}
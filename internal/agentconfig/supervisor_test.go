@@ -0,0 +1,210 @@
+package agentconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer serves config for agents with reachable addresses
+type testServer struct {
+	mu        sync.Mutex
+	doc       Document
+	reachable map[string]bool
+}
+
+func (s *testServer) set(d Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.doc = d
+}
+
+func (s *testServer) get(addr, version string) (Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.reachable[addr] {
+		return Document{}, errors.New("connection refused")
+	}
+
+	if s.doc.Version == "" {
+		return Document{}, ErrNotFound
+	}
+
+	if s.doc.Version == version {
+		return Document{Version: version}, ErrNotModified
+	}
+
+	return s.doc, nil
+}
+
+// testAgent fails on start if its address is busy
+type testAgent struct {
+	addr    string
+	server  *testServer
+	started chan<- string
+	closed  *atomic.Int64
+}
+
+func (a *testAgent) Run(ctx context.Context) error {
+	a.started <- a.addr
+	if a.addr == "busy" {
+		return errors.New("address already in use")
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (a *testAgent) AgentConfig(_ context.Context, _, version string) (Document, error) {
+	return a.server.get(a.addr, version)
+}
+
+func (a *testAgent) Close() error {
+	a.closed.Add(1)
+	return nil
+}
+
+func TestSupervisor_Run(t *testing.T) {
+	server := &testServer{reachable: map[string]bool{"old": true, "new": true}}
+	started := make(chan string, 1)
+
+	var created, closed atomic.Int64
+
+	s := NewSupervisor(
+		parameters.AgentParameters{ListenAddr: "old", ReportInterval: 10, PollInterval: 2, ConfigPollInterval: 1},
+		func(p parameters.AgentParameters) (Agent, error) {
+			created.Add(1)
+			return &testAgent{addr: p.ListenAddr, server: server, started: started, closed: &closed}, nil
+		},
+	)
+	s.interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	waitStart(t, started, "old")
+	notStarted(t, started, "agent is restarted without config")
+
+	server.set(Document{Version: "v1", Config: json.RawMessage(`{"address": "new"}`)})
+	waitStart(t, started, "new")
+	notStarted(t, started, "agent is restarted with the same config")
+
+	server.set(Document{Version: "v2", Config: json.RawMessage(`{"address": "down"}`)})
+	notStarted(t, started, "agent is restarted with unreachable server")
+
+	server.set(Document{Version: "v3", Config: json.RawMessage(`{"report": 1}`)})
+	notStarted(t, started, "agent is restarted with invalid config")
+
+	server.set(Document{})
+	waitStart(t, started, "old")
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "supervisor isn't stopped")
+	}
+
+	require.Equal(t, created.Load(), closed.Load(), "rejected and replaced agents are closed")
+}
+
+func TestSupervisor_Run_startFailure(t *testing.T) {
+	server := &testServer{reachable: map[string]bool{"old": true, "new": true, "busy": true}}
+	started := make(chan string, 1)
+
+	var closed atomic.Int64
+
+	s := NewSupervisor(
+		parameters.AgentParameters{ListenAddr: "old", ReportInterval: 10, PollInterval: 2, ConfigPollInterval: 1},
+		func(p parameters.AgentParameters) (Agent, error) {
+			return &testAgent{addr: p.ListenAddr, server: server, started: started, closed: &closed}, nil
+		},
+	)
+	s.interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	waitStart(t, started, "old")
+
+	server.set(Document{Version: "v1", Config: json.RawMessage(`{"address": "new"}`)})
+	waitStart(t, started, "new")
+
+	server.set(Document{Version: "v2", Config: json.RawMessage(`{"address": "busy"}`)})
+	waitStart(t, started, "busy")
+	waitStart(t, started, "new")
+	notStarted(t, started, "failed config is applied again")
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err, "supervisor isn't stopped by failure of agent with applied config")
+	case <-time.After(time.Second):
+		require.FailNow(t, "supervisor isn't stopped")
+	}
+}
+
+func TestSupervisor_Run_withoutPolling(t *testing.T) {
+	started := make(chan string, 1)
+
+	var closed atomic.Int64
+
+	s := NewSupervisor(
+		parameters.AgentParameters{ListenAddr: "old"},
+		func(p parameters.AgentParameters) (Agent, error) {
+			return &testAgent{addr: p.ListenAddr, server: &testServer{}, started: started, closed: &closed}, nil
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	require.NoError(t, s.Run(ctx))
+	require.Equal(t, int64(1), closed.Load())
+}
+
+func waitStart(t *testing.T, started <-chan string, want string) {
+	t.Helper()
+
+	select {
+	case addr := <-started:
+		require.Equal(t, want, addr)
+	case <-time.After(time.Second):
+		require.FailNow(t, "agent isn't started", want)
+	}
+}
+
+func notStarted(t *testing.T, started <-chan string, msg string) {
+	t.Helper()
+
+	select {
+	case addr := <-started:
+		require.FailNow(t, msg, addr)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,261 @@
+// Package auth defines structures for bearer token authentication and scope checks.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Scope defines an access right of a token.
+type Scope string
+
+// Contains supported scopes
+const (
+	ScopeWrite Scope = "metrics:write"
+	ScopeRead  Scope = "metrics:read"
+	ScopeAdmin Scope = "admin"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	bearerPrefix        = "Bearer "
+)
+
+// Auth errors
+var (
+	ErrUnauthenticated = errors.New("missing or unknown token")
+	ErrForbidden       = errors.New("token has no access")
+)
+
+// Identity describes the caller authenticated by a token.
+// Identity with tenant has access only to metrics of this tenant unless it has admin scope.
+type Identity struct {
+	Name     string   `json:"name"`
+	Token    string   `json:"token"`
+	Tenant   string   `json:"tenant"`
+	Scopes   []Scope  `json:"scopes"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// HasScope checks whether the identity has the scope. Admin scope includes all others.
+func (id *Identity) HasScope(scope Scope) bool {
+	return slices.Contains(id.Scopes, ScopeAdmin) || slices.Contains(id.Scopes, scope)
+}
+
+// AllowMetric checks whether the identity has access to the metric name.
+// Identity without prefixes or with admin scope has access to all metrics.
+func (id *Identity) AllowMetric(name string) bool {
+	if len(id.Prefixes) == 0 || slices.Contains(id.Scopes, ScopeAdmin) {
+		return true
+	}
+
+	for _, p := range id.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type identityKey struct{}
+
+// NewContext returns a new context that carries the identity.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// AllowMetrics checks the caller's access to the metric names.
+// It returns nil if the context has no identity, which means that authentication is disabled.
+func AllowMetrics(ctx context.Context, names ...string) error {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	for _, name := range names {
+		if !id.AllowMetric(name) {
+			return fmt.Errorf("%w: metric %s", ErrForbidden, name)
+		}
+	}
+
+	return nil
+}
+
+// Check checks the caller's scope and access to the metric names.
+// It returns nil if the context has no identity, which means that authentication is disabled.
+func Check(ctx context.Context, scope Scope, names ...string) error {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if !id.HasScope(scope) {
+		return fmt.Errorf("%w: scope %s required", ErrForbidden, scope)
+	}
+
+	return AllowMetrics(ctx, names...)
+}
+
+// Authenticator checks tokens from the token file.
+// Authenticator without tokens doesn't check anything.
+type Authenticator struct {
+	tokens map[string]*Identity
+}
+
+// NewAuthenticator create Authenticator by the token file.
+// The token file is a JSON array of identities. Empty path disables authentication.
+func NewAuthenticator(path string) (*Authenticator, error) {
+	if path == "" {
+		return &Authenticator{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+
+	var ids []*Identity
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("decode token file: %w", err)
+	}
+
+	a := &Authenticator{tokens: make(map[string]*Identity, len(ids))}
+
+	for _, id := range ids {
+		if id.Token == "" {
+			return nil, fmt.Errorf("empty token for %s", id.Name)
+		}
+
+		for _, s := range id.Scopes {
+			switch s {
+			case ScopeWrite, ScopeRead, ScopeAdmin:
+			default:
+				return nil, fmt.Errorf("unknown scope %s for %s", s, id.Name)
+			}
+		}
+
+		a.tokens[hashToken(id.Token)] = id
+		id.Token = ""
+	}
+
+	return a, nil
+}
+
+// Enabled reports whether tokens are checked.
+func (a *Authenticator) Enabled() bool {
+	return a != nil && len(a.tokens) != 0
+}
+
+func (a *Authenticator) identify(token string) (*Identity, error) {
+	id, ok := a.tokens[hashToken(token)]
+	if !ok || token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	return id, nil
+}
+
+// RequestAuth middleware checking the bearer token of the Authorization header.
+func (a *Authenticator) RequestAuth(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get(headerAuthorization), bearerPrefix)
+		if !ok {
+			http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		id, err := a.identify(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// RequireScope returns middleware checking that the authenticated caller has the scope.
+func (a *Authenticator) RequireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if err := Check(r.Context(), scope); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// InterceptorAuth interceptor checking the bearer token of the authorization metadata.
+func (a *Authenticator) InterceptorAuth(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	if !a.Enabled() {
+		resp, err = handler(ctx, req)
+		return
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(headerAuthorization)
+
+	if len(values) == 0 {
+		err = status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		return
+	}
+
+	token, _ := strings.CutPrefix(values[0], bearerPrefix)
+	id, err := a.identify(token)
+	if err != nil {
+		err = status.Error(codes.Unauthenticated, err.Error())
+		return
+	}
+
+	resp, err = handler(NewContext(ctx, id), req)
+
+	return
+}
+
+// InterceptorAddToken returns an interceptor that adds the bearer token to the authorization metadata.
+func InterceptorAddToken(token string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, headerAuthorization, bearerPrefix+token)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/interop"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	t.Run("empty path", func(t *testing.T) {
+		a, err := NewAuthenticator("")
+		require.NoError(t, err)
+		require.False(t, a.Enabled())
+	})
+
+	t.Run("positive test", func(t *testing.T) {
+		a, err := NewAuthenticator("./testdata/tokens.json")
+		require.NoError(t, err)
+		require.True(t, a.Enabled())
+
+		id, err := a.identify("write-token")
+		require.NoError(t, err)
+		require.Equal(t, "writer", id.Name)
+		require.Empty(t, id.Token)
+	})
+
+	t.Run("unknown scope", func(t *testing.T) {
+		_, err := NewAuthenticator("./testdata/unknown_scope.json")
+		require.Error(t, err)
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		_, err := NewAuthenticator("./testdata/error")
+		require.Error(t, err)
+	})
+}
+
+func TestCheck(t *testing.T) {
+	writer := &Identity{Scopes: []Scope{ScopeWrite}, Prefixes: []string{"app_"}}
+	admin := &Identity{Scopes: []Scope{ScopeAdmin}, Prefixes: []string{"app_"}}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		scope   Scope
+		metrics []string
+		wantErr bool
+	}{
+		{name: "no identity", ctx: context.Background(), scope: ScopeAdmin, metrics: []string{"any"}},
+		{name: "allowed prefix", ctx: NewContext(context.Background(), writer), scope: ScopeWrite, metrics: []string{"app_test"}},
+		{name: "wrong prefix", ctx: NewContext(context.Background(), writer), scope: ScopeWrite, metrics: []string{"app_test", "test"}, wantErr: true},
+		{name: "wrong scope", ctx: NewContext(context.Background(), writer), scope: ScopeRead, wantErr: true},
+		{name: "admin", ctx: NewContext(context.Background(), admin), scope: ScopeRead, metrics: []string{"test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.ctx, tt.scope, tt.metrics...)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrForbidden)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthenticator_RequestAuth(t *testing.T) {
+	a, err := NewAuthenticator("./testdata/tokens.json")
+	require.NoError(t, err)
+
+	webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := httptest.NewServer(a.RequestAuth(a.RequireScope(ScopeWrite)(webhook)))
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "missing token", want: http.StatusUnauthorized},
+		{name: "unknown token", token: "test", want: http.StatusUnauthorized},
+		{name: "wrong scope", token: "read-token", want: http.StatusForbidden},
+		{name: "positive test", token: "write-token", want: http.StatusOK},
+		{name: "admin", token: "admin-token", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := resty.New().R()
+			if tt.token != "" {
+				req.SetAuthToken(tt.token)
+			}
+
+			resp, err := req.Post(srv.URL)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, resp.StatusCode())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		a, err := NewAuthenticator("")
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(a.RequestAuth(a.RequireScope(ScopeWrite)(webhook)))
+		defer srv.Close()
+
+		resp, err := resty.New().R().Post(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+	})
+}
+
+func TestAuthenticator_InterceptorAuth(t *testing.T) {
+	a, err := NewAuthenticator("./testdata/tokens.json")
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(a.InterceptorAuth))
+
+	testgrpc.RegisterTestServiceServer(
+		s,
+		interop.NewTestServer(),
+	)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			require.FailNow(t, err.Error())
+		}
+	}()
+
+	defer s.Stop()
+
+	tests := []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{name: "missing token", want: codes.Unauthenticated},
+		{name: "unknown token", token: "test", want: codes.Unauthenticated},
+		{name: "positive test", token: "write-token", want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.NewClient(
+				lis.Addr().String(),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithUnaryInterceptor(InterceptorAddToken(tt.token)),
+			)
+
+			require.NoError(t, err)
+			defer conn.Close()
+
+			client := testgrpc.NewTestServiceClient(conn)
+			_, err = client.EmptyCall(context.Background(), &testgrpc.Empty{})
+
+			require.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
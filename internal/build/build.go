@@ -6,6 +6,14 @@ import (
 	"fmt"
 )
 
+// displayedVersion it's build version displayed by DisplayBuild
+var displayedVersion = "N/A"
+
+// Version returns build version of the running application, it's N/A until DisplayBuild is called
+func Version() string {
+	return displayedVersion
+}
+
 // DisplayBuild displays information about the version date and commit of the application in the console
 func DisplayBuild(version, date, commit string) (string, string, string) {
 	emptyData := "N/A"
@@ -13,6 +21,7 @@ func DisplayBuild(version, date, commit string) (string, string, string) {
 	version = cmp.Or(version, emptyData)
 	date = cmp.Or(date, emptyData)
 	commit = cmp.Or(commit, emptyData)
+	displayedVersion = version
 
 	fmt.Printf("Build version: %s\n", version)
 	fmt.Printf("Build date: %s\n", date)
@@ -15,6 +15,7 @@ func TestDisplayBuild(t *testing.T) {
 		require.Equal(t, wantV, gotV)
 		require.Equal(t, wantD, gotD)
 		require.Equal(t, wantC, gotC)
+		require.Equal(t, wantV, Version())
 	})
 
 	t.Run("test N/A", func(t *testing.T) {
@@ -3,20 +3,26 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
 	"github.com/DarkOmap/metricsService/internal/certmanager"
 	"github.com/DarkOmap/metricsService/internal/compresses"
 	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/DarkOmap/metricsService/internal/identity"
 	"github.com/DarkOmap/metricsService/internal/ip"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/models"
 	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
 )
 
 const (
@@ -40,11 +46,16 @@ type Encrypter interface {
 
 // HTTP it's structure witch send hashed data to server.
 type HTTP struct {
-	restyClient *resty.Client
-	gp          Compresser
-	encrypter   Encrypter
-	h           *hasher.Hasher
-	addr        string
+	restyClient    *resty.Client
+	gp             Compresser
+	encrypter      Encrypter
+	h              *hasher.Hasher
+	addr           string
+	token          string
+	tenant         string
+	identity       identity.Identity
+	recorder       *Sink
+	hashMismatches atomic.Int64
 }
 
 // NewHTTP create HTTP client
@@ -55,6 +66,11 @@ func NewHTTP(p parameters.AgentParameters) (*HTTP, error) {
 		return nil, fmt.Errorf("create encrypt manager: %w", err)
 	}
 
+	rec, err := newRecorder(p.RecordFile)
+	if err != nil {
+		return nil, err
+	}
+
 	logger.Log.Info("Create hasher pool")
 	h := hasher.NewHasher([]byte(p.HashKey), p.RateLimit)
 
@@ -66,6 +82,10 @@ func NewHTTP(p parameters.AgentParameters) (*HTTP, error) {
 		encrypter: em,
 		h:         h,
 		addr:      p.ListenAddr,
+		token:     p.Token,
+		tenant:    p.Tenant,
+		identity:  identity.New(p.Instance, p.ReportInterval),
+		recorder:  rec,
 	}
 
 	c.setRestyClient()
@@ -78,9 +98,19 @@ func (c *HTTP) Close() error {
 	c.gp.Close()
 	c.h.Close()
 
+	if c.recorder != nil {
+		return c.recorder.Close()
+	}
+
 	return nil
 }
 
+// ResponseHashMismatches returns the number of responses that failed hash verification.
+// Mismatched responses of updates are returned as hasher.AppliedUpdateError, because the server has already applied them.
+func (c *HTTP) ResponseHashMismatches() int64 {
+	return c.hashMismatches.Load()
+}
+
 // SendGauge send float64 value to server.
 func (c *HTTP) SendGauge(ctx context.Context, name string, value float64) error {
 	m := models.NewMetricsForGauge(name, value)
@@ -100,10 +130,16 @@ func (c *HTTP) SendGauge(ctx context.Context, name string, value float64) error
 		return fmt.Errorf("send gauge metric with http name %s value %f: %w", name, value, err)
 	}
 
+	if err := hasher.ErrorByStatusCode(resp.StatusCode()); err != nil {
+		return fmt.Errorf("send gauge metric with http name %s value %f: %w", name, value, err)
+	}
+
 	if resp.StatusCode() != http.StatusOK {
 		return fmt.Errorf("send gauge metric with http name %s value %f status not 200, current status %d", name, value, resp.StatusCode())
 	}
 
+	record(c.recorder, Record{Gauges: map[string]float64{name: value}})
+
 	return nil
 }
 
@@ -126,16 +162,22 @@ func (c *HTTP) SendCounter(ctx context.Context, name string, delta int64) error
 		return fmt.Errorf("send counter name %s delta %d: %w", name, delta, err)
 	}
 
+	if err := hasher.ErrorByStatusCode(resp.StatusCode()); err != nil {
+		return fmt.Errorf("send counter name %s delta %d: %w", name, delta, err)
+	}
+
 	if resp.StatusCode() != http.StatusOK {
 		return fmt.Errorf("send counter name %s delta %d status not 200, current status %d", name, delta, resp.StatusCode())
 	}
 
+	record(c.recorder, Record{Counters: map[string]int64{name: delta}})
+
 	return nil
 }
 
-// SendBatch send batch data to server.
-func (c *HTTP) SendBatch(ctx context.Context, batch map[string]float64) error {
-	m := models.GetGaugesSliceByMap(batch)
+// SendBatch send gauges and counter increments to server in one request.
+func (c *HTTP) SendBatch(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	m := append(models.GetGaugesSliceByMap(gauges), models.GetCountersSliceByMap(counters)...)
 
 	b, err := c.gp.GetCompressedJSON(m)
 	if err != nil {
@@ -152,13 +194,54 @@ func (c *HTTP) SendBatch(ctx context.Context, batch map[string]float64) error {
 		return fmt.Errorf("send batch in http: %w", err)
 	}
 
+	if err := hasher.ErrorByStatusCode(resp.StatusCode()); err != nil {
+		return fmt.Errorf("send batch in http: %w", err)
+	}
+
 	if resp.StatusCode() != http.StatusOK {
 		return fmt.Errorf("send batch in http status not 200, current status %d", resp.StatusCode())
 	}
 
+	record(c.recorder, Record{Gauges: gauges, Counters: counters})
+
 	return nil
 }
 
+// AgentConfig requests config of agent from server.
+// It returns agentconfig.ErrNotFound if the server hasn't config for agent
+// and agentconfig.ErrNotModified if version isn't changed.
+func (c *HTTP) AgentConfig(ctx context.Context, group, version string) (agentconfig.Document, error) {
+	req := c.restyClient.R().SetBody([]byte{}).
+		SetQueryParam("group", group).
+		SetContext(ctx)
+
+	if version != "" {
+		req.SetHeader("If-None-Match", `"`+version+`"`)
+	}
+
+	resp, err := req.Get("http://" + c.addr + "/agent/config")
+	if err != nil {
+		return agentconfig.Document{}, fmt.Errorf("get agent config: %w", err)
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return agentconfig.Document{Version: version}, agentconfig.ErrNotModified
+	case http.StatusNotFound:
+		return agentconfig.Document{}, agentconfig.ErrNotFound
+	default:
+		return agentconfig.Document{}, fmt.Errorf("get agent config status not 200, current status %d", resp.StatusCode())
+	}
+
+	var d agentconfig.Document
+	if err := json.Unmarshal(resp.Body(), &d); err != nil {
+		return agentconfig.Document{}, fmt.Errorf("unmarshal agent config: %w", err)
+	}
+
+	return d, nil
+}
+
 func (c *HTTP) setRestyClient() {
 	client := resty.New().
 		AddRetryCondition(func(_ *resty.Response, err error) bool {
@@ -168,19 +251,43 @@ func (c *HTTP) setRestyClient() {
 		SetRetryWaitTime(1 * time.Second).
 		SetRetryMaxWaitTime(9 * time.Second).
 		OnBeforeRequest(func(rc *resty.Client, r *resty.Request) error {
-			b, err := c.encrypter.EncryptMessage(r.Body.([]byte))
+			body := r.Body.([]byte)
+
+			err := c.h.HashingRequest(r, body)
+			if err != nil {
+				return fmt.Errorf("hashing request: %w", err)
+			}
+
+			b, err := c.encrypter.EncryptMessage(body)
 			if err != nil {
 				return fmt.Errorf("encrypt message: %w", err)
 			}
 
 			r.Body = b
 
-			err = c.h.HashingRequest(r, b)
-			if err != nil {
-				return fmt.Errorf("hashing request: %w", err)
+			r.SetHeader("X-Real-IP", ip.GetLocalIP())
+
+			if c.token != "" {
+				r.SetAuthToken(c.token)
 			}
 
-			r.SetHeader("X-Real-IP", ip.GetLocalIP())
+			tenant.SetHeader(r.Header, c.tenant)
+			identity.SetHeader(r.Header, c.identity)
+
+			return nil
+		}).
+		OnAfterResponse(func(_ *resty.Client, r *resty.Response) error {
+			if err := c.h.VerifyResponse(r); err != nil {
+				c.hashMismatches.Add(1)
+
+				// the server has already applied the update, so agent mustn't send counters again
+				if r.Request.Method == http.MethodPost {
+					return &hasher.AppliedUpdateError{Err: fmt.Errorf("verify response: %w", err)}
+				}
+
+				logger.Log.Warn("Verify response", zap.Error(err))
+				return fmt.Errorf("verify response: %w", err)
+			}
 
 			return nil
 		})
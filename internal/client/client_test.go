@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
 	"github.com/DarkOmap/metricsService/internal/hasher"
 	"github.com/DarkOmap/metricsService/internal/parameters"
 	"github.com/stretchr/testify/assert"
@@ -378,7 +380,7 @@ func TestClient_SendBatch(t *testing.T) {
 			addr:      strings.TrimPrefix(ts.URL, "http://"),
 		}
 		c.setRestyClient()
-		err := c.SendBatch(context.Background(), map[string]float64{"test": 44})
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 44}, map[string]int64{"test": 1})
 		assert.Error(t, err)
 	})
 
@@ -398,7 +400,7 @@ func TestClient_SendBatch(t *testing.T) {
 			addr:      strings.TrimPrefix(ts.URL, "http://"),
 		}
 		c.setRestyClient()
-		err := c.SendBatch(context.Background(), map[string]float64{"test": 44})
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 44}, map[string]int64{"test": 1})
 		assert.NoError(t, err)
 	})
 
@@ -412,7 +414,7 @@ func TestClient_SendBatch(t *testing.T) {
 			addr:      "test",
 		}
 		c.setRestyClient()
-		err := c.SendBatch(context.Background(), map[string]float64{"test": 44})
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 44}, map[string]int64{"test": 1})
 
 		assert.Error(t, err)
 	})
@@ -429,7 +431,7 @@ func TestClient_SendBatch(t *testing.T) {
 			addr:      "test",
 		}
 		c.setRestyClient()
-		err := c.SendBatch(context.Background(), map[string]float64{"test": 44})
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 44}, map[string]int64{"test": 1})
 
 		assert.Error(t, err)
 	})
@@ -448,7 +450,7 @@ func TestClient_SendBatch(t *testing.T) {
 			addr:      "test",
 		}
 		c.setRestyClient()
-		err := c.SendBatch(context.Background(), map[string]float64{"test": 44})
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 44}, map[string]int64{"test": 1})
 
 		assert.Error(t, err)
 	})
@@ -470,11 +472,86 @@ func TestClient_SendBatch(t *testing.T) {
 			addr:      strings.TrimPrefix(ts.URL, "http://"),
 		}
 		c.setRestyClient()
-		err := c.SendBatch(context.Background(), map[string]float64{"test": 44})
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 44}, map[string]int64{"test": 1})
 		assert.Error(t, err)
 	})
 }
 
+func TestClient_VerifyResponse(t *testing.T) {
+	key := []byte("test")
+
+	t.Run("signed response", func(t *testing.T) {
+		cmo := new(CompresserMockedObject)
+		cmo.On("GetCompressedJSON").Return([]byte("test"), nil)
+
+		emo := new(EncrypterMockedObject)
+		emo.On("EncryptMessage").Return([]byte("test"), nil)
+
+		h := hasher.NewHasher(key, 1)
+		ts := httptest.NewServer(h.ResponseHash(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("ok"))
+				},
+			),
+		))
+		defer ts.Close()
+
+		c := HTTP{
+			gp:        cmo,
+			encrypter: emo,
+			h:         h,
+			addr:      strings.TrimPrefix(ts.URL, "http://"),
+		}
+		c.setRestyClient()
+		err := c.SendBatch(context.Background(), map[string]float64{"test": 1}, nil)
+
+		require.NoError(t, err)
+		require.Zero(t, c.ResponseHashMismatches())
+	})
+
+	t.Run("wrong signature", func(t *testing.T) {
+		cmo := new(CompresserMockedObject)
+		cmo.On("GetCompressedJSON").Return([]byte("test"), nil)
+
+		emo := new(EncrypterMockedObject)
+		emo.On("EncryptMessage").Return([]byte("test"), nil)
+
+		var updates atomic.Int64
+		ts := httptest.NewServer(hasher.NewHasher([]byte("test2"), 1).ResponseHash(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodPost {
+						updates.Add(1)
+					}
+
+					w.Write([]byte(`{"version":"v1"}`))
+				},
+			),
+		))
+		defer ts.Close()
+
+		c := HTTP{
+			gp:        cmo,
+			encrypter: emo,
+			h:         hasher.NewHasher(key, 1),
+			addr:      strings.TrimPrefix(ts.URL, "http://"),
+		}
+		c.setRestyClient()
+		err := c.SendCounter(context.Background(), "test", 1)
+
+		var applied *hasher.AppliedUpdateError
+		require.ErrorAs(t, err, &applied, "applied counter isn't sent again")
+		require.ErrorIs(t, err, hasher.ErrResponseHash)
+		require.Equal(t, int64(1), updates.Load())
+		require.Equal(t, int64(1), c.ResponseHashMismatches())
+
+		_, err = c.AgentConfig(context.Background(), "", "")
+		require.ErrorIs(t, err, hasher.ErrResponseHash, "unverified config isn't applied")
+		require.Equal(t, int64(2), c.ResponseHashMismatches())
+	})
+}
+
 func TestNewHTTP(t *testing.T) {
 	t.Run("positive test", func(t *testing.T) {
 		c, err := NewHTTP(parameters.AgentParameters{
@@ -500,3 +577,42 @@ func TestNewHTTP(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestAgentConfig(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Query().Get("group") != "prod":
+					http.Error(w, "not found", http.StatusNotFound)
+				case r.Header.Get("If-None-Match") == `"v1"`:
+					w.WriteHeader(http.StatusNotModified)
+				default:
+					w.Write([]byte(`{"version":"v1","config":{"report_interval":30}}`))
+				}
+			},
+		),
+	)
+	defer ts.Close()
+
+	emo := new(EncrypterMockedObject)
+	emo.On("EncryptMessage").Return([]byte{}, nil)
+
+	c := HTTP{
+		encrypter: emo,
+		h:         hasher.NewHasher(make([]byte, 0), 1),
+		addr:      strings.TrimPrefix(ts.URL, "http://"),
+	}
+	c.setRestyClient()
+
+	d, err := c.AgentConfig(context.Background(), "prod", "")
+	require.NoError(t, err)
+	require.Equal(t, "v1", d.Version)
+	require.JSONEq(t, `{"report_interval":30}`, string(d.Config))
+
+	_, err = c.AgentConfig(context.Background(), "prod", "v1")
+	require.ErrorIs(t, err, agentconfig.ErrNotModified)
+
+	_, err = c.AgentConfig(context.Background(), "dev", "")
+	require.ErrorIs(t, err, agentconfig.ErrNotFound)
+}
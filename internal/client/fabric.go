@@ -4,20 +4,50 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/parameters"
+	"go.uber.org/zap"
 )
 
 // Client describes client methods
 type Client interface {
-	SendBatch(ctx context.Context, batch map[string]float64) error
+	SendBatch(ctx context.Context, gauges map[string]float64, counters map[string]int64) error
 	SendCounter(ctx context.Context, name string, delta int64) error
 	SendGauge(ctx context.Context, name string, value float64) error
+	AgentConfig(ctx context.Context, group, version string) (agentconfig.Document, error)
 	Close() error
 }
 
-// NewClient fabric method to create client
+// NewClient fabric method to create client by output of agent:
+// server, stdout, file or tee which sends to server and writes to stdout or file
 func NewClient(p parameters.AgentParameters) (Client, error) {
+	switch p.Output {
+	case "", "server":
+		return newServerClient(p)
+	case "stdout", "file":
+		logger.Log.Info("Create local sink", zap.String("output", p.Output))
+		return newSink(p)
+	case "tee":
+		c, err := newServerClient(p)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Log.Info("Create local sink for tee")
+		s, err := newSink(p)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		return NewTee(c, s), nil
+	default:
+		return nil, fmt.Errorf("unknown output %s, want server, stdout, file or tee", p.Output)
+	}
+}
+
+func newServerClient(p parameters.AgentParameters) (Client, error) {
 	if p.UseGRPC {
 		logger.Log.Info("Create grpc client")
 		c, err := NewGRPC(p)
@@ -35,3 +65,21 @@ func NewClient(p parameters.AgentParameters) (Client, error) {
 
 	return c, nil
 }
+
+// newSink creates file sink if output file is set, otherwise stdout sink
+func newSink(p parameters.AgentParameters) (*Sink, error) {
+	if p.OutputFile == "" {
+		if p.Output == "file" {
+			return nil, fmt.Errorf("output file isn't set")
+		}
+
+		return NewStdoutSink(), nil
+	}
+
+	s, err := NewFileSink(p.OutputFile, int64(p.OutputMaxSize), int(p.OutputMaxBackups))
+	if err != nil {
+		return nil, fmt.Errorf("create file sink: %w", err)
+	}
+
+	return s, nil
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/DarkOmap/metricsService/internal/parameters"
@@ -51,4 +52,33 @@ func TestNewClient(t *testing.T) {
 		_, err := NewClient(p)
 		require.Error(t, err)
 	})
+
+	t.Run("local outputs", func(t *testing.T) {
+		tests := []struct {
+			name string
+			p    parameters.AgentParameters
+			want Client
+		}{
+			{name: "stdout", p: parameters.AgentParameters{Output: "stdout"}, want: &Sink{}},
+			{name: "file", p: parameters.AgentParameters{Output: "file", OutputFile: filepath.Join(t.TempDir(), "out.jsonl")}, want: &Sink{}},
+			{name: "tee", p: parameters.AgentParameters{Output: "tee", RateLimit: 1, ListenAddr: ":0", UseGRPC: true}, want: &Tee{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				c, err := NewClient(tt.p)
+				require.NoError(t, err)
+				require.IsType(t, tt.want, c)
+				require.NoError(t, c.Close())
+			})
+		}
+	})
+
+	t.Run("negative outputs", func(t *testing.T) {
+		_, err := NewClient(parameters.AgentParameters{Output: "file"})
+		require.Error(t, err, "output file isn't set")
+
+		_, err = NewClient(parameters.AgentParameters{Output: "kafka"})
+		require.Error(t, err)
+	})
 }
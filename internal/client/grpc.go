@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/DarkOmap/metricsService/internal/auth"
 	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/DarkOmap/metricsService/internal/identity"
 	"github.com/DarkOmap/metricsService/internal/ip"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/parameters"
 	"github.com/DarkOmap/metricsService/internal/proto"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
@@ -16,13 +20,19 @@ import (
 
 // GRPC client's grpc structure
 type GRPC struct {
-	client proto.MetricsClient
-	hasher *hasher.Hasher
-	conn   *grpc.ClientConn
+	client   proto.MetricsClient
+	hasher   *hasher.Hasher
+	conn     *grpc.ClientConn
+	recorder *Sink
 }
 
 // NewGRPC create new grpc client
 func NewGRPC(p parameters.AgentParameters) (*GRPC, error) {
+	rec, err := newRecorder(p.RecordFile)
+	if err != nil {
+		return nil, err
+	}
+
 	logger.Log.Info("Create hasher pool")
 	h := hasher.NewHasher([]byte(p.HashKey), p.RateLimit)
 
@@ -32,17 +42,26 @@ func NewGRPC(p parameters.AgentParameters) (*GRPC, error) {
 		grpc.WithChainUnaryInterceptor(
 			ip.InterceptorAddRealIP,
 			h.InterceptorAddHashMD,
+			auth.InterceptorAddToken(p.Token),
+			tenant.InterceptorAddTenant(p.Tenant),
+			identity.InterceptorAddIdentity(identity.New(p.Instance, p.ReportInterval)),
 		),
 		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
 	)
 	if err != nil {
+		h.Close()
+		if rec != nil {
+			rec.Close()
+		}
+
 		return nil, fmt.Errorf("create grpc client conntection: %w", err)
 	}
 
 	return &GRPC{
-		client: proto.NewMetricsClient(conn),
-		hasher: h,
-		conn:   conn,
+		client:   proto.NewMetricsClient(conn),
+		hasher:   h,
+		conn:     conn,
+		recorder: rec,
 	}, nil
 }
 
@@ -54,6 +73,10 @@ func (gc *GRPC) Close() error {
 		return fmt.Errorf("close connetion: %w", err)
 	}
 
+	if gc.recorder != nil {
+		return gc.recorder.Close()
+	}
+
 	return nil
 }
 
@@ -67,9 +90,11 @@ func (gc *GRPC) SendGauge(ctx context.Context, name string, value float64) error
 
 	_, err := gc.client.Update(ctx, &proto.UpdateRequest{Metric: &metric})
 	if err != nil {
-		return fmt.Errorf("send gauge metric with grpc name %s value %f: %w", name, value, err)
+		return fmt.Errorf("send gauge metric with grpc name %s value %f: %w", name, value, hasher.ErrorByGRPC(err))
 	}
 
+	record(gc.recorder, Record{Gauges: map[string]float64{name: value}})
+
 	return nil
 }
 
@@ -83,17 +108,19 @@ func (gc *GRPC) SendCounter(ctx context.Context, name string, delta int64) error
 
 	_, err := gc.client.Update(ctx, &proto.UpdateRequest{Metric: &metric})
 	if err != nil {
-		return fmt.Errorf("send conter: %w", err)
+		return fmt.Errorf("send conter: %w", hasher.ErrorByGRPC(err))
 	}
 
+	record(gc.recorder, Record{Counters: map[string]int64{name: delta}})
+
 	return nil
 }
 
-// SendBatch sends metrics to server
-func (gc *GRPC) SendBatch(ctx context.Context, batch map[string]float64) error {
-	metrics := make([]*proto.Metric, 0, len(batch))
+// SendBatch sends gauges and counter increments to server in one request
+func (gc *GRPC) SendBatch(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	metrics := make([]*proto.Metric, 0, len(gauges)+len(counters))
 
-	for i, v := range batch {
+	for i, v := range gauges {
 		metrics = append(metrics, &proto.Metric{
 			Data: &proto.Metric_Value{Value: v},
 			Id:   i,
@@ -101,10 +128,25 @@ func (gc *GRPC) SendBatch(ctx context.Context, batch map[string]float64) error {
 		})
 	}
 
+	for i, d := range counters {
+		metrics = append(metrics, &proto.Metric{
+			Data: &proto.Metric_Delta{Delta: d},
+			Id:   i,
+			Type: proto.Types_COUNTER,
+		})
+	}
+
 	_, err := gc.client.Updates(ctx, &proto.UpdatesRequest{Metrics: metrics})
 	if err != nil {
-		return fmt.Errorf("send batch in grpc: %w", err)
+		return fmt.Errorf("send batch in grpc: %w", hasher.ErrorByGRPC(err))
 	}
 
+	record(gc.recorder, Record{Gauges: gauges, Counters: counters})
+
 	return nil
 }
+
+// AgentConfig requests config of agent from server
+func (gc *GRPC) AgentConfig(ctx context.Context, group, version string) (agentconfig.Document, error) {
+	return agentconfig.GetGRPC(ctx, gc.conn, group, version)
+}
@@ -219,7 +219,7 @@ func TestGRPCClient_SendBatch(t *testing.T) {
 		err = c.SendBatch(context.Background(), map[string]float64{
 			"test":  1.1,
 			"test2": 2.2,
-		})
+		}, map[string]int64{"test3": 3})
 		require.NoError(t, err)
 	})
 
@@ -257,7 +257,7 @@ func TestGRPCClient_SendBatch(t *testing.T) {
 		err = c.SendBatch(context.Background(), map[string]float64{
 			"test":  1.1,
 			"test2": 2.2,
-		})
+		}, map[string]int64{"test3": 3})
 		require.Error(t, err)
 	})
 }
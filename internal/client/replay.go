@@ -0,0 +1,77 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Replay sends recorded data again keeping intervals between records divided by speed,
+// zero speed sends data without delays. Data is sent by client, so it's hashed and encrypted as usual.
+func Replay(ctx context.Context, c Client, r io.Reader, speed float64) error {
+	var (
+		first time.Time
+		start = time.Now()
+		sent  int
+	)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+
+	for line := 1; sc.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("decode record on line %d: %w", line, err)
+		}
+
+		if first.IsZero() {
+			first = rec.Time
+		}
+
+		if speed > 0 {
+			wait := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			if err := sleepUntil(ctx, wait); err != nil {
+				return err
+			}
+		}
+
+		if len(rec.Gauges) != 0 || len(rec.Counters) != 0 {
+			if err := c.SendBatch(ctx, rec.Gauges, rec.Counters); err != nil {
+				return fmt.Errorf("replay record on line %d: %w", line, err)
+			}
+		}
+
+		sent++
+	}
+
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read records: %w", err)
+	}
+
+	logger.Log.Info("Replay finished", zap.Int("records", sent))
+
+	return nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/stretchr/testify/require"
+)
+
+type replayedClient struct {
+	Sink
+
+	mu       sync.Mutex
+	gauges   []map[string]float64
+	counters map[string]int64
+}
+
+func (c *replayedClient) SendBatch(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(gauges) != 0 {
+		c.gauges = append(c.gauges, gauges)
+	}
+
+	for name, delta := range counters {
+		c.counters[name] += delta
+	}
+
+	return nil
+}
+
+func TestHTTP_record(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	cmo := new(CompresserMockedObject)
+	cmo.On("GetCompressedJSON").Return([]byte("test"), nil)
+
+	emo := new(EncrypterMockedObject)
+	emo.On("EncryptMessage").Return([]byte("test"), nil)
+
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	rec, err := newRecorder(path)
+	require.NoError(t, err)
+
+	c := HTTP{
+		gp:        cmo,
+		encrypter: emo,
+		h:         hasher.NewHasher(make([]byte, 0), 1),
+		addr:      strings.TrimPrefix(ts.URL, "http://"),
+		recorder:  rec,
+	}
+	c.setRestyClient()
+
+	ctx := context.Background()
+	require.NoError(t, c.SendBatch(ctx, map[string]float64{"Alloc": 1}, nil))
+	require.NoError(t, c.SendCounter(ctx, "PollCount", 2))
+	require.NoError(t, c.SendBatch(ctx, map[string]float64{"Alloc": 3}, nil))
+	require.NoError(t, c.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 3)
+	require.Equal(t, map[string]int64{"PollCount": 2}, records[1].Counters)
+	require.False(t, records[0].Time.IsZero())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rc := &replayedClient{counters: make(map[string]int64)}
+	require.NoError(t, Replay(ctx, rc, f, 0))
+	require.Equal(t, []map[string]float64{{"Alloc": 1}, {"Alloc": 3}}, rc.gauges)
+	require.Equal(t, map[string]int64{"PollCount": 2}, rc.counters)
+}
+
+func TestHTTP_record_failedSend(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "test error", http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	cmo := new(CompresserMockedObject)
+	cmo.On("GetCompressedJSON").Return([]byte("test"), nil)
+
+	emo := new(EncrypterMockedObject)
+	emo.On("EncryptMessage").Return([]byte("test"), nil)
+
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	rec, err := newRecorder(path)
+	require.NoError(t, err)
+
+	c := HTTP{
+		gp:        cmo,
+		encrypter: emo,
+		h:         hasher.NewHasher(make([]byte, 0), 1),
+		addr:      strings.TrimPrefix(ts.URL, "http://"),
+		recorder:  rec,
+	}
+	c.setRestyClient()
+
+	// agent keeps the failed increment and sends it again together with the new one
+	ctx := context.Background()
+	require.Error(t, c.SendBatch(ctx, nil, map[string]int64{"PollCount": 2}))
+	require.NoError(t, c.SendBatch(ctx, nil, map[string]int64{"PollCount": 5}))
+	require.NoError(t, c.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 1, "failed send isn't recorded")
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rc := &replayedClient{counters: make(map[string]int64)}
+	require.NoError(t, Replay(ctx, rc, f, 0))
+	require.Equal(t, map[string]int64{"PollCount": 5}, rc.counters, "increment is applied once")
+}
+
+func TestReplay(t *testing.T) {
+	records := `{"time":"2024-01-01T00:00:00Z","gauges":{"Alloc":1}}
+{"time":"2024-01-01T00:00:01Z","counters":{"PollCount":1}}
+{"time":"2024-01-01T00:00:02Z","gauges":{"Alloc":2},"counters":{"PollCount":2}}
+`
+
+	t.Run("accelerated", func(t *testing.T) {
+		rc := &replayedClient{counters: make(map[string]int64)}
+
+		start := time.Now()
+		require.NoError(t, Replay(context.Background(), rc, strings.NewReader(records), 10))
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "2 seconds of records are replayed 10 times faster")
+
+		require.Equal(t, []map[string]float64{{"Alloc": 1}, {"Alloc": 2}}, rc.gauges)
+		require.Equal(t, map[string]int64{"PollCount": 3}, rc.counters)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		rc := &replayedClient{counters: make(map[string]int64)}
+		require.ErrorIs(t, Replay(ctx, rc, strings.NewReader(records), 1), context.DeadlineExceeded)
+		require.Len(t, rc.gauges, 1)
+	})
+
+	t.Run("invalid record", func(t *testing.T) {
+		rc := &replayedClient{counters: make(map[string]int64)}
+		require.Error(t, Replay(context.Background(), rc, strings.NewReader("{\n"), 0))
+	})
+}
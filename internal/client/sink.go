@@ -0,0 +1,247 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Record it's a batch written by local sink as json line
+type Record struct {
+	Time     time.Time          `json:"time"`
+	Gauges   map[string]float64 `json:"gauges,omitempty"`
+	Counters map[string]int64   `json:"counters,omitempty"`
+}
+
+// Sink writes metrics as json lines instead of sending them to server, so agent can work without network
+type Sink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	now    func() time.Time
+}
+
+// NewStdoutSink create Sink writing to stdout
+func NewStdoutSink() *Sink {
+	return &Sink{w: os.Stdout, now: time.Now}
+}
+
+// NewFileSink create Sink writing to file, the file is rotated after maxSize bytes
+// and maxBackups rotated files are kept
+func NewFileSink(path string, maxSize int64, maxBackups int) (*Sink, error) {
+	f, err := newRotatingFile(path, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sink{w: f, closer: f, now: time.Now}, nil
+}
+
+// SendBatch writes gauges and counters
+func (s *Sink) SendBatch(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	return s.write(Record{Gauges: gauges, Counters: counters})
+}
+
+// SendCounter writes counter
+func (s *Sink) SendCounter(_ context.Context, name string, delta int64) error {
+	return s.write(Record{Counters: map[string]int64{name: delta}})
+}
+
+// SendGauge writes gauge
+func (s *Sink) SendGauge(_ context.Context, name string, value float64) error {
+	return s.write(Record{Gauges: map[string]float64{name: value}})
+}
+
+// AgentConfig returns agentconfig.ErrNotFound, because there is no server
+func (s *Sink) AgentConfig(context.Context, string, string) (agentconfig.Document, error) {
+	return agentconfig.Document{}, agentconfig.ErrNotFound
+}
+
+// Close closes the output file, stdout isn't closed
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
+
+func (s *Sink) write(r Record) error {
+	r.Time = s.now()
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write record: %w", err)
+	}
+
+	return nil
+}
+
+// newRecorder creates sink recording sent data to file, empty path disables recording
+func newRecorder(path string) (*Sink, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	logger.Log.Info("Create recorder", zap.String("file", path))
+	s, err := NewFileSink(path, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("create recorder: %w", err)
+	}
+
+	return s, nil
+}
+
+// record writes successfully sent data to recorder, nil recorder doesn't record
+func record(s *Sink, r Record) {
+	if s == nil {
+		return
+	}
+
+	if err := s.write(r); err != nil {
+		logger.Log.Warn("Record sent data", zap.Error(err))
+	}
+}
+
+// Tee sends metrics to server and writes them to local sink.
+// Errors of local sink are logged, so they don't make agent resend data.
+type Tee struct {
+	Client
+	local *Sink
+}
+
+// NewTee create Tee
+func NewTee(c Client, local *Sink) *Tee {
+	return &Tee{Client: c, local: local}
+}
+
+// SendBatch sends gauges and counters to server and writes them to local sink
+func (t *Tee) SendBatch(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	t.logLocal(t.local.SendBatch(ctx, gauges, counters))
+	return t.Client.SendBatch(ctx, gauges, counters)
+}
+
+// SendCounter sends counter to server and writes it to local sink
+func (t *Tee) SendCounter(ctx context.Context, name string, delta int64) error {
+	t.logLocal(t.local.SendCounter(ctx, name, delta))
+	return t.Client.SendCounter(ctx, name, delta)
+}
+
+// SendGauge sends gauge to server and writes it to local sink
+func (t *Tee) SendGauge(ctx context.Context, name string, value float64) error {
+	t.logLocal(t.local.SendGauge(ctx, name, value))
+	return t.Client.SendGauge(ctx, name, value)
+}
+
+// Close closes client and local sink
+func (t *Tee) Close() error {
+	return errors.Join(t.Client.Close(), t.local.Close())
+}
+
+func (t *Tee) logLocal(err error) {
+	if err != nil {
+		logger.Log.Warn("Write to local sink", zap.Error(err))
+	}
+}
+
+// rotatingFile it's file which is renamed to path.1 after maxSize bytes,
+// older files are shifted to path.2 and so on up to maxBackups
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open output file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat output file: %w", err)
+	}
+
+	rf.f = f
+	rf.size = info.Size()
+
+	return nil
+}
+
+// Write writes b to file, b isn't split between files
+func (rf *rotatingFile) Write(b []byte) (int, error) {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(b)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(b)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return fmt.Errorf("close output file: %w", err)
+	}
+
+	if rf.maxBackups == 0 {
+		if err := os.Remove(rf.path); err != nil {
+			return fmt.Errorf("remove output file: %w", err)
+		}
+
+		return rf.open()
+	}
+
+	for i := rf.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("shift rotated output file: %w", err)
+		}
+	}
+
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+		return fmt.Errorf("rotate output file: %w", err)
+	}
+
+	return rf.open()
+}
+
+// Close closes file
+func (rf *rotatingFile) Close() error {
+	return rf.f.Close()
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var res []Record
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r Record
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &r))
+		res = append(res, r)
+	}
+
+	require.NoError(t, sc.Err())
+
+	return res
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// every record is longer than 40 bytes, so each one is written to new file
+	s, err := NewFileSink(path, 40, 2)
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	require.NoError(t, s.SendBatch(ctx, map[string]float64{"Alloc": 1.5}, nil))
+	require.NoError(t, s.SendCounter(ctx, "PollCount", 2))
+	require.NoError(t, s.SendGauge(ctx, "Alloc", 3))
+	require.NoError(t, s.SendCounter(ctx, "PollCount", 4))
+	require.NoError(t, s.Close())
+
+	require.Equal(t, []Record{{Time: now, Counters: map[string]int64{"PollCount": 4}}}, readRecords(t, path))
+	require.Equal(t, []Record{{Time: now, Gauges: map[string]float64{"Alloc": 3}}}, readRecords(t, path+".1"))
+	require.Equal(t, []Record{{Time: now, Counters: map[string]int64{"PollCount": 2}}}, readRecords(t, path+".2"))
+	require.NoFileExists(t, path+".3", "only maxBackups files are kept")
+
+	_, err = s.AgentConfig(ctx, "", "")
+	require.ErrorIs(t, err, agentconfig.ErrNotFound)
+
+	t.Run("append to existing file", func(t *testing.T) {
+		s, err := NewFileSink(path, 0, 0)
+		require.NoError(t, err)
+		s.now = func() time.Time { return now }
+
+		require.NoError(t, s.SendCounter(ctx, "PollCount", 5))
+		require.NoError(t, s.Close())
+		require.Len(t, readRecords(t, path), 2)
+	})
+}
+
+type failingClient struct {
+	Sink
+}
+
+func (c *failingClient) SendBatch(context.Context, map[string]float64, map[string]int64) error {
+	return errors.New("connection refused")
+}
+
+func TestTee(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+
+	local, err := NewFileSink(path, 0, 0)
+	require.NoError(t, err)
+
+	c := NewTee(&failingClient{}, local)
+
+	err = c.SendBatch(context.Background(), map[string]float64{"Alloc": 1}, nil)
+	require.Error(t, err, "error of server is returned")
+
+	require.NoError(t, c.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 1, "data is written locally even if server fails")
+	require.Equal(t, map[string]float64{"Alloc": 1}, records[0].Gauges)
+}
@@ -0,0 +1,13 @@
+// Package grpcmd contains helpers for working with gRPC metadata
+package grpcmd
+
+import "google.golang.org/grpc/metadata"
+
+// First returns the first value of key in md, empty string if there is no value
+func First(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) != 0 {
+		return v[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,20 @@
+package grpcmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestFirst(t *testing.T) {
+	md := metadata.Pairs("x-key", "first", "x-key", "second")
+
+	t.Run("first value", func(t *testing.T) {
+		require.Equal(t, "first", First(md, "X-Key"))
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		require.Empty(t, First(md, "x-other"))
+	})
+}
@@ -0,0 +1,87 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Hasher errors
+var (
+	ErrClockSkew       = errors.New("request timestamp is outside the allowed clock skew")
+	ErrReplayedRequest = errors.New("request nonce has already been used")
+	ErrNonceCacheFull  = errors.New("too many signed requests in the clock skew window")
+	ErrResponseHash    = errors.New("response hash verification failed")
+)
+
+// AppliedUpdateError it's error of update which the server has applied, but the response failed verification,
+// so the update mustn't be sent again
+type AppliedUpdateError struct {
+	Err error
+}
+
+func (e *AppliedUpdateError) Error() string {
+	return "update is applied: " + e.Err.Error()
+}
+
+func (e *AppliedUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorByStatusCode returns a replay protection error by the http status code of the response.
+// It returns nil if the status code isn't related to replay protection.
+func ErrorByStatusCode(code int) error {
+	switch code {
+	case http.StatusPreconditionFailed:
+		return ErrClockSkew
+	case http.StatusConflict:
+		return ErrReplayedRequest
+	case http.StatusTooManyRequests:
+		return ErrNonceCacheFull
+	default:
+		return nil
+	}
+}
+
+func statusCodeByError(err error) int {
+	switch {
+	case errors.Is(err, ErrClockSkew):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrReplayedRequest):
+		return http.StatusConflict
+	case errors.Is(err, ErrNonceCacheFull):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func grpcCodeByError(err error) codes.Code {
+	switch {
+	case errors.Is(err, ErrClockSkew):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrReplayedRequest):
+		return codes.AlreadyExists
+	case errors.Is(err, ErrNonceCacheFull):
+		return codes.ResourceExhausted
+	default:
+		return codes.Unauthenticated
+	}
+}
+
+// ErrorByGRPC wraps the grpc error with a replay protection error if the status code is related to it.
+func ErrorByGRPC(err error) error {
+	switch status.Code(err) {
+	case codes.FailedPrecondition:
+		return fmt.Errorf("%w: %w", ErrClockSkew, err)
+	case codes.AlreadyExists:
+		return fmt.Errorf("%w: %w", ErrReplayedRequest, err)
+	case codes.ResourceExhausted:
+		return fmt.Errorf("%w: %w", ErrNonceCacheFull, err)
+	default:
+		return err
+	}
+}
@@ -5,34 +5,85 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/DarkOmap/metricsService/internal/grpcmd"
 	"github.com/go-resty/resty/v2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	headerHashSHA256 = "HashSHA256"
+	headerTimestamp  = "X-Request-Timestamp"
+	headerNonce      = "X-Request-Nonce"
+
+	defaultClockSkew      = time.Minute
+	defaultNonceCacheSize = 10000
+	nonceSize             = 16
 )
 
 // Hasher It's structure witch defines methods for hashing data.
 type Hasher struct {
 	hasherPool chan hash.Hash
+	nonces     *nonceCache
 	key        []byte
+	clockSkew  time.Duration
+}
+
+// Option this is a function for configuring the Hasher
+type Option func(*Hasher)
+
+// WithClockSkew sets the maximum difference between the request timestamp and the server time.
+// Zero value keeps the default.
+func WithClockSkew(d time.Duration) Option {
+	return func(h *Hasher) {
+		if d > 0 {
+			h.clockSkew = d
+		}
+	}
+}
+
+// WithNonceCacheSize sets the maximum number of nonces remembered for detecting replayed requests.
+// Nonces are remembered while their timestamps pass the clock skew check,
+// requests above the limit are rejected. Zero value keeps the default.
+func WithNonceCacheSize(size uint) Option {
+	return func(h *Hasher) {
+		if size > 0 {
+			h.nonces = newNonceCache(size)
+		}
+	}
 }
 
 // NewHasher create Hasher
-func NewHasher(key []byte, rateLimit uint) *Hasher {
+func NewHasher(key []byte, rateLimit uint, opts ...Option) *Hasher {
 	hp := make(chan hash.Hash, rateLimit)
-	return &Hasher{hp, key}
+	h := &Hasher{
+		hasherPool: hp,
+		key:        key,
+		clockSkew:  defaultClockSkew,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.nonces == nil {
+		h.nonces = newNonceCache(defaultNonceCacheSize)
+	}
+
+	return h
 }
 
 // Close closes Hasher
@@ -40,58 +91,81 @@ func (h *Hasher) Close() {
 	close(h.hasherPool)
 }
 
-// HashingRequest adds HashSHA256 value in header.
-// HashSHA256 contains body hashed with key.
+// HashingRequest adds HashSHA256, timestamp and nonce values in header.
+// HashSHA256 contains body, timestamp and nonce hashed with key.
 func (h *Hasher) HashingRequest(req *resty.Request, body []byte) error {
 	if len(h.key) == 0 {
 		return nil
 	}
 
-	hash, err := h.getHash()
+	timestamp, nonce, err := newTimestampAndNonce()
+	if err != nil {
+		return fmt.Errorf("create nonce: %w", err)
+	}
+
+	sign, err := h.sign(body, timestamp, nonce)
 	if err != nil {
 		return fmt.Errorf("get hash: %w", err)
 	}
 
-	defer h.putHash(hash)
-	hash.Write(body)
-	req.SetHeader(headerHashSHA256, hex.EncodeToString(hash.Sum(nil)))
+	req.SetHeader(headerHashSHA256, hex.EncodeToString(sign))
+	req.SetHeader(headerTimestamp, timestamp)
+	req.SetHeader(headerNonce, nonce)
 
 	return nil
 }
 
-// InterceptorAddHashMD an interceptor that adds HashSHA256 to the header
+// InterceptorAddHashMD an interceptor that adds HashSHA256, timestamp and nonce to the header.
+// HashSHA256 contains method, message, timestamp and nonce hashed with key.
 func (h *Hasher) InterceptorAddHashMD(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 	if len(h.key) == 0 {
 		return invoker(ctx, method, req, reply, cc, opts...)
 	}
 
-	hash, err := h.getHash()
+	timestamp, nonce, err := newTimestampAndNonce()
 	if err != nil {
-		return fmt.Errorf("get hash: %w", err)
+		return fmt.Errorf("create nonce: %w", err)
 	}
 
-	defer h.putHash(hash)
-	hash.Write([]byte(method))
+	payload, err := grpcPayload(method, req)
+	if err != nil {
+		return err
+	}
+
+	sign, err := h.sign(payload, timestamp, nonce)
+	if err != nil {
+		return fmt.Errorf("get hash: %w", err)
+	}
 
 	ctx = metadata.AppendToOutgoingContext(
 		ctx,
-		headerHashSHA256, hex.EncodeToString(hash.Sum(nil)),
+		headerHashSHA256, hex.EncodeToString(sign),
+		headerTimestamp, timestamp,
+		headerNonce, nonce,
 	)
 
 	return invoker(ctx, method, req, reply, cc, opts...)
 }
 
 // RequestHash return handler for middleware.
-// Handle checks the Hash SHA256 request header for compliance with the specified key.
+// Handle checks the Hash SHA256 request header for compliance with the specified key,
+// requests without the header are rejected with 400 status when key is set.
+// Requests with a timestamp outside the clock skew window are rejected with 412 status,
+// requests with an already used nonce are rejected with 409 status
+// and requests above the nonce cache size are rejected with 429 status.
 func (h *Hasher) RequestHash(handler http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
-		hashHeader := r.Header.Get(headerHashSHA256)
-
-		if len(h.key) == 0 || hashHeader == "" {
+		if len(h.key) == 0 {
 			handler.ServeHTTP(w, r)
 			return
 		}
 
+		hashHeader := r.Header.Get(headerHashSHA256)
+		if hashHeader == "" {
+			http.Error(w, "missing "+headerHashSHA256+" header", http.StatusBadRequest)
+			return
+		}
+
 		var buf bytes.Buffer
 		_, err := buf.ReadFrom(r.Body)
 		if err != nil {
@@ -100,17 +174,15 @@ func (h *Hasher) RequestHash(handler http.Handler) http.Handler {
 		}
 
 		r.Body = io.NopCloser(&buf)
-		hash, err := h.getHash()
+
+		hh, err := hex.DecodeString(hashHeader)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		defer h.putHash(hash)
-
-		hash.Write(buf.Bytes())
-		dst := hash.Sum(nil)
-		hh, err := hex.DecodeString(hashHeader)
+		timestamp, nonce := r.Header.Get(headerTimestamp), r.Header.Get(headerNonce)
+		dst, err := h.sign(buf.Bytes(), timestamp, nonce)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -121,57 +193,109 @@ func (h *Hasher) RequestHash(handler http.Handler) http.Handler {
 			return
 		}
 
-		hw := hashingResponseWriter{
-			ResponseWriter: w,
-			key:            h.key,
-			hasher:         h,
+		if err := h.checkReplay(timestamp, nonce); err != nil {
+			http.Error(w, err.Error(), statusCodeByError(err))
+			return
 		}
 
-		handler.ServeHTTP(&hw, r)
+		handler.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(logFn)
 }
 
-// InterceptorCheckHash the interceptor for checking the HashSHA256 header
-func (h *Hasher) InterceptorCheckHash(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
-	if len(h.key) == 0 {
-		resp, err = handler(ctx, req)
-		return
+// ResponseHash return handler for middleware.
+// Handle buffers the response body and adds a single HashSHA256 header with the whole body hashed with key.
+// The middleware must be placed after the compression one so that the uncompressed body is hashed.
+func (h *Hasher) ResponseHash(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if len(h.key) == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		hw := hashingResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(&hw, r)
+
+		sign, err := h.hashBody(hw.body.Bytes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(headerHashSHA256, hex.EncodeToString(sign))
+		w.WriteHeader(hw.statusCode())
+
+		if _, err := w.Write(hw.body.Bytes()); err != nil {
+			return
+		}
 	}
 
-	md, ok := metadata.FromIncomingContext(ctx)
+	return http.HandlerFunc(fn)
+}
 
-	if !ok {
-		resp, err = handler(ctx, req)
-		return
+// VerifyResponse checks the HashSHA256 header of a successful response for compliance with the specified key.
+// It returns ErrResponseHash if the header is missing or doesn't match the body.
+func (h *Hasher) VerifyResponse(resp *resty.Response) error {
+	if len(h.key) == 0 || !resp.IsSuccess() {
+		return nil
+	}
+
+	hashHeader := resp.Header().Get(headerHashSHA256)
+	if hashHeader == "" {
+		return fmt.Errorf("%w: missing %s header", ErrResponseHash, headerHashSHA256)
 	}
 
-	hashMD := md.Get(headerHashSHA256)
+	hh, err := hex.DecodeString(hashHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrResponseHash, err)
+	}
 
-	if len(hashMD) == 0 {
+	dst, err := h.hashBody(resp.Body())
+	if err != nil {
+		return fmt.Errorf("get hash: %w", err)
+	}
+
+	if !hmac.Equal(hh, dst) {
+		return fmt.Errorf("%w: hash not equal", ErrResponseHash)
+	}
+
+	return nil
+}
+
+// InterceptorCheckHash the interceptor for checking the HashSHA256 header,
+// requests without the header are rejected with Unauthenticated code when key is set.
+// Requests with a timestamp outside the clock skew window are rejected with FailedPrecondition code,
+// requests with an already used nonce are rejected with AlreadyExists code
+// and requests above the nonce cache size are rejected with ResourceExhausted code.
+func (h *Hasher) InterceptorCheckHash(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	if len(h.key) == 0 {
 		resp, err = handler(ctx, req)
 		return
 	}
 
-	hashS := hashMD[0]
+	md, _ := metadata.FromIncomingContext(ctx)
 
+	hashS := grpcmd.First(md, headerHashSHA256)
 	if hashS == "" {
-		resp, err = handler(ctx, req)
+		err = status.Error(codes.Unauthenticated, "missing "+headerHashSHA256+" header")
 		return
 	}
 
-	hash, err := h.getHash()
+	hh, err := hex.DecodeString(hashS)
 	if err != nil {
 		err = status.Error(codes.Internal, err.Error())
 		return
 	}
 
-	defer h.putHash(hash)
+	timestamp, nonce := grpcmd.First(md, headerTimestamp), grpcmd.First(md, headerNonce)
+	payload, err := grpcPayload(info.FullMethod, req)
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
 
-	hash.Write([]byte(info.FullMethod))
-	dst := hash.Sum(nil)
-	hh, err := hex.DecodeString(hashS)
+	dst, err := h.sign(payload, timestamp, nonce)
 	if err != nil {
 		err = status.Error(codes.Internal, err.Error())
 		return
@@ -182,11 +306,87 @@ func (h *Hasher) InterceptorCheckHash(ctx context.Context, req any, info *grpc.U
 		return
 	}
 
+	if err = h.checkReplay(timestamp, nonce); err != nil {
+		err = status.Error(grpcCodeByError(err), err.Error())
+		return
+	}
+
 	resp, err = handler(ctx, req)
 
 	return
 }
 
+func (h *Hasher) hashBody(body []byte) ([]byte, error) {
+	hash, err := h.getHash()
+	if err != nil {
+		return nil, err
+	}
+
+	defer h.putHash(hash)
+
+	hash.Write(body)
+
+	return hash.Sum(nil), nil
+}
+
+func (h *Hasher) sign(payload []byte, timestamp, nonce string) ([]byte, error) {
+	hash, err := h.getHash()
+	if err != nil {
+		return nil, err
+	}
+
+	defer h.putHash(hash)
+
+	hash.Write(payload)
+	hash.Write([]byte("\n" + timestamp + "\n" + nonce))
+
+	return hash.Sum(nil), nil
+}
+
+// grpcPayload returns signed data of grpc request, message is marshaled deterministically
+func grpcPayload(method string, req any) ([]byte, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("request %T isn't proto message", req)
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	return append([]byte(method+"\n"), data...), nil
+}
+
+func (h *Hasher) checkReplay(timestamp, nonce string) error {
+	if timestamp == "" || nonce == "" {
+		return fmt.Errorf("missing timestamp or nonce")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse timestamp: %w", err)
+	}
+
+	now, sent := time.Now(), time.Unix(unix, 0)
+
+	skew := now.Sub(sent)
+	if skew > h.clockSkew || skew < -h.clockSkew {
+		return fmt.Errorf("%w: %s", ErrClockSkew, skew.Round(time.Second))
+	}
+
+	return h.nonces.add(nonce, sent.Add(h.clockSkew), now)
+}
+
+func newTimestampAndNonce() (string, string, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+
+	return strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(nonce), nil
+}
+
 func (h *Hasher) getHash() (hash.Hash, error) {
 	select {
 	case w, ok := <-h.hasherPool:
@@ -211,23 +411,24 @@ func (h *Hasher) putHash(ph hash.Hash) {
 
 type hashingResponseWriter struct {
 	http.ResponseWriter
-	hasher *Hasher
-	key    []byte
-	bytes  int
+	body   bytes.Buffer
+	status int
 }
 
 func (r *hashingResponseWriter) Write(b []byte) (int, error) {
-	h, err := r.hasher.getHash()
-	if err != nil {
-		return 0, fmt.Errorf("get hash: %w", err)
-	}
+	return r.body.Write(b)
+}
 
-	h.Write(b)
-	dst := h.Sum(nil)
+func (r *hashingResponseWriter) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+}
 
-	r.ResponseWriter.Header().Add(headerHashSHA256, hex.EncodeToString(dst))
+func (r *hashingResponseWriter) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
 
-	size, err := r.ResponseWriter.Write(b)
-	r.bytes += size
-	return size, err
+	return r.status
 }
@@ -8,15 +8,19 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/interop"
 	testgrpc "google.golang.org/grpc/interop/grpc_testing"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestHasher_HashingRequest(t *testing.T) {
@@ -46,8 +50,15 @@ func TestHasher_HashingRequest(t *testing.T) {
 
 		require.NotEmpty(t, hashHeader)
 
+		timestamp := req.Header.Get("X-Request-Timestamp")
+		nonce := req.Header.Get("X-Request-Nonce")
+
+		require.NotEmpty(t, timestamp)
+		require.NotEmpty(t, nonce)
+
 		hash := hmac.New(sha256.New, key)
 		hash.Write(body)
+		hash.Write([]byte("\n" + timestamp + "\n" + nonce))
 		dst := hash.Sum(nil)
 		hh, err := hex.DecodeString(hashHeader)
 
@@ -181,6 +192,23 @@ func TestHasher_RequestHash(t *testing.T) {
 		require.Equal(t, resp.StatusCode(), 500)
 	})
 
+	t.Run("unsigned request", func(t *testing.T) {
+		body := []byte("test")
+		h := NewHasher([]byte("test"), 1)
+		webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(body)
+		})
+		handler := h.RequestHash(webhook)
+
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		resp, err := resty.New().R().SetBody(body).Post(srv.URL)
+
+		require.NoError(t, err)
+		require.Equal(t, resp.StatusCode(), 400)
+	})
+
 	t.Run("error decode", func(t *testing.T) {
 		body := []byte("test")
 		h := NewHasher([]byte("test"), 1)
@@ -203,6 +231,142 @@ func TestHasher_RequestHash(t *testing.T) {
 	})
 }
 
+func TestHasher_RequestHashReplay(t *testing.T) {
+	body := []byte("test")
+	h := NewHasher([]byte("test"), 1, WithClockSkew(time.Minute))
+	webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})
+
+	srv := httptest.NewServer(h.RequestHash(webhook))
+	defer srv.Close()
+
+	signedRequest := func(timestamp, nonce string) *resty.Request {
+		sign, err := h.sign(body, timestamp, nonce)
+		require.NoError(t, err)
+
+		return resty.New().R().SetBody(body).
+			SetHeader("HashSHA256", hex.EncodeToString(sign)).
+			SetHeader("X-Request-Timestamp", timestamp).
+			SetHeader("X-Request-Nonce", nonce)
+	}
+
+	t.Run("replayed request", func(t *testing.T) {
+		req := resty.New().R().SetBody(body)
+		require.NoError(t, h.HashingRequest(req, body))
+
+		resp, err := req.Post(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+
+		resp, err = req.Post(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusConflict, resp.StatusCode())
+		require.ErrorIs(t, ErrorByStatusCode(resp.StatusCode()), ErrReplayedRequest)
+	})
+
+	t.Run("old timestamp", func(t *testing.T) {
+		ts := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+		resp, err := signedRequest(ts, "old").Post(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode())
+		require.ErrorIs(t, ErrorByStatusCode(resp.StatusCode()), ErrClockSkew)
+	})
+
+	t.Run("future timestamp", func(t *testing.T) {
+		ts := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+		resp, err := signedRequest(ts, "future").Post(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode())
+	})
+
+	t.Run("missing nonce", func(t *testing.T) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		resp, err := signedRequest(ts, "").Post(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	})
+
+	t.Run("full nonce cache", func(t *testing.T) {
+		h := NewHasher([]byte("test"), 1, WithNonceCacheSize(1))
+		srv := httptest.NewServer(h.RequestHash(webhook))
+		defer srv.Close()
+
+		for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			req := resty.New().R().SetBody(body)
+			require.NoError(t, h.HashingRequest(req, body))
+
+			resp, err := req.Post(srv.URL)
+			require.NoError(t, err)
+			require.Equal(t, want, resp.StatusCode(), "request %d", i)
+		}
+
+		require.ErrorIs(t, ErrorByStatusCode(http.StatusTooManyRequests), ErrNonceCacheFull)
+	})
+}
+
+func TestHasher_ResponseHash(t *testing.T) {
+	key := []byte("test")
+	h := NewHasher(key, 1)
+	webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("first "))
+		w.Write([]byte("second"))
+	})
+
+	srv := httptest.NewServer(h.ResponseHash(webhook))
+	defer srv.Close()
+
+	t.Run("one hash for whole body", func(t *testing.T) {
+		resp, err := resty.New().R().Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode())
+		require.Equal(t, "first second", string(resp.Body()))
+		require.Len(t, resp.Header().Values("HashSHA256"), 1)
+
+		hash := hmac.New(sha256.New, key)
+		hash.Write([]byte("first second"))
+		require.Equal(t, hex.EncodeToString(hash.Sum(nil)), resp.Header().Get("HashSHA256"))
+	})
+
+	t.Run("verify response", func(t *testing.T) {
+		resp, err := resty.New().R().Get(srv.URL)
+		require.NoError(t, err)
+		require.NoError(t, h.VerifyResponse(resp))
+
+		h2 := NewHasher([]byte("test2"), 1)
+		require.ErrorIs(t, h2.VerifyResponse(resp), ErrResponseHash)
+	})
+
+	t.Run("missing hash", func(t *testing.T) {
+		srv := httptest.NewServer(webhook)
+		defer srv.Close()
+
+		resp, err := resty.New().R().Get(srv.URL)
+		require.NoError(t, err)
+		require.ErrorIs(t, h.VerifyResponse(resp), ErrResponseHash)
+		require.NoError(t, NewHasher(nil, 1).VerifyResponse(resp))
+	})
+}
+
+func Test_nonceCache_add(t *testing.T) {
+	nc := newNonceCache(2)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, nc.add("1", now.Add(2*time.Minute), now))
+	require.ErrorIs(t, nc.add("1", now.Add(2*time.Minute), now), ErrReplayedRequest)
+	require.NoError(t, nc.add("2", now.Add(time.Minute), now))
+	require.ErrorIs(t, nc.add("3", now.Add(time.Minute), now), ErrNonceCacheFull, "unexpired nonces aren't evicted")
+	require.ErrorIs(t, nc.add("1", now.Add(2*time.Minute), now), ErrReplayedRequest)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, nc.add("3", now.Add(time.Minute), now), "expired nonce is evicted")
+	require.ErrorIs(t, nc.add("1", now.Add(2*time.Minute), now), ErrReplayedRequest)
+}
+
 func BenchmarkHashingRequest(b *testing.B) {
 	key := []byte("test")
 	h := NewHasher(key, 10)
@@ -428,7 +592,7 @@ func TestHasher_InterceptorCheckHash(t *testing.T) {
 		ctx := context.Background()
 		_, err = client.EmptyCall(ctx, &testgrpc.Empty{})
 
-		require.NoError(t, err)
+		require.Equal(t, codes.Unauthenticated, status.Code(err), "unsigned request is rejected")
 	})
 
 	t.Run("empty HashSHA256", func(t *testing.T) {
@@ -449,7 +613,7 @@ func TestHasher_InterceptorCheckHash(t *testing.T) {
 
 		_, err = client.EmptyCall(ctx, &testgrpc.Empty{})
 
-		require.NoError(t, err)
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
 	})
 
 	t.Run("error decode", func(t *testing.T) {
@@ -513,4 +677,93 @@ func TestHasher_InterceptorCheckHash(t *testing.T) {
 
 		require.NoError(t, err)
 	})
+
+	t.Run("replayed request", func(t *testing.T) {
+		conn, err := grpc.NewClient(
+			lis.Addr().String(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+
+		require.NoError(t, err)
+		defer conn.Close()
+
+		client := testgrpc.NewTestServiceClient(conn)
+
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		payload, err := grpcPayload("/grpc.testing.TestService/EmptyCall", &testgrpc.Empty{})
+		require.NoError(t, err)
+		sign, err := h.sign(payload, ts, "grpc-nonce")
+		require.NoError(t, err)
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			"HashSHA256", hex.EncodeToString(sign),
+			"X-Request-Timestamp", ts,
+			"X-Request-Nonce", "grpc-nonce",
+		)
+
+		_, err = client.EmptyCall(ctx, &testgrpc.Empty{})
+		require.NoError(t, err)
+
+		_, err = client.EmptyCall(ctx, &testgrpc.Empty{})
+		require.Equal(t, codes.AlreadyExists, status.Code(err))
+		require.ErrorIs(t, ErrorByGRPC(err), ErrReplayedRequest)
+	})
+
+	t.Run("old timestamp", func(t *testing.T) {
+		conn, err := grpc.NewClient(
+			lis.Addr().String(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+
+		require.NoError(t, err)
+		defer conn.Close()
+
+		client := testgrpc.NewTestServiceClient(conn)
+
+		ts := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+		payload, err := grpcPayload("/grpc.testing.TestService/EmptyCall", &testgrpc.Empty{})
+		require.NoError(t, err)
+		sign, err := h.sign(payload, ts, "old")
+		require.NoError(t, err)
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			"HashSHA256", hex.EncodeToString(sign),
+			"X-Request-Timestamp", ts,
+			"X-Request-Nonce", "old",
+		)
+
+		_, err = client.EmptyCall(ctx, &testgrpc.Empty{})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.ErrorIs(t, ErrorByGRPC(err), ErrClockSkew)
+	})
+
+	t.Run("changed message", func(t *testing.T) {
+		conn, err := grpc.NewClient(
+			lis.Addr().String(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+
+		require.NoError(t, err)
+		defer conn.Close()
+
+		client := testgrpc.NewTestServiceClient(conn)
+
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		payload, err := grpcPayload("/grpc.testing.TestService/UnaryCall", &testgrpc.SimpleRequest{FillUsername: true})
+		require.NoError(t, err)
+		sign, err := h.sign(payload, ts, "changed")
+		require.NoError(t, err)
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			"HashSHA256", hex.EncodeToString(sign),
+			"X-Request-Timestamp", ts,
+			"X-Request-Nonce", "changed",
+		)
+
+		_, err = client.UnaryCall(ctx, &testgrpc.SimpleRequest{FillServerId: true})
+		require.Equal(t, codes.Unauthenticated, status.Code(err), "message is signed")
+	})
 }
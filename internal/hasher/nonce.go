@@ -0,0 +1,74 @@
+package hasher
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// nonceCache remembers nonces until their requests can't pass the clock skew check.
+// Expired nonces are evicted, when the cache is full of unexpired nonces new requests are rejected,
+// so a nonce can't be replayed while its timestamp is still accepted.
+type nonceCache struct {
+	seen    map[string]struct{}
+	expires nonceHeap
+	size    int
+	mu      sync.Mutex
+}
+
+func newNonceCache(size uint) *nonceCache {
+	return &nonceCache{
+		seen: make(map[string]struct{}, size),
+		size: int(size),
+	}
+}
+
+// add stores the nonce until expires. It returns ErrReplayedRequest if the nonce is already in the cache
+// and ErrNonceCacheFull if the cache is full of unexpired nonces.
+func (nc *nonceCache) add(nonce string, expires, now time.Time) error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	for len(nc.expires) != 0 && !nc.expires[0].expires.After(now) {
+		old := heap.Pop(&nc.expires).(nonceEntry)
+		delete(nc.seen, old.nonce)
+	}
+
+	if _, ok := nc.seen[nonce]; ok {
+		return ErrReplayedRequest
+	}
+
+	if len(nc.expires) >= nc.size {
+		return ErrNonceCacheFull
+	}
+
+	heap.Push(&nc.expires, nonceEntry{nonce: nonce, expires: expires})
+	nc.seen[nonce] = struct{}{}
+
+	return nil
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// nonceHeap it's min-heap of nonces by expiration time
+type nonceHeap []nonceEntry
+
+func (h nonceHeap) Len() int           { return len(h) }
+func (h nonceHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h nonceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *nonceHeap) Push(x any) {
+	*h = append(*h, x.(nonceEntry))
+}
+
+func (h *nonceHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+
+	return e
+}
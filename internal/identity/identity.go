@@ -0,0 +1,148 @@
+// Package identity defines identity of the agent sending metrics, so the server can tell agents apart.
+package identity
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/DarkOmap/metricsService/internal/build"
+	"github.com/DarkOmap/metricsService/internal/grpcmd"
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	headerHostname       = "X-Agent-Hostname"
+	headerInstance       = "X-Agent-Instance"
+	headerVersion        = "X-Agent-Version"
+	headerReportInterval = "X-Agent-Report-Interval"
+)
+
+// Identity it's identity of agent
+type Identity struct {
+	Hostname string
+	Instance string
+	Version  string
+	// ReportInterval it's report interval of agent in seconds, zero if it's unknown
+	ReportInterval uint
+}
+
+// New returns identity of the running agent, empty instance is replaced with hostname
+func New(instance string, reportInterval uint) Identity {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return Identity{
+		Hostname:       hostname,
+		Instance:       cmp.Or(instance, hostname),
+		Version:        build.Version(),
+		ReportInterval: reportInterval,
+	}
+}
+
+type identityKey struct{}
+
+// NewContext returns a new context that carries the identity.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, false means that request isn't sent by agent.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// SetHeader sets the identity headers of the request.
+func SetHeader(h http.Header, id Identity) {
+	h.Set(headerHostname, id.Hostname)
+	h.Set(headerInstance, id.Instance)
+	h.Set(headerVersion, id.Version)
+	h.Set(headerReportInterval, strconv.FormatUint(uint64(id.ReportInterval), 10))
+}
+
+// InterceptorAddIdentity returns an interceptor that adds the identity to the metadata.
+func InterceptorAddIdentity(id Identity) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			headerHostname, id.Hostname,
+			headerInstance, id.Instance,
+			headerVersion, id.Version,
+			headerReportInterval, strconv.FormatUint(uint64(id.ReportInterval), 10),
+		)
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RequestIdentity middleware putting the identity of agent to the context and logging it.
+// Requests without the instance header aren't sent by agents and are passed as is.
+func RequestIdentity(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := Identity{
+			Hostname:       r.Header.Get(headerHostname),
+			Instance:       r.Header.Get(headerInstance),
+			Version:        r.Header.Get(headerVersion),
+			ReportInterval: parseInterval(r.Header.Get(headerReportInterval)),
+		}
+
+		if id.Instance != "" {
+			logRequest(r.RequestURI, id)
+			r = r.WithContext(NewContext(r.Context(), id))
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// InterceptorIdentity interceptor putting the identity of agent to the context and logging it.
+func InterceptorIdentity(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	id := Identity{
+		Hostname:       grpcmd.First(md, headerHostname),
+		Instance:       grpcmd.First(md, headerInstance),
+		Version:        grpcmd.First(md, headerVersion),
+		ReportInterval: parseInterval(grpcmd.First(md, headerReportInterval)),
+	}
+
+	if id.Instance == "" {
+		return handler(ctx, req)
+	}
+
+	logRequest(info.FullMethod, id)
+
+	return handler(NewContext(ctx, id), req)
+}
+
+// parseInterval returns zero for invalid interval, so agents of older versions are identified anyway
+func parseInterval(s string) uint {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(v)
+}
+
+// logRequest logs request of agent at debug level, so busy servers don't log every request
+func logRequest(method string, id Identity) {
+	logger.Log.Debug("Request from agent",
+		zap.String("method", method),
+		zap.String("instance", id.Instance),
+		zap.String("hostname", id.Hostname),
+		zap.String("version", id.Version),
+	)
+}
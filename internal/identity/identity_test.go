@@ -0,0 +1,131 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/interop"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+)
+
+func TestNew(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	id := New("", 10)
+	require.Equal(t, hostname, id.Hostname)
+	require.Equal(t, hostname, id.Instance, "hostname is default instance")
+	require.Equal(t, "N/A", id.Version)
+	require.Equal(t, uint(10), id.ReportInterval)
+
+	require.Equal(t, "agent-1", New("agent-1", 10).Instance)
+}
+
+func TestRequestIdentity(t *testing.T) {
+	h := RequestIdentity(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := FromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(id)
+	}))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	t.Run("without identity", func(t *testing.T) {
+		res, err := resty.New().R().Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode())
+	})
+
+	t.Run("with identity", func(t *testing.T) {
+		want := Identity{Hostname: "host", Instance: "agent-1", Version: "1.0.0", ReportInterval: 10}
+
+		req := resty.New().R()
+		SetHeader(req.Header, want)
+
+		var got Identity
+
+		res, err := req.SetResult(&got).Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, want, got)
+	})
+
+	t.Run("invalid report interval", func(t *testing.T) {
+		var got Identity
+
+		res, err := resty.New().R().
+			SetHeader(headerInstance, "agent-1").
+			SetHeader(headerReportInterval, "10s").
+			SetResult(&got).
+			Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, Identity{Instance: "agent-1"}, got, "agent is identified without report interval")
+	})
+}
+
+func TestInterceptorIdentity(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	var got []Identity
+
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		InterceptorIdentity,
+		func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			id, _ := FromContext(ctx)
+			got = append(got, id)
+
+			return handler(ctx, req)
+		},
+	))
+
+	testgrpc.RegisterTestServiceServer(
+		s,
+		interop.NewTestServer(),
+	)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			require.FailNow(t, err.Error())
+		}
+	}()
+
+	defer s.Stop()
+
+	want := Identity{Hostname: "host", Instance: "agent-1", Version: "1.0.0", ReportInterval: 10}
+
+	for _, opts := range [][]grpc.DialOption{
+		{grpc.WithUnaryInterceptor(InterceptorAddIdentity(want))},
+		{},
+	} {
+		conn, err := grpc.NewClient(
+			lis.Addr().String(),
+			append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...,
+		)
+		require.NoError(t, err)
+
+		client := testgrpc.NewTestServiceClient(conn)
+		_, err = client.EmptyCall(context.Background(), &testgrpc.Empty{})
+		require.NoError(t, err)
+
+		conn.Close()
+	}
+
+	require.Equal(t, []Identity{want, {}}, got)
+}
@@ -0,0 +1,78 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DarkOmap/metricsService/internal/auth"
+	"github.com/DarkOmap/metricsService/internal/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type grpcServer struct {
+	proto.UnimplementedInventoryServer
+	inv *Inventory
+}
+
+// RegisterServer registers the grpc service returning agents of inventory
+func RegisterServer(s grpc.ServiceRegistrar, inv *Inventory) {
+	proto.RegisterInventoryServer(s, &grpcServer{inv: inv})
+}
+
+// Agents returns agents of inventory, it requires admin scope
+func (s *grpcServer) Agents(ctx context.Context, _ *empty.Empty) (*proto.AgentsResponse, error) {
+	if err := auth.Check(ctx, auth.ScopeAdmin); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	agents := s.inv.Agents()
+	resp := &proto.AgentsResponse{Agents: make([]*proto.Agent, 0, len(agents))}
+
+	for _, a := range agents {
+		resp.Agents = append(resp.Agents, &proto.Agent{
+			Tenant:         a.Tenant,
+			Instance:       a.Instance,
+			Hostname:       a.Hostname,
+			Version:        a.Version,
+			Address:        a.Address,
+			Transport:      a.Transport,
+			FirstSeen:      timestamppb.New(a.FirstSeen),
+			LastSeen:       timestamppb.New(a.LastSeen),
+			Stale:          a.Stale,
+			ReportInterval: uint32(a.ReportInterval),
+		})
+	}
+
+	return resp, nil
+}
+
+// AgentsGRPC requests agents of inventory by grpc connection
+func AgentsGRPC(ctx context.Context, cc grpc.ClientConnInterface) ([]Agent, error) {
+	resp, err := proto.NewInventoryClient(cc).Agents(ctx, &empty.Empty{})
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+
+	agents := make([]Agent, 0, len(resp.GetAgents()))
+
+	for _, a := range resp.GetAgents() {
+		agents = append(agents, Agent{
+			Tenant:         a.GetTenant(),
+			Instance:       a.GetInstance(),
+			Hostname:       a.GetHostname(),
+			Version:        a.GetVersion(),
+			Address:        a.GetAddress(),
+			Transport:      a.GetTransport(),
+			FirstSeen:      a.GetFirstSeen().AsTime(),
+			LastSeen:       a.GetLastSeen().AsTime(),
+			Stale:          a.GetStale(),
+			ReportInterval: uint(a.GetReportInterval()),
+		})
+	}
+
+	return agents, nil
+}
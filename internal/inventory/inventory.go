@@ -0,0 +1,200 @@
+// Package inventory keeps agents seen by the server, so it's known which agents are alive.
+package inventory
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/auth"
+	"github.com/DarkOmap/metricsService/internal/identity"
+	"github.com/DarkOmap/metricsService/internal/ip"
+	"github.com/DarkOmap/metricsService/internal/tenant"
+	"google.golang.org/grpc"
+)
+
+// Transports of agents
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+const (
+	// removeStalePeriods it's number of stale periods without requests after which agent is removed
+	removeStalePeriods = 10
+	// maxAgents it's max number of agents, the least recently seen agent is removed for a new one
+	maxAgents = 10000
+)
+
+// Agent it's agent seen by the server.
+// Agent is stale if it hasn't sent requests for the stale period.
+type Agent struct {
+	Tenant    string `json:"tenant"`
+	Instance  string `json:"instance"`
+	Hostname  string `json:"hostname"`
+	Version   string `json:"version"`
+	Address   string `json:"address"`
+	Transport string `json:"transport"`
+	// ReportInterval it's report interval of agent in seconds, zero if agent doesn't send it
+	ReportInterval uint      `json:"report_interval"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+	Stale          bool      `json:"stale"`
+}
+
+type agentKey struct {
+	tenant, instance string
+}
+
+// Inventory it's in memory list of agents, agents are identified by tenant and instance.
+// Stale period of agent is staleIntervals of its report interval, reportInterval is used
+// for agents which don't send it. Agents are removed after removeStalePeriods without requests
+// and when there are maxAgents, so the inventory is limited even if agents are never stale.
+type Inventory struct {
+	mu             sync.Mutex
+	agents         map[agentKey]*Agent
+	reportInterval time.Duration
+	staleIntervals uint
+	ipc            *ip.Checker
+	now            func() time.Time
+}
+
+// NewInventory create Inventory, zero staleIntervals means that agents are never stale
+// and are removed only when the inventory is full.
+// Addresses of agents are determined by ipc, so addresses behind trusted proxies are recorded.
+func NewInventory(reportInterval time.Duration, staleIntervals uint, ipc *ip.Checker) *Inventory {
+	return &Inventory{
+		agents:         make(map[agentKey]*Agent),
+		reportInterval: reportInterval,
+		staleIntervals: staleIntervals,
+		ipc:            ipc,
+		now:            time.Now,
+	}
+}
+
+// staleAfter returns stale period of agent, zero means that agent is never stale
+func (inv *Inventory) staleAfter(a *Agent) time.Duration {
+	interval := inv.reportInterval
+	if a.ReportInterval != 0 {
+		interval = time.Duration(a.ReportInterval) * time.Second
+	}
+
+	return interval * time.Duration(inv.staleIntervals)
+}
+
+// removeStale removes agents without requests for removeStalePeriods, it's called under lock
+func (inv *Inventory) removeStale(now time.Time) {
+	for key, a := range inv.agents {
+		if after := inv.staleAfter(a); after > 0 && now.Sub(a.LastSeen) > after*removeStalePeriods {
+			delete(inv.agents, key)
+		}
+	}
+}
+
+// removeOldest removes the least recently seen agent, it's called under lock
+func (inv *Inventory) removeOldest() {
+	var (
+		oldest agentKey
+		seen   time.Time
+	)
+
+	for key, a := range inv.agents {
+		if seen.IsZero() || a.LastSeen.Before(seen) {
+			oldest, seen = key, a.LastSeen
+		}
+	}
+
+	delete(inv.agents, oldest)
+}
+
+// Seen records request of agent with the identity from ctx, requests without identity are skipped
+func (inv *Inventory) Seen(ctx context.Context, addr, transport string) {
+	id, ok := identity.FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	key := agentKey{tenant: tenant.FromContext(ctx), instance: id.Instance}
+	now := inv.now()
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	a, ok := inv.agents[key]
+	if !ok {
+		// agents are removed when new ones are added, so the inventory doesn't grow with gone agents
+		inv.removeStale(now)
+		if len(inv.agents) >= maxAgents {
+			inv.removeOldest()
+		}
+
+		a = &Agent{Tenant: key.tenant, Instance: key.instance, FirstSeen: now}
+		inv.agents[key] = a
+	}
+
+	a.Hostname = id.Hostname
+	a.Version = id.Version
+	a.ReportInterval = id.ReportInterval
+	a.Address = addr
+	a.Transport = transport
+	a.LastSeen = now
+}
+
+// Agents returns agents sorted by tenant and instance
+func (inv *Inventory) Agents() []Agent {
+	now := inv.now()
+
+	inv.mu.Lock()
+	inv.removeStale(now)
+	res := make([]Agent, 0, len(inv.agents))
+
+	for _, a := range inv.agents {
+		after := inv.staleAfter(a)
+
+		res = append(res, *a)
+		res[len(res)-1].Stale = after > 0 && now.Sub(a.LastSeen) > after
+	}
+	inv.mu.Unlock()
+
+	slices.SortFunc(res, func(a, b Agent) int {
+		return cmp.Or(cmp.Compare(a.Tenant, b.Tenant), cmp.Compare(a.Instance, b.Instance))
+	})
+
+	return res
+}
+
+// RequestTrack middleware recording requests of agents, it must be used after identity middleware
+// and authorization of write requests
+func (inv *Inventory) RequestTrack(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		var addr string
+		if clientIP := inv.ipc.RequestIP(r); clientIP != nil {
+			addr = clientIP.String()
+		}
+
+		inv.Seen(r.Context(), addr, TransportHTTP)
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// InterceptorTrack interceptor recording requests of agents, it must be used after identity interceptor.
+// Only requests of callers with write scope are recorded.
+func (inv *Inventory) InterceptorTrack(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if auth.Check(ctx, auth.ScopeWrite) != nil {
+		return handler(ctx, req)
+	}
+
+	var addr string
+	if clientIP := inv.ipc.IncomingIP(ctx); clientIP != nil {
+		addr = clientIP.String()
+	}
+
+	inv.Seen(ctx, addr, TransportGRPC)
+
+	return handler(ctx, req)
+}
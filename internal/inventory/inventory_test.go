@@ -0,0 +1,188 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/auth"
+	"github.com/DarkOmap/metricsService/internal/identity"
+	"github.com/DarkOmap/metricsService/internal/ip"
+	"github.com/DarkOmap/metricsService/internal/tenant"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/interop"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+)
+
+func TestInventory_Agents(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	inv := NewInventory(10*time.Second, 3, ip.NewChecker(nil, nil, nil))
+	inv.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	agent1 := identity.NewContext(ctx, identity.Identity{Hostname: "host-1", Instance: "agent-1", Version: "1.0.0"})
+	agent2 := identity.NewContext(tenant.NewContext(ctx, "team_a"), identity.Identity{Hostname: "host-2", Instance: "agent-2", Version: "1.0.0"})
+	agent3 := identity.NewContext(ctx, identity.Identity{Hostname: "host-3", Instance: "agent-3", Version: "1.0.0", ReportInterval: 60})
+
+	inv.Seen(ctx, "10.0.0.1", TransportHTTP)
+	inv.Seen(agent2, "10.0.0.2", TransportGRPC)
+	inv.Seen(agent1, "10.0.0.1", TransportHTTP)
+	inv.Seen(agent3, "10.0.0.4", TransportHTTP)
+
+	now = start.Add(20 * time.Second)
+	agent1 = identity.NewContext(ctx, identity.Identity{Hostname: "host-1", Instance: "agent-1", Version: "1.1.0"})
+	inv.Seen(agent1, "10.0.0.3", TransportGRPC)
+
+	now = start.Add(40 * time.Second)
+
+	require.Equal(t, []Agent{
+		{
+			Tenant:    tenant.Default,
+			Instance:  "agent-1",
+			Hostname:  "host-1",
+			Version:   "1.1.0",
+			Address:   "10.0.0.3",
+			Transport: TransportGRPC,
+			FirstSeen: start,
+			LastSeen:  start.Add(20 * time.Second),
+		},
+		{
+			Tenant:         tenant.Default,
+			Instance:       "agent-3",
+			Hostname:       "host-3",
+			Version:        "1.0.0",
+			Address:        "10.0.0.4",
+			Transport:      TransportHTTP,
+			ReportInterval: 60,
+			FirstSeen:      start,
+			LastSeen:       start,
+		},
+		{
+			Tenant:    "team_a",
+			Instance:  "agent-2",
+			Hostname:  "host-2",
+			Version:   "1.0.0",
+			Address:   "10.0.0.2",
+			Transport: TransportGRPC,
+			FirstSeen: start,
+			LastSeen:  start,
+			Stale:     true,
+		},
+	}, inv.Agents(), "requests without identity aren't recorded, stale period is based on report interval of agent")
+
+	t.Run("gone agents are removed", func(t *testing.T) {
+		now = start.Add(301 * time.Second)
+		inv.Seen(identity.NewContext(ctx, identity.Identity{Instance: "agent-4"}), "10.0.0.5", TransportHTTP)
+
+		agents := inv.Agents()
+		require.Len(t, agents, 3)
+		require.Equal(t, "agent-1", agents[0].Instance, "agent is removed after ten stale periods")
+		require.Equal(t, "agent-3", agents[1].Instance)
+		require.Equal(t, "agent-4", agents[2].Instance)
+	})
+}
+
+func TestInventory_Seen_maxAgents(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	inv := NewInventory(10*time.Second, 0, ip.NewChecker(nil, nil, nil))
+	inv.now = func() time.Time { return now }
+
+	for i := range maxAgents + 1 {
+		now = now.Add(time.Second)
+		inv.Seen(identity.NewContext(context.Background(), identity.Identity{Instance: fmt.Sprintf("agent-%d", i)}), "10.0.0.1", TransportHTTP)
+	}
+
+	agents := inv.Agents()
+	require.Len(t, agents, maxAgents, "inventory is limited if agents are never stale")
+	require.NotContains(t, agents, Agent{
+		Tenant:    tenant.Default,
+		Instance:  "agent-0",
+		Address:   "10.0.0.1",
+		Transport: TransportHTTP,
+		FirstSeen: now.Add(-maxAgents * time.Second),
+		LastSeen:  now.Add(-maxAgents * time.Second),
+	}, "the least recently seen agent is removed")
+}
+
+func TestInventory_RequestTrack(t *testing.T) {
+	_, loopback, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+
+	inv := NewInventory(0, 0, ip.NewChecker(nil, nil, []*net.IPNet{loopback}))
+	h := identity.RequestIdentity(inv.RequestTrack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req := resty.New().R().SetHeader("X-Real-IP", "10.0.0.1")
+	identity.SetHeader(req.Header, identity.Identity{Hostname: "host", Instance: "agent-1", Version: "1.0.0", ReportInterval: 10})
+
+	_, err = req.Get(srv.URL)
+	require.NoError(t, err)
+
+	agents := inv.Agents()
+	require.Len(t, agents, 1)
+	require.Equal(t, "agent-1", agents[0].Instance)
+	require.Equal(t, "10.0.0.1", agents[0].Address, "address of agent behind trusted proxy is taken from header")
+	require.Equal(t, TransportHTTP, agents[0].Transport)
+	require.Equal(t, uint(10), agents[0].ReportInterval)
+	require.False(t, agents[0].Stale, "agents aren't stale with zero period")
+}
+
+func TestInventory_InterceptorTrack(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	inv := NewInventory(10*time.Second, 3, ip.NewChecker(nil, nil, nil))
+
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(identity.InterceptorIdentity, inv.InterceptorTrack))
+	testgrpc.RegisterTestServiceServer(s, interop.NewTestServer())
+	RegisterServer(s, inv)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			require.FailNow(t, err.Error())
+		}
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(
+		lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(identity.InterceptorAddIdentity(identity.Identity{Hostname: "host", Instance: "agent-1", Version: "1.0.0"})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = testgrpc.NewTestServiceClient(conn).EmptyCall(context.Background(), &testgrpc.Empty{})
+	require.NoError(t, err)
+
+	agents, err := AgentsGRPC(context.Background(), conn)
+	require.NoError(t, err)
+	require.Len(t, agents, 1)
+	require.Equal(t, "agent-1", agents[0].Instance)
+	require.Equal(t, "127.0.0.1", agents[0].Address)
+	require.Equal(t, TransportGRPC, agents[0].Transport)
+	require.False(t, agents[0].LastSeen.IsZero())
+
+	t.Run("caller without write scope", func(t *testing.T) {
+		inv := NewInventory(10*time.Second, 3, ip.NewChecker(nil, nil, nil))
+		ctx := identity.NewContext(context.Background(), identity.Identity{Instance: "reader"})
+		ctx = auth.NewContext(ctx, &auth.Identity{Scopes: []auth.Scope{auth.ScopeRead}})
+
+		_, err := inv.InterceptorTrack(ctx, nil, nil, func(context.Context, any) (any, error) { return nil, nil })
+		require.NoError(t, err)
+		require.Empty(t, inv.Agents(), "requests of callers without write scope aren't recorded")
+	})
+}
@@ -5,18 +5,22 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 
+	"github.com/DarkOmap/metricsService/internal/grpcmd"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 const (
-	headerXRealIP = "X-Real-IP"
+	headerXRealIP       = "X-Real-IP"
+	headerXForwardedFor = "X-Forwarded-For"
 )
 
 var (
@@ -56,32 +60,108 @@ func InterceptorAddRealIP(ctx context.Context, method string, req, reply any, cc
 	return invoker(ctx, method, req, reply, cc, opts...)
 }
 
-// Checker structure with methods for IP validation
+// Checker structure with methods for IP validation.
+// An IP is allowed if it isn't in any denied subnet and the list of allowed subnets is empty or contains it.
+// X-Real-IP and X-Forwarded-For headers are used only if the peer is a trusted proxy.
 type Checker struct {
-	ipNet *net.IPNet
+	allowed        []*net.IPNet
+	denied         []*net.IPNet
+	trustedProxies []*net.IPNet
 }
 
 // NewChecker create IPChecker
-func NewChecker(ipNet *net.IPNet) *Checker {
-	return &Checker{ipNet: ipNet}
+func NewChecker(allowed, denied, trustedProxies []*net.IPNet) *Checker {
+	return &Checker{
+		allowed:        allowed,
+		denied:         denied,
+		trustedProxies: trustedProxies,
+	}
+}
+
+func (ipc *Checker) enabled() bool {
+	return len(ipc.allowed) != 0 || len(ipc.denied) != 0
+}
+
+// Allowed checks whether the IP is allowed by the checker's subnets.
+func (ipc *Checker) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return !ipc.enabled()
+	}
+
+	if contains(ipc.denied, ip) {
+		return false
+	}
+
+	return len(ipc.allowed) == 0 || contains(ipc.allowed, ip)
+}
+
+// ClientIP returns the client IP by the peer address and the proxy headers.
+// The headers are used only if the peer is in the trusted proxies.
+func (ipc *Checker) ClientIP(peerIP net.IP, realIP, forwardedFor string) net.IP {
+	if peerIP == nil || !contains(ipc.trustedProxies, peerIP) {
+		return peerIP
+	}
+
+	if realIP != "" {
+		return net.ParseIP(strings.TrimSpace(realIP))
+	}
+
+	if forwardedFor == "" {
+		return peerIP
+	}
+
+	// The rightmost address that isn't a trusted proxy was added by the first trusted proxy.
+	ips := strings.Split(forwardedFor, ",")
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(ips[i]))
+		if ip == nil {
+			return nil
+		}
+
+		if !contains(ipc.trustedProxies, ip) || i == 0 {
+			return ip
+		}
+	}
+
+	return peerIP
+}
+
+// RequestIP returns the client IP of the http request, nil if it can't be determined
+func (ipc *Checker) RequestIP(r *http.Request) net.IP {
+	return ipc.ClientIP(
+		hostIP(r.RemoteAddr),
+		r.Header.Get(headerXRealIP),
+		r.Header.Get(headerXForwardedFor),
+	)
+}
+
+// IncomingIP returns the client IP of the incoming grpc request, nil if it can't be determined
+func (ipc *Checker) IncomingIP(ctx context.Context) net.IP {
+	var peerIP net.IP
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerIP = hostIP(p.Addr.String())
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return ipc.ClientIP(peerIP, grpcmd.First(md, headerXRealIP), strings.Join(md.Get(headerXForwardedFor), ","))
 }
 
 // RequsetIPCheck middleware checking IP
 func (ipc *Checker) RequsetIPCheck(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		if ipc.ipNet == nil {
+		if !ipc.enabled() {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		realIP := r.Header.Get(headerXRealIP)
-
-		if realIP == "" {
-			http.Error(w, "empty header", http.StatusForbidden)
+		ip := ipc.RequestIP(r)
+		if ip == nil {
+			http.Error(w, "can't determine client IP", http.StatusForbidden)
 			return
 		}
 
-		if !ipc.ipNet.Contains(net.ParseIP(realIP)) {
+		if !ipc.Allowed(ip) {
 			http.Error(w, "network doesn't include given IP", http.StatusForbidden)
 			return
 		}
@@ -94,21 +174,18 @@ func (ipc *Checker) RequsetIPCheck(next http.Handler) http.Handler {
 
 // InterceptorIPCheck interceptor checking IP
 func (ipc *Checker) InterceptorIPCheck(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-
-	if !ok {
-		err = status.Error(codes.PermissionDenied, "missing metadata")
+	if !ipc.enabled() {
+		resp, err = handler(ctx, req)
 		return
 	}
 
-	ip := md.Get(headerXRealIP)
-
-	if len(ip) == 0 {
-		err = status.Error(codes.PermissionDenied, "missing X-Real-IP")
+	ip := ipc.IncomingIP(ctx)
+	if ip == nil {
+		err = status.Error(codes.PermissionDenied, "can't determine client IP")
 		return
 	}
 
-	if !ipc.ipNet.Contains(net.ParseIP(ip[0])) {
+	if !ipc.Allowed(ip) {
 		err = status.Error(codes.PermissionDenied, "network doesn't include given IP")
 		return
 	}
@@ -117,3 +194,22 @@ func (ipc *Checker) InterceptorIPCheck(ctx context.Context, req any, _ *grpc.Una
 
 	return
 }
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hostIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	return net.ParseIP(host)
+}
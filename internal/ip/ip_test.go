@@ -25,110 +25,111 @@ func TestGetLocalIP(t *testing.T) {
 	})
 }
 
-func TestIPChecker_RequsetIPCheck(t *testing.T) {
-	t.Run("positive test", func(t *testing.T) {
-		_, ts, err := net.ParseCIDR("192.168.1.0/24")
-
-		require.NoError(t, err)
-
-		ipc := NewChecker(ts)
-
-		webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-		})
-
-		handler := ipc.RequsetIPCheck(webhook)
-
-		srv := httptest.NewServer(handler)
-		defer srv.Close()
-
-		c := resty.New()
-
-		req := c.R().SetHeader("X-Real-IP", "192.168.1.0")
-		resp, err := req.Post(srv.URL)
-
-		require.NoError(t, err)
-		require.Equal(t, resp.StatusCode(), 200)
-	})
-
-	t.Run("test nil ipNET", func(t *testing.T) {
-		ipc := NewChecker(nil)
-
-		webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-		})
-
-		handler := ipc.RequsetIPCheck(webhook)
-
-		srv := httptest.NewServer(handler)
-		defer srv.Close()
-
-		c := resty.New()
-
-		req := c.R()
-		resp, err := req.Post(srv.URL)
-
-		require.NoError(t, err)
-		require.Equal(t, resp.StatusCode(), 200)
-	})
-
-	t.Run("test empty real ip", func(t *testing.T) {
-		_, ts, err := net.ParseCIDR("192.168.1.0/24")
-
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
 		require.NoError(t, err)
+		nets = append(nets, n)
+	}
 
-		ipc := NewChecker(ts)
+	return nets
+}
 
-		webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
+func TestChecker_ClientIP(t *testing.T) {
+	ipc := NewChecker(nil, nil, mustParseCIDRs(t, "10.0.0.0/8", "fd00::/8"))
+
+	tests := []struct {
+		name         string
+		peer         string
+		realIP       string
+		forwardedFor string
+		want         string
+	}{
+		{name: "untrusted peer ignores headers", peer: "1.1.1.1", realIP: "192.168.1.1", forwardedFor: "192.168.1.2", want: "1.1.1.1"},
+		{name: "trusted peer with X-Real-IP", peer: "10.0.0.1", realIP: "192.168.1.1", want: "192.168.1.1"},
+		{name: "trusted peer with X-Forwarded-For", peer: "10.0.0.1", forwardedFor: "8.8.8.8, 192.168.1.2, 10.0.0.2", want: "192.168.1.2"},
+		{name: "trusted peer without headers", peer: "10.0.0.1", want: "10.0.0.1"},
+		{name: "ipv6 trusted peer", peer: "fd00::1", forwardedFor: "2001:db8::1", want: "2001:db8::1"},
+		{name: "invalid header", peer: "10.0.0.1", realIP: "invalid", want: "<nil>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ipc.ClientIP(net.ParseIP(tt.peer), tt.realIP, tt.forwardedFor)
+			require.Equal(t, tt.want, got.String())
 		})
+	}
+}
 
-		handler := ipc.RequsetIPCheck(webhook)
-
-		srv := httptest.NewServer(handler)
-		defer srv.Close()
+func TestChecker_Allowed(t *testing.T) {
+	ipc := NewChecker(
+		mustParseCIDRs(t, "192.168.0.0/16", "2001:db8::/32"),
+		mustParseCIDRs(t, "192.168.2.0/24"),
+		nil,
+	)
 
-		c := resty.New()
+	require.True(t, ipc.Allowed(net.ParseIP("192.168.1.1")))
+	require.True(t, ipc.Allowed(net.ParseIP("2001:db8::1")))
+	require.False(t, ipc.Allowed(net.ParseIP("192.168.2.1")))
+	require.False(t, ipc.Allowed(net.ParseIP("10.0.0.1")))
+	require.False(t, ipc.Allowed(nil))
 
-		req := c.R().SetHeader("X-Real-IP", "")
-		resp, err := req.Post(srv.URL)
+	denyOnly := NewChecker(nil, mustParseCIDRs(t, "10.0.0.0/8"), nil)
+	require.True(t, denyOnly.Allowed(net.ParseIP("192.168.1.1")))
+	require.False(t, denyOnly.Allowed(net.ParseIP("10.0.0.1")))
+}
 
-		require.NoError(t, err)
-		require.Equal(t, resp.StatusCode(), 403)
+func TestIPChecker_RequsetIPCheck(t *testing.T) {
+	webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
 	})
 
-	t.Run("test not contain ip", func(t *testing.T) {
-		_, ts, err := net.ParseCIDR("192.168.1.0/24")
-
-		require.NoError(t, err)
-
-		ipc := NewChecker(ts)
-
-		webhook := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
+	tests := []struct {
+		name                    string
+		allowed, denied, trusts []string
+		realIP                  string
+		want                    int
+	}{
+		{name: "no subnets", want: http.StatusOK},
+		{name: "peer address allowed", allowed: []string{"127.0.0.0/8"}, want: http.StatusOK},
+		{name: "ipv6 subnet doesn't include peer", allowed: []string{"::1/128"}, want: http.StatusForbidden},
+		{name: "peer address denied", denied: []string{"127.0.0.0/8"}, want: http.StatusForbidden},
+		{name: "header from untrusted peer", allowed: []string{"192.168.1.0/24"}, realIP: "192.168.1.1", want: http.StatusForbidden},
+		{name: "header from trusted proxy", allowed: []string{"192.168.1.0/24"}, trusts: []string{"127.0.0.0/8"}, realIP: "192.168.1.1", want: http.StatusOK},
+		{name: "header not in subnet", allowed: []string{"192.168.1.0/24"}, trusts: []string{"127.0.0.0/8"}, realIP: "1.1.1.1", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipc := NewChecker(
+				mustParseCIDRs(t, tt.allowed...),
+				mustParseCIDRs(t, tt.denied...),
+				mustParseCIDRs(t, tt.trusts...),
+			)
+
+			srv := httptest.NewServer(ipc.RequsetIPCheck(webhook))
+			defer srv.Close()
+
+			req := resty.New().R()
+			if tt.realIP != "" {
+				req.SetHeader("X-Real-IP", tt.realIP)
+			}
+
+			resp, err := req.Post(srv.URL)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, resp.StatusCode())
 		})
-
-		handler := ipc.RequsetIPCheck(webhook)
-
-		srv := httptest.NewServer(handler)
-		defer srv.Close()
-
-		c := resty.New()
-
-		req := c.R().SetHeader("X-Real-IP", "1.1.1.1")
-		resp, err := req.Post(srv.URL)
-
-		require.NoError(t, err)
-		require.Equal(t, resp.StatusCode(), 403)
-	})
+	}
 }
 
 func TestIPChecker_InterceptorIPCheck(t *testing.T) {
-	_, ts, err := net.ParseCIDR("192.168.1.0/24")
-
-	require.NoError(t, err)
-
-	ipc := NewChecker(ts)
+	ipc := NewChecker(
+		mustParseCIDRs(t, "192.168.1.0/24"),
+		nil,
+		mustParseCIDRs(t, "127.0.0.0/8"),
+	)
 
 	lis, err := net.Listen("tcp", "localhost:0")
 	require.NoError(t, err)
@@ -166,6 +167,24 @@ func TestIPChecker_InterceptorIPCheck(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("test X-Forwarded-For", func(t *testing.T) {
+		conn, err := grpc.NewClient(
+			lis.Addr().String(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			"X-Forwarded-For", "192.168.1.5",
+		)
+
+		client := testgrpc.NewTestServiceClient(conn)
+		_, err = client.EmptyCall(ctx, &testgrpc.Empty{})
+		require.NoError(t, err)
+	})
+
 	t.Run("test missing X-Real-IP", func(t *testing.T) {
 		conn, err := grpc.NewClient(
 			lis.Addr().String(),
@@ -191,4 +210,33 @@ func TestIPChecker_InterceptorIPCheck(t *testing.T) {
 		_, err = client.EmptyCall(context.Background(), &testgrpc.Empty{})
 		require.Error(t, err)
 	})
+
+	t.Run("test without subnets", func(t *testing.T) {
+		ipc := NewChecker(nil, nil, nil)
+
+		lis, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+
+		s := grpc.NewServer(grpc.UnaryInterceptor(ipc.InterceptorIPCheck))
+		testgrpc.RegisterTestServiceServer(s, interop.NewTestServer())
+
+		go func() {
+			if err := s.Serve(lis); err != nil {
+				require.FailNow(t, err.Error())
+			}
+		}()
+
+		defer s.Stop()
+
+		conn, err := grpc.NewClient(
+			lis.Addr().String(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		client := testgrpc.NewTestServiceClient(conn)
+		_, err = client.EmptyCall(context.Background(), &testgrpc.Empty{})
+		require.NoError(t, err)
+	})
 }
@@ -41,7 +41,6 @@ func TestForServer_GetMap(t *testing.T) {
 		"TotalAlloc",
 		"TotalMemory",
 		"FreeMemory",
-		"CPUutilization1",
 		"RandomValue",
 	}
 
@@ -77,11 +76,4 @@ func TestForServer_ReadMemStats(t *testing.T) {
 
 		require.Error(t, err)
 	})
-
-	t.Run("error read cpu", func(t *testing.T) {
-		t.Setenv("HOST_PROC", "./testdata/")
-		_, err := NewForServer()
-
-		require.Error(t, err)
-	})
 }
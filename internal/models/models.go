@@ -139,6 +139,18 @@ func GetGaugesSliceByMap(m map[string]float64) []Metrics {
 	return rM
 }
 
+// GetCountersSliceByMap returns counter models based on the specified increments.
+func GetCountersSliceByMap(m map[string]int64) []Metrics {
+	rM := make([]Metrics, 0, len(m))
+
+	for k, v := range m {
+		delta := v
+		rM = append(rM, Metrics{ID: k, MType: TypeCounter, Delta: &delta})
+	}
+
+	return rM
+}
+
 func checkType(mType string) error {
 	switch strings.ToLower(mType) {
 	case TypeCounter, TypeGauge:
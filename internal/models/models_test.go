@@ -555,6 +555,20 @@ func TestGetGaugesSliceByMap(t *testing.T) {
 	}
 }
 
+func TestGetCountersSliceByMap(t *testing.T) {
+	var (
+		delta1 int64 = 2
+		delta2 int64 = -3
+	)
+
+	got := GetCountersSliceByMap(map[string]int64{"test": 2, "test2": -3})
+
+	require.ElementsMatch(t, []Metrics{
+		{ID: "test", MType: "counter", Delta: &delta1},
+		{ID: "test2", MType: "counter", Delta: &delta2},
+	}, got)
+}
+
 func TestNewMetricByProto(t *testing.T) {
 	t.Run("positive test counter", func(t *testing.T) {
 		c := int64(1)
@@ -4,11 +4,13 @@ package parameters
 import (
 	"cmp"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"go.uber.org/zap"
@@ -23,6 +25,162 @@ type AgentParameters struct {
 	RateLimit      uint   `json:"rate_limit"`
 	PollInterval   uint   `json:"poll_interval"`
 	UseGRPC        bool   `json:"use_grpc"`
+	Token          string `json:"token"`
+	Tenant         string `json:"tenant"`
+	// SpoolDir it's directory for data which failed to send, empty value disables spool
+	SpoolDir string `json:"spool_dir"`
+	// SpoolMaxSize it's max size of spool in bytes
+	SpoolMaxSize uint `json:"spool_max_size"`
+	// SpoolMaxAge it's max age of spooled data in seconds
+	SpoolMaxAge uint `json:"spool_max_age"`
+	// PushHTTPAddr it's address of local HTTP endpoint for metrics pushed by other processes, empty value disables it
+	PushHTTPAddr string `json:"push_http_address"`
+	// PushUDPAddr it's address of local UDP endpoint for metrics pushed by other processes, empty value disables it
+	PushUDPAddr string `json:"push_udp_address"`
+	// ChangesOnly enables sending only gauges which changed since the last sending
+	ChangesOnly bool `json:"changes_only"`
+	// ChangeEpsilon it's max difference of gauge which is treated as unchanged
+	ChangeEpsilon float64 `json:"change_epsilon"`
+	// FullRefresh it's count of reports after which all gauges are sent, zero value disables full refresh
+	FullRefresh uint `json:"full_refresh"`
+	// Instance it's identifier of agent sent to server, hostname is used by default
+	Instance string `json:"instance"`
+	// IdentityLabel it's position of instance in names of sent metrics, prefix or suffix, empty value disables it
+	IdentityLabel string `json:"identity_label"`
+	// Group it's group of agent for choosing config on server
+	Group string `json:"group"`
+	// ConfigPollInterval it's interval of polling config from server in seconds, zero value disables it
+	ConfigPollInterval uint `json:"config_poll_interval"`
+	// Output it's destination of metrics: server, stdout, file or tee (server and local output), server by default
+	Output string `json:"output"`
+	// OutputFile it's path of local output file, tee writes to stdout if it's empty
+	OutputFile string `json:"output_file"`
+	// OutputMaxSize it's max size of output file in bytes, the file is rotated after it
+	OutputMaxSize uint `json:"output_max_size"`
+	// OutputMaxBackups it's count of kept rotated output files
+	OutputMaxBackups uint `json:"output_max_backups"`
+	// RecordFile it's file of recorded traffic, client appends sent data to it and replay mode sends it again
+	RecordFile string `json:"record_file"`
+	// ReplaySpeed it's speed of replay relative to recorded time, zero value sends data without delays
+	ReplaySpeed float64 `json:"replay_speed"`
+	// Collectors contains names of enabled collectors, empty list means default collectors
+	Collectors []string `json:"collectors"`
+	// CollectorIntervals contains poll intervals of collectors in seconds, PollInterval is used by default
+	CollectorIntervals map[string]uint `json:"collector_intervals"`
+	// Host contains parameters of host collectors, can be set only in config file
+	Host HostParameters `json:"host"`
+	// Processes contains processes watched by process collector, can be set only in config file
+	Processes []ProcessParameters `json:"processes"`
+	// Scrape contains Prometheus endpoints scraped by scrape collector, can be set only in config file
+	Scrape []ScrapeParameters `json:"scrape"`
+	// Exec contains commands run by exec collector, can be set only in config file
+	Exec []ExecParameters `json:"exec"`
+	// Logs contains files tailed by log collector, can be set only in config file
+	Logs []LogParameters `json:"logs"`
+	// LogStateFile it's file for read offsets of log collector, empty value means reading from the end after restart
+	LogStateFile string `json:"log_state_file"`
+	// Probes contains targets checked by probe collector, can be set only in config file
+	Probes []ProbeParameters `json:"probes"`
+	// RuntimeQuantiles contains quantiles of histograms reported by runtime collector, can be set only in config file
+	RuntimeQuantiles []float64 `json:"runtime_quantiles"`
+	// Rules contains pipeline applied to collected metrics before sending, can be set only in config file
+	Rules []MetricRuleParameters `json:"rules"`
+}
+
+// HostParameters contains include and exclude regular expressions for host collectors.
+// Devices are disks and network interfaces, mounts are filesystem mount points.
+// Empty include list includes everything, exclude list wins over include one.
+type HostParameters struct {
+	IncludeDevices []string `json:"include_devices"`
+	ExcludeDevices []string `json:"exclude_devices"`
+	IncludeMounts  []string `json:"include_mounts"`
+	ExcludeMounts  []string `json:"exclude_mounts"`
+}
+
+// ProcessParameters describes processes watched by process collector.
+// Label is used in metric names, processes are selected by exactly one of
+// PID file, exact process name or regular expression matching command line.
+type ProcessParameters struct {
+	Label   string `json:"label"`
+	PIDFile string `json:"pid_file"`
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// ScrapeParameters describes Prometheus endpoint scraped by scrape collector.
+// Name is used in names of target's health metrics, Prefix is added to names of scraped metrics.
+// Timeout is in seconds.
+type ScrapeParameters struct {
+	Name    string              `json:"name"`
+	URL     string              `json:"url"`
+	Timeout uint                `json:"timeout"`
+	Prefix  string              `json:"prefix"`
+	Relabel []RelabelParameters `json:"relabel"`
+}
+
+// ExecParameters describes command run by exec collector.
+// Command is run without shell, Format is "lines" by default or "json".
+// Interval and Timeout are in seconds, zero interval means running on every collection.
+type ExecParameters struct {
+	Name     string   `json:"name"`
+	Command  []string `json:"command"`
+	Format   string   `json:"format"`
+	Interval uint     `json:"interval"`
+	Timeout  uint     `json:"timeout"`
+}
+
+// LogParameters describes file tailed by log collector
+type LogParameters struct {
+	Path  string              `json:"path"`
+	Rules []LogRuleParameters `json:"rules"`
+}
+
+// LogRuleParameters describes rule for lines of log file.
+// Rule without Group counts matched lines in counter Name. Rule with Group, which is name or number
+// of capturing group, sets gauge Name to captured number aggregated over collection interval
+// by Aggregate: last by default, avg or max.
+type LogRuleParameters struct {
+	Name      string `json:"name"`
+	Pattern   string `json:"pattern"`
+	Group     string `json:"group"`
+	Aggregate string `json:"aggregate"`
+}
+
+// ProbeParameters describes target checked by probe collector.
+// Type is http for GET of URL or tcp for connecting to Address.
+// HTTP probe checks that status is Status, any 2xx status by default, and that body matches Body regular expression,
+// Insecure disables verification of server certificate. Timeout is in seconds.
+type ProbeParameters struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Address  string `json:"address"`
+	Status   int    `json:"status"`
+	Body     string `json:"body"`
+	Insecure bool   `json:"insecure"`
+	Timeout  uint   `json:"timeout"`
+}
+
+// MetricRuleParameters describes rule of agent's metric pipeline, rules are applied in order.
+// Action allow drops metrics which don't match Pattern, deny drops matching ones,
+// rename replaces name of matching metrics with Replacement which can contain capture groups like ${1},
+// prefix adds Prefix and scale multiplies values of gauges by Factor.
+// Empty Pattern of prefix and scale rules matches all metrics.
+type MetricRuleParameters struct {
+	Action      string  `json:"action"`
+	Pattern     string  `json:"pattern"`
+	Replacement string  `json:"replacement"`
+	Prefix      string  `json:"prefix"`
+	Factor      float64 `json:"factor"`
+}
+
+// RelabelParameters describes rule for renaming scraped metrics.
+// Names matched by Pattern are replaced with Replacement, which may contain $1 like groups,
+// or are dropped if Drop is set.
+type RelabelParameters struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Drop        bool   `json:"drop"`
 }
 
 // ParseFlagsAgent return agent's parameters from console or env.
@@ -40,6 +198,30 @@ func ParseFlagsAgent() (p AgentParameters) {
 	f.UintVar(&p.ReportInterval, "r", 10, "report interval")
 	f.UintVar(&p.PollInterval, "p", 2, "poll interval")
 	f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+	f.StringVar(&p.Token, "token", "", "bearer token for server authentication")
+	f.StringVar(&p.Tenant, "tenant", "", "tenant of metrics on server")
+	f.Func("collectors", "comma separated list of enabled collectors", func(s string) error {
+		p.Collectors = splitList(s)
+		return nil
+	})
+	f.StringVar(&p.SpoolDir, "spool-dir", "", "directory for data which failed to send, empty value disables spool")
+	f.UintVar(&p.SpoolMaxSize, "spool-max-size", 10<<20, "max size of spool in bytes")
+	f.UintVar(&p.SpoolMaxAge, "spool-max-age", 3600, "max age of spooled data in seconds")
+	f.StringVar(&p.PushHTTPAddr, "push-http", "", "address of local HTTP endpoint for pushed metrics")
+	f.StringVar(&p.PushUDPAddr, "push-udp", "", "address of local UDP endpoint for pushed metrics")
+	f.BoolVar(&p.ChangesOnly, "changes-only", false, "send only gauges changed since the last sending")
+	f.Float64Var(&p.ChangeEpsilon, "change-epsilon", 0, "max difference of gauge which is treated as unchanged")
+	f.UintVar(&p.FullRefresh, "full-refresh", 10, "count of reports after which all gauges are sent")
+	f.StringVar(&p.Instance, "instance", "", "identifier of agent sent to server, hostname by default")
+	f.StringVar(&p.IdentityLabel, "identity-label", "", "position of instance in names of metrics, prefix or suffix")
+	f.StringVar(&p.Group, "group", "", "group of agent for choosing config on server")
+	f.UintVar(&p.ConfigPollInterval, "config-poll", 0, "interval of polling config from server in seconds, 0 disables it")
+	f.StringVar(&p.Output, "output", "", "destination of metrics: server, stdout, file or tee")
+	f.StringVar(&p.OutputFile, "output-file", "", "path of local output file")
+	f.UintVar(&p.OutputMaxSize, "output-max-size", 10<<20, "max size of output file in bytes")
+	f.UintVar(&p.OutputMaxBackups, "output-max-backups", 3, "count of kept rotated output files")
+	f.StringVar(&p.RecordFile, "record", "", "file of recorded traffic")
+	f.Float64Var(&p.ReplaySpeed, "replay-speed", 1, "speed of replay relative to recorded time, 0 sends without delays")
 
 	if config == "" {
 		f.StringVar(&config, "c", "config.json", "path to agent configuration")
@@ -97,6 +279,122 @@ func ParseFlagsAgent() (p AgentParameters) {
 		}
 	}
 
+	if envToken := os.Getenv("TOKEN"); envToken != "" {
+		p.Token = envToken
+	}
+
+	if envTenant := os.Getenv("TENANT"); envTenant != "" {
+		p.Tenant = envTenant
+	}
+
+	if envCollectors := os.Getenv("COLLECTORS"); envCollectors != "" {
+		p.Collectors = splitList(envCollectors)
+	}
+
+	if envSD := os.Getenv("SPOOL_DIR"); envSD != "" {
+		p.SpoolDir = envSD
+	}
+
+	if envSMS := os.Getenv("SPOOL_MAX_SIZE"); envSMS != "" {
+		intSMS, err := strconv.ParseUint(envSMS, 10, 32)
+
+		if err == nil {
+			p.SpoolMaxSize = uint(intSMS)
+		}
+	}
+
+	if envSMA := os.Getenv("SPOOL_MAX_AGE"); envSMA != "" {
+		intSMA, err := strconv.ParseUint(envSMA, 10, 32)
+
+		if err == nil {
+			p.SpoolMaxAge = uint(intSMA)
+		}
+	}
+
+	if envPH := os.Getenv("PUSH_HTTP_ADDRESS"); envPH != "" {
+		p.PushHTTPAddr = envPH
+	}
+
+	if envPU := os.Getenv("PUSH_UDP_ADDRESS"); envPU != "" {
+		p.PushUDPAddr = envPU
+	}
+
+	if envCO := os.Getenv("CHANGES_ONLY"); envCO != "" {
+		if boolCO, err := strconv.ParseBool(envCO); err == nil {
+			p.ChangesOnly = boolCO
+		}
+	}
+
+	if envCE := os.Getenv("CHANGE_EPSILON"); envCE != "" {
+		if floatCE, err := strconv.ParseFloat(envCE, 64); err == nil {
+			p.ChangeEpsilon = floatCE
+		}
+	}
+
+	if envFR := os.Getenv("FULL_REFRESH"); envFR != "" {
+		intFR, err := strconv.ParseUint(envFR, 10, 32)
+
+		if err == nil {
+			p.FullRefresh = uint(intFR)
+		}
+	}
+
+	if envInstance := os.Getenv("INSTANCE"); envInstance != "" {
+		p.Instance = envInstance
+	}
+
+	if envIL := os.Getenv("IDENTITY_LABEL"); envIL != "" {
+		p.IdentityLabel = envIL
+	}
+
+	if envGroup := os.Getenv("GROUP"); envGroup != "" {
+		p.Group = envGroup
+	}
+
+	if envCPI := os.Getenv("CONFIG_POLL_INTERVAL"); envCPI != "" {
+		intCPI, err := strconv.ParseUint(envCPI, 10, 32)
+
+		if err == nil {
+			p.ConfigPollInterval = uint(intCPI)
+		}
+	}
+
+	if envOutput := os.Getenv("OUTPUT"); envOutput != "" {
+		p.Output = envOutput
+	}
+
+	if envOF := os.Getenv("OUTPUT_FILE"); envOF != "" {
+		p.OutputFile = envOF
+	}
+
+	if envOMS := os.Getenv("OUTPUT_MAX_SIZE"); envOMS != "" {
+		intOMS, err := strconv.ParseUint(envOMS, 10, 64)
+
+		if err == nil {
+			p.OutputMaxSize = uint(intOMS)
+		}
+	}
+
+	if envOMB := os.Getenv("OUTPUT_MAX_BACKUPS"); envOMB != "" {
+		intOMB, err := strconv.ParseUint(envOMB, 10, 32)
+
+		if err == nil {
+			p.OutputMaxBackups = uint(intOMB)
+		}
+	}
+
+	if envRF := os.Getenv("RECORD_FILE"); envRF != "" {
+		p.RecordFile = envRF
+	}
+
+	if envRS := os.Getenv("REPLAY_SPEED"); envRS != "" {
+		floatRS, err := strconv.ParseFloat(envRS, 64)
+
+		if err == nil {
+			p.ReplaySpeed = floatRS
+		}
+	}
+
 	return
 }
 
@@ -150,21 +448,117 @@ func parseAgentFromFile(f *flag.FlagSet, p *AgentParameters, config string) erro
 		p.UseGRPC = cmp.Or(jsonP.UseGRPC, p.UseGRPC)
 	}
 
+	p.Token = cmp.Or(p.Token, jsonP.Token)
+	p.Tenant = cmp.Or(p.Tenant, jsonP.Tenant)
+	p.SpoolDir = cmp.Or(p.SpoolDir, jsonP.SpoolDir)
+	p.PushHTTPAddr = cmp.Or(p.PushHTTPAddr, jsonP.PushHTTPAddr)
+	p.PushUDPAddr = cmp.Or(p.PushUDPAddr, jsonP.PushUDPAddr)
+	p.Instance = cmp.Or(p.Instance, jsonP.Instance)
+	p.IdentityLabel = cmp.Or(p.IdentityLabel, jsonP.IdentityLabel)
+	p.Group = cmp.Or(p.Group, jsonP.Group)
+	p.ConfigPollInterval = cmp.Or(p.ConfigPollInterval, jsonP.ConfigPollInterval)
+	p.Output = cmp.Or(p.Output, jsonP.Output)
+	p.OutputFile = cmp.Or(p.OutputFile, jsonP.OutputFile)
+	p.RecordFile = cmp.Or(p.RecordFile, jsonP.RecordFile)
+
+	rs, _ := strconv.ParseFloat(f.Lookup("replay-speed").DefValue, 64)
+	if p.ReplaySpeed == rs {
+		p.ReplaySpeed = cmp.Or(jsonP.ReplaySpeed, p.ReplaySpeed)
+	}
+
+	oms, _ := strconv.ParseUint(f.Lookup("output-max-size").DefValue, 10, 64)
+	if p.OutputMaxSize == uint(oms) {
+		p.OutputMaxSize = cmp.Or(jsonP.OutputMaxSize, p.OutputMaxSize)
+	}
+
+	omb, _ := strconv.ParseUint(f.Lookup("output-max-backups").DefValue, 10, 64)
+	if p.OutputMaxBackups == uint(omb) {
+		p.OutputMaxBackups = cmp.Or(jsonP.OutputMaxBackups, p.OutputMaxBackups)
+	}
+
+	sms, _ := strconv.ParseUint(f.Lookup("spool-max-size").DefValue, 10, 64)
+	if p.SpoolMaxSize == uint(sms) {
+		p.SpoolMaxSize = cmp.Or(jsonP.SpoolMaxSize, p.SpoolMaxSize)
+	}
+
+	sma, _ := strconv.ParseUint(f.Lookup("spool-max-age").DefValue, 10, 64)
+	if p.SpoolMaxAge == uint(sma) {
+		p.SpoolMaxAge = cmp.Or(jsonP.SpoolMaxAge, p.SpoolMaxAge)
+	}
+
+	changesOnly, _ := strconv.ParseBool(f.Lookup("changes-only").DefValue)
+	if p.ChangesOnly == changesOnly {
+		p.ChangesOnly = cmp.Or(jsonP.ChangesOnly, p.ChangesOnly)
+	}
+
+	ce, _ := strconv.ParseFloat(f.Lookup("change-epsilon").DefValue, 64)
+	if p.ChangeEpsilon == ce {
+		p.ChangeEpsilon = cmp.Or(jsonP.ChangeEpsilon, p.ChangeEpsilon)
+	}
+
+	fr, _ := strconv.ParseUint(f.Lookup("full-refresh").DefValue, 10, 64)
+	if p.FullRefresh == uint(fr) {
+		p.FullRefresh = cmp.Or(jsonP.FullRefresh, p.FullRefresh)
+	}
+
+	if len(p.Collectors) == 0 {
+		p.Collectors = jsonP.Collectors
+	}
+
+	if p.CollectorIntervals == nil {
+		p.CollectorIntervals = jsonP.CollectorIntervals
+	}
+
+	p.Host = jsonP.Host
+	p.Processes = jsonP.Processes
+	p.Scrape = jsonP.Scrape
+	p.Exec = jsonP.Exec
+	p.Logs = jsonP.Logs
+	p.LogStateFile = jsonP.LogStateFile
+	p.Probes = jsonP.Probes
+	p.RuntimeQuantiles = jsonP.RuntimeQuantiles
+	p.Rules = jsonP.Rules
+
 	return nil
 }
 
+// splitList splits comma separated list, empty values are skipped.
+func splitList(s string) []string {
+	var list []string
+
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
 // ServerParameters contains parameters for server.
 type ServerParameters struct {
-	FlagRunAddr     string     `json:"address"`
-	FlagRunGRPCAddr string     `json:"grpc_address"`
-	FileStoragePath string     `json:"file_storage_path"`
-	CryptoKeyPath   string     `json:"crypto_key"`
-	DataBaseDSN     string     `json:"database_dsn"`
-	HashKey         string     `json:"hash_key"`
-	StoreInterval   uint       `json:"store_interval"`
-	Restore         bool       `json:"restore"`
-	RateLimit       uint       `json:"rate_limit"`
-	TrustedSubnet   *net.IPNet `json:"trusted_subnet"`
+	FlagRunAddr     string       `json:"address"`
+	FlagRunGRPCAddr string       `json:"grpc_address"`
+	FileStoragePath string       `json:"file_storage_path"`
+	CryptoKeyPath   string       `json:"crypto_key"`
+	DataBaseDSN     string       `json:"database_dsn"`
+	HashKey         string       `json:"hash_key"`
+	StoreInterval   uint         `json:"store_interval"`
+	Restore         bool         `json:"restore"`
+	RateLimit       uint         `json:"rate_limit"`
+	TrustedSubnets  []*net.IPNet `json:"trusted_subnet"`
+	DeniedSubnets   []*net.IPNet `json:"denied_subnets"`
+	TrustedProxies  []*net.IPNet `json:"trusted_proxies"`
+	ClockSkew       uint         `json:"clock_skew"`
+	NonceCacheSize  uint         `json:"nonce_cache_size"`
+	TokensPath      string       `json:"tokens_file"`
+	// AgentConfigDir it's directory with configs served to agents, empty value disables serving
+	AgentConfigDir string `json:"agent_config_dir"`
+	// AgentReportInterval it's expected report interval in seconds of agents which don't send their interval
+	AgentReportInterval uint `json:"agent_report_interval"`
+	// AgentStaleIntervals it's number of missed report intervals after which agent is stale,
+	// agent is removed after ten stale periods
+	AgentStaleIntervals uint `json:"agent_stale_intervals"`
 }
 
 // UnmarshalJSON converts json to a structure
@@ -173,7 +567,9 @@ func (sp *ServerParameters) UnmarshalJSON(data []byte) (err error) {
 
 	spAlias := struct {
 		*ServerParametersAlias
-		TrustedSubnet string `json:"trusted_subnet"`
+		TrustedSubnets string `json:"trusted_subnet"`
+		DeniedSubnets  string `json:"denied_subnets"`
+		TrustedProxies string `json:"trusted_proxies"`
 	}{
 		ServerParametersAlias: (*ServerParametersAlias)(sp),
 	}
@@ -183,14 +579,42 @@ func (sp *ServerParameters) UnmarshalJSON(data []byte) (err error) {
 		return
 	}
 
-	if spAlias.TrustedSubnet != "" {
-		_, sp.TrustedSubnet, err = net.ParseCIDR(spAlias.TrustedSubnet)
+	if sp.TrustedSubnets, err = parseCIDRs(spAlias.TrustedSubnets); err != nil {
+		return
 	}
+
+	if sp.DeniedSubnets, err = parseCIDRs(spAlias.DeniedSubnets); err != nil {
+		return
+	}
+
+	sp.TrustedProxies, err = parseCIDRs(spAlias.TrustedProxies)
 	return
 }
 
+// parseCIDRs parses comma separated list of CIDRs, IPv4 and IPv6 are supported.
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse CIDR %s: %w", cidr, err)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
 // ParseFlagsServer return server's parameters from console or env.
-func ParseFlagsServer() (p ServerParameters) {
+// Invalid subnets make parameters invalid, because they would disable access control.
+func ParseFlagsServer() (p ServerParameters, err error) {
 	var config string
 	if envConfig := os.Getenv("CONFIG"); envConfig != "" {
 		config = envConfig
@@ -211,30 +635,44 @@ func ParseFlagsServer() (p ServerParameters) {
 	f.UintVar(&p.StoreInterval, "i", 300, "interval in seconds for save storage")
 	f.BoolVar(&p.Restore, "r", true, "flag for upload storage from file")
 	f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+	f.UintVar(&p.ClockSkew, "clock-skew", 60, "allowed difference in seconds between request timestamp and server time")
+	f.UintVar(&p.NonceCacheSize, "nonce-cache-size", 10000, "maximum number of request nonces remembered in the clock skew window to reject replayed requests")
+	f.StringVar(&p.TokensPath, "tokens", "", "path to file with api tokens")
+	f.StringVar(&p.AgentConfigDir, "agent-config-dir", "", "directory with configs served to agents")
+	f.UintVar(&p.AgentReportInterval, "agent-report-interval", 10, "expected report interval in seconds of agents which don't send their interval")
+	f.UintVar(&p.AgentStaleIntervals, "agent-stale-intervals", 3, "number of missed report intervals after which agent is stale")
 
 	if config == "" {
 		f.StringVar(&config, "c", "config.json", "path to server configuration")
 		f.StringVar(&config, "config", "config.json", "path to server configuration")
 	}
 
-	var trustedSubnet string
-	f.StringVar(&trustedSubnet, "t", "", "trusted subnet")
+	var trustedSubnets, deniedSubnets, trustedProxies string
+	f.StringVar(&trustedSubnets, "t", "", "comma separated trusted subnets")
+	f.StringVar(&deniedSubnets, "deny-subnets", "", "comma separated denied subnets")
+	f.StringVar(&trustedProxies, "trusted-proxies", "", "comma separated subnets of proxies whose X-Real-IP and X-Forwarded-For headers are trusted")
 
-	err := f.Parse(os.Args[1:])
-	if err != nil {
+	if err := f.Parse(os.Args[1:]); err != nil {
 		logger.Log.Warn("Parse argument", zap.Error(err))
 	}
 
-	if trustedSubnet != "" {
-		_, ts, err := net.ParseCIDR(trustedSubnet)
-		if err != nil {
-			logger.Log.Warn("Parse CIDR on flags", zap.Error(err))
-		}
+	if p.TrustedSubnets, err = parseCIDRs(trustedSubnets); err != nil {
+		return p, fmt.Errorf("parse trusted subnets on flags: %w", err)
+	}
 
-		p.TrustedSubnet = ts
+	if p.DeniedSubnets, err = parseCIDRs(deniedSubnets); err != nil {
+		return p, fmt.Errorf("parse denied subnets on flags: %w", err)
+	}
+
+	if p.TrustedProxies, err = parseCIDRs(trustedProxies); err != nil {
+		return p, fmt.Errorf("parse trusted proxies on flags: %w", err)
 	}
 
 	if err := parseServerFromFile(f, &p, config); err != nil {
+		if errors.As(err, new(*net.ParseError)) {
+			return p, err
+		}
+
 		logger.Log.Warn("Config file will not read", zap.Error(err))
 	}
 
@@ -283,12 +721,53 @@ func ParseFlagsServer() (p ServerParameters) {
 	}
 
 	if envTS := os.Getenv("TRUSTED_SUBNET"); envTS != "" {
-		_, ts, err := net.ParseCIDR(envTS)
-		if err != nil {
-			logger.Log.Warn("Parse CIDR on env", zap.Error(err))
+		if p.TrustedSubnets, err = parseCIDRs(envTS); err != nil {
+			return p, fmt.Errorf("parse trusted subnets on env: %w", err)
+		}
+	}
+
+	if envDS := os.Getenv("DENIED_SUBNETS"); envDS != "" {
+		if p.DeniedSubnets, err = parseCIDRs(envDS); err != nil {
+			return p, fmt.Errorf("parse denied subnets on env: %w", err)
+		}
+	}
+
+	if envTP := os.Getenv("TRUSTED_PROXIES"); envTP != "" {
+		if p.TrustedProxies, err = parseCIDRs(envTP); err != nil {
+			return p, fmt.Errorf("parse trusted proxies on env: %w", err)
+		}
+	}
+
+	if envCS := os.Getenv("CLOCK_SKEW"); envCS != "" {
+		if uintCS, err := strconv.ParseUint(envCS, 10, 32); err == nil {
+			p.ClockSkew = uint(uintCS)
+		}
+	}
+
+	if envNCS := os.Getenv("NONCE_CACHE_SIZE"); envNCS != "" {
+		if uintNCS, err := strconv.ParseUint(envNCS, 10, 32); err == nil {
+			p.NonceCacheSize = uint(uintNCS)
+		}
+	}
+
+	if envTF := os.Getenv("TOKENS_FILE"); envTF != "" {
+		p.TokensPath = envTF
+	}
+
+	if envACD := os.Getenv("AGENT_CONFIG_DIR"); envACD != "" {
+		p.AgentConfigDir = envACD
+	}
+
+	if envARI := os.Getenv("AGENT_REPORT_INTERVAL"); envARI != "" {
+		if uintARI, err := strconv.ParseUint(envARI, 10, 32); err == nil {
+			p.AgentReportInterval = uint(uintARI)
 		}
+	}
 
-		p.TrustedSubnet = ts
+	if envASI := os.Getenv("AGENT_STALE_INTERVALS"); envASI != "" {
+		if uintASI, err := strconv.ParseUint(envASI, 10, 32); err == nil {
+			p.AgentStaleIntervals = uint(uintASI)
+		}
 	}
 
 	return
@@ -351,8 +830,39 @@ func parseServerFromFile(f *flag.FlagSet, p *ServerParameters, config string) er
 		p.Restore = cmp.Or(jsonP.Restore, p.Restore)
 	}
 
-	if p.TrustedSubnet == nil {
-		p.TrustedSubnet = jsonP.TrustedSubnet
+	if len(p.TrustedSubnets) == 0 {
+		p.TrustedSubnets = jsonP.TrustedSubnets
+	}
+
+	if len(p.DeniedSubnets) == 0 {
+		p.DeniedSubnets = jsonP.DeniedSubnets
+	}
+
+	if len(p.TrustedProxies) == 0 {
+		p.TrustedProxies = jsonP.TrustedProxies
+	}
+
+	cs, _ := strconv.ParseUint(f.Lookup("clock-skew").DefValue, 10, 64)
+	if p.ClockSkew == uint(cs) {
+		p.ClockSkew = cmp.Or(jsonP.ClockSkew, p.ClockSkew)
+	}
+
+	ncs, _ := strconv.ParseUint(f.Lookup("nonce-cache-size").DefValue, 10, 64)
+	if p.NonceCacheSize == uint(ncs) {
+		p.NonceCacheSize = cmp.Or(jsonP.NonceCacheSize, p.NonceCacheSize)
+	}
+
+	p.TokensPath = cmp.Or(p.TokensPath, jsonP.TokensPath)
+	p.AgentConfigDir = cmp.Or(p.AgentConfigDir, jsonP.AgentConfigDir)
+
+	ari, _ := strconv.ParseUint(f.Lookup("agent-report-interval").DefValue, 10, 64)
+	if p.AgentReportInterval == uint(ari) {
+		p.AgentReportInterval = cmp.Or(jsonP.AgentReportInterval, p.AgentReportInterval)
+	}
+
+	asi, _ := strconv.ParseUint(f.Lookup("agent-stale-intervals").DefValue, 10, 64)
+	if p.AgentStaleIntervals == uint(asi) {
+		p.AgentStaleIntervals = cmp.Or(jsonP.AgentStaleIntervals, p.AgentStaleIntervals)
 	}
 
 	return nil
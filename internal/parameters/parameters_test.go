@@ -36,7 +36,7 @@ func TestParseFlagsAgent(t *testing.T) {
 	})
 
 	t.Run("test config file on flags c", func(t *testing.T) {
-		wantP := setFlagsForAgent()
+		wantP := setConfigOnlyForAgent(setFlagsForAgent())
 		os.Args = append(os.Args, "-c=./testdata/agent_config_test.json")
 		p := ParseFlagsAgent()
 
@@ -45,7 +45,7 @@ func TestParseFlagsAgent(t *testing.T) {
 	})
 
 	t.Run("test config file on flags config", func(t *testing.T) {
-		wantP := setFlagsForAgent()
+		wantP := setConfigOnlyForAgent(setFlagsForAgent())
 		os.Args = append(os.Args, "-config=./testdata/agent_config_test.json")
 		p := ParseFlagsAgent()
 
@@ -54,7 +54,7 @@ func TestParseFlagsAgent(t *testing.T) {
 	})
 
 	t.Run("test config file on env", func(t *testing.T) {
-		wantP := setEnvForAgent()
+		wantP := setConfigOnlyForAgent(setEnvForAgent())
 		os.Setenv("CONFIG", "./testdata/agent_config_test.json")
 		p := ParseFlagsAgent()
 
@@ -71,16 +71,108 @@ func setEnvForAgent() AgentParameters {
 	os.Setenv("KEY", "key")
 	os.Setenv("RATE_LIMIT", "5")
 	os.Setenv("USE_GRPC", "True")
+	os.Setenv("TOKEN", "envToken")
+	os.Setenv("TENANT", "envTenant")
+	os.Setenv("COLLECTORS", "memstats, env")
+	os.Setenv("SPOOL_DIR", "envSpool")
+	os.Setenv("SPOOL_MAX_SIZE", "1000")
+	os.Setenv("SPOOL_MAX_AGE", "60")
+	os.Setenv("PUSH_HTTP_ADDRESS", "envPushHTTP")
+	os.Setenv("PUSH_UDP_ADDRESS", "envPushUDP")
+	os.Setenv("CHANGES_ONLY", "true")
+	os.Setenv("CHANGE_EPSILON", "0.5")
+	os.Setenv("FULL_REFRESH", "6")
+	os.Setenv("INSTANCE", "envInstance")
+	os.Setenv("IDENTITY_LABEL", "prefix")
+	os.Setenv("GROUP", "envGroup")
+	os.Setenv("CONFIG_POLL_INTERVAL", "30")
+	os.Setenv("OUTPUT", "tee")
+	os.Setenv("OUTPUT_FILE", "envOutput")
+	os.Setenv("OUTPUT_MAX_SIZE", "1000")
+	os.Setenv("OUTPUT_MAX_BACKUPS", "2")
+	os.Setenv("RECORD_FILE", "envRecord")
+	os.Setenv("REPLAY_SPEED", "2")
 
 	return AgentParameters{
-		ListenAddr:     "testEnv",
-		CryptoKeyPath:  "testPath",
-		HashKey:        "key",
-		ReportInterval: 10,
-		RateLimit:      5,
-		PollInterval:   10,
-		UseGRPC:        true,
+		ListenAddr:         "testEnv",
+		CryptoKeyPath:      "testPath",
+		HashKey:            "key",
+		ReportInterval:     10,
+		RateLimit:          5,
+		PollInterval:       10,
+		UseGRPC:            true,
+		Token:              "envToken",
+		Tenant:             "envTenant",
+		Collectors:         []string{"memstats", "env"},
+		SpoolDir:           "envSpool",
+		SpoolMaxSize:       1000,
+		SpoolMaxAge:        60,
+		PushHTTPAddr:       "envPushHTTP",
+		PushUDPAddr:        "envPushUDP",
+		ChangesOnly:        true,
+		ChangeEpsilon:      0.5,
+		FullRefresh:        6,
+		Instance:           "envInstance",
+		IdentityLabel:      "prefix",
+		Group:              "envGroup",
+		ConfigPollInterval: 30,
+		Output:             "tee",
+		OutputFile:         "envOutput",
+		OutputMaxSize:      1000,
+		OutputMaxBackups:   2,
+		RecordFile:         "envRecord",
+		ReplaySpeed:        2,
+	}
+}
+
+// setConfigOnlyForAgent sets parameters which can be set only in agent_config_test.json
+func setConfigOnlyForAgent(p AgentParameters) AgentParameters {
+	p.CollectorIntervals = map[string]uint{
+		"config": 5,
+	}
+	p.Host = HostParameters{
+		ExcludeDevices: []string{"^loop"},
+		IncludeMounts:  []string{"^/$", "^/home"},
 	}
+	p.Processes = []ProcessParameters{
+		{Label: "server", PIDFile: "/run/server.pid"},
+		{Label: "postgres", Name: "postgres"},
+	}
+	p.Scrape = []ScrapeParameters{
+		{
+			Name:    "node",
+			URL:     "http://localhost:9100/metrics",
+			Timeout: 3,
+			Prefix:  "node_",
+			Relabel: []RelabelParameters{{Pattern: "^go_.*", Drop: true}},
+		},
+	}
+	p.Exec = []ExecParameters{
+		{Name: "queue", Command: []string{"/usr/local/bin/queue-size", "-v"}, Interval: 30, Timeout: 5},
+	}
+	p.Logs = []LogParameters{
+		{
+			Path: "/var/log/app.log",
+			Rules: []LogRuleParameters{
+				{Name: "AppErrors", Pattern: "ERROR"},
+				{Name: "AppLatency", Pattern: `latency=(?P<ms>\d+)ms`, Group: "ms", Aggregate: "max"},
+			},
+		},
+	}
+	p.LogStateFile = "/var/lib/agent/logs.json"
+	p.Probes = []ProbeParameters{
+		{Name: "api", Type: "http", URL: "https://api.local/health", Status: 200, Body: "ok", Timeout: 2},
+		{Name: "db", Type: "tcp", Address: "db.local:5432"},
+	}
+	p.RuntimeQuantiles = []float64{0.5, 0.99}
+	p.Rules = []MetricRuleParameters{
+		{Action: "deny", Pattern: "^RandomValue$"},
+		{Action: "rename", Pattern: "^(.*)Bytes$", Replacement: "${1}MiB"},
+		{Action: "scale", Pattern: "MiB$", Factor: 1.0 / (1 << 20)},
+		{Action: "prefix", Prefix: "prod_"},
+	}
+
+	return p
 }
 
 func Test_parseAgentFromFile(t *testing.T) {
@@ -97,6 +189,30 @@ func Test_parseAgentFromFile(t *testing.T) {
 		f.UintVar(&p.ReportInterval, "r", 10, "report interval")
 		f.UintVar(&p.PollInterval, "p", 2, "poll interval")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.StringVar(&p.Token, "token", "", "bearer token")
+		f.StringVar(&p.Tenant, "tenant", "", "tenant")
+		f.Func("collectors", "enabled collectors", func(s string) error {
+			p.Collectors = splitList(s)
+			return nil
+		})
+		f.StringVar(&p.SpoolDir, "spool-dir", "", "spool directory")
+		f.UintVar(&p.SpoolMaxSize, "spool-max-size", 10<<20, "spool max size")
+		f.UintVar(&p.SpoolMaxAge, "spool-max-age", 3600, "spool max age")
+		f.StringVar(&p.PushHTTPAddr, "push-http", "", "push http address")
+		f.StringVar(&p.PushUDPAddr, "push-udp", "", "push udp address")
+		f.BoolVar(&p.ChangesOnly, "changes-only", false, "changes only")
+		f.Float64Var(&p.ChangeEpsilon, "change-epsilon", 0, "change epsilon")
+		f.UintVar(&p.FullRefresh, "full-refresh", 10, "full refresh")
+		f.StringVar(&p.Instance, "instance", "", "instance")
+		f.StringVar(&p.IdentityLabel, "identity-label", "", "identity label")
+		f.StringVar(&p.Group, "group", "", "group")
+		f.UintVar(&p.ConfigPollInterval, "config-poll", 0, "config poll interval")
+		f.StringVar(&p.Output, "output", "", "output")
+		f.StringVar(&p.OutputFile, "output-file", "", "output file")
+		f.UintVar(&p.OutputMaxSize, "output-max-size", 10<<20, "output max size")
+		f.UintVar(&p.OutputMaxBackups, "output-max-backups", 3, "output max backups")
+		f.StringVar(&p.RecordFile, "record", "", "record file")
+		f.Float64Var(&p.ReplaySpeed, "replay-speed", 1, "replay speed")
 
 		f.Parse(os.Args[1:])
 
@@ -118,6 +234,30 @@ func Test_parseAgentFromFile(t *testing.T) {
 		f.UintVar(&p.ReportInterval, "r", 10, "report interval")
 		f.UintVar(&p.PollInterval, "p", 2, "poll interval")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.StringVar(&p.Token, "token", "", "bearer token")
+		f.StringVar(&p.Tenant, "tenant", "", "tenant")
+		f.Func("collectors", "enabled collectors", func(s string) error {
+			p.Collectors = splitList(s)
+			return nil
+		})
+		f.StringVar(&p.SpoolDir, "spool-dir", "", "spool directory")
+		f.UintVar(&p.SpoolMaxSize, "spool-max-size", 10<<20, "spool max size")
+		f.UintVar(&p.SpoolMaxAge, "spool-max-age", 3600, "spool max age")
+		f.StringVar(&p.PushHTTPAddr, "push-http", "", "push http address")
+		f.StringVar(&p.PushUDPAddr, "push-udp", "", "push udp address")
+		f.BoolVar(&p.ChangesOnly, "changes-only", false, "changes only")
+		f.Float64Var(&p.ChangeEpsilon, "change-epsilon", 0, "change epsilon")
+		f.UintVar(&p.FullRefresh, "full-refresh", 10, "full refresh")
+		f.StringVar(&p.Instance, "instance", "", "instance")
+		f.StringVar(&p.IdentityLabel, "identity-label", "", "identity label")
+		f.StringVar(&p.Group, "group", "", "group")
+		f.UintVar(&p.ConfigPollInterval, "config-poll", 0, "config poll interval")
+		f.StringVar(&p.Output, "output", "", "output")
+		f.StringVar(&p.OutputFile, "output-file", "", "output file")
+		f.UintVar(&p.OutputMaxSize, "output-max-size", 10<<20, "output max size")
+		f.UintVar(&p.OutputMaxBackups, "output-max-backups", 3, "output max backups")
+		f.StringVar(&p.RecordFile, "record", "", "record file")
+		f.Float64Var(&p.ReplaySpeed, "replay-speed", 1, "replay speed")
 
 		f.Parse(os.Args[1:])
 
@@ -128,13 +268,78 @@ func Test_parseAgentFromFile(t *testing.T) {
 
 	t.Run("test config file", func(t *testing.T) {
 		wantP := AgentParameters{
-			ListenAddr:     "configAddr",
-			CryptoKeyPath:  "configCKey",
-			HashKey:        "configKey",
-			ReportInterval: 111,
-			RateLimit:      333,
-			PollInterval:   222,
-			UseGRPC:        true,
+			ListenAddr:         "configAddr",
+			CryptoKeyPath:      "configCKey",
+			HashKey:            "configKey",
+			ReportInterval:     111,
+			RateLimit:          333,
+			PollInterval:       222,
+			UseGRPC:            true,
+			Token:              "configToken",
+			Tenant:             "configTenant",
+			Collectors:         []string{"memstats", "config"},
+			SpoolDir:           "configSpool",
+			SpoolMaxSize:       3000,
+			SpoolMaxAge:        180,
+			PushHTTPAddr:       "configPushHTTP",
+			PushUDPAddr:        "configPushUDP",
+			ChangesOnly:        true,
+			ChangeEpsilon:      0.01,
+			FullRefresh:        30,
+			Instance:           "configInstance",
+			IdentityLabel:      "suffix",
+			Group:              "configGroup",
+			ConfigPollInterval: 90,
+			Output:             "stdout",
+			OutputFile:         "configOutput",
+			OutputMaxSize:      3000,
+			OutputMaxBackups:   5,
+			RecordFile:         "configRecord",
+			ReplaySpeed:        10,
+			CollectorIntervals: map[string]uint{
+				"config": 5,
+			},
+			Host: HostParameters{
+				ExcludeDevices: []string{"^loop"},
+				IncludeMounts:  []string{"^/$", "^/home"},
+			},
+			Processes: []ProcessParameters{
+				{Label: "server", PIDFile: "/run/server.pid"},
+				{Label: "postgres", Name: "postgres"},
+			},
+			Scrape: []ScrapeParameters{
+				{
+					Name:    "node",
+					URL:     "http://localhost:9100/metrics",
+					Timeout: 3,
+					Prefix:  "node_",
+					Relabel: []RelabelParameters{{Pattern: "^go_.*", Drop: true}},
+				},
+			},
+			Exec: []ExecParameters{
+				{Name: "queue", Command: []string{"/usr/local/bin/queue-size", "-v"}, Interval: 30, Timeout: 5},
+			},
+			Logs: []LogParameters{
+				{
+					Path: "/var/log/app.log",
+					Rules: []LogRuleParameters{
+						{Name: "AppErrors", Pattern: "ERROR"},
+						{Name: "AppLatency", Pattern: `latency=(?P<ms>\d+)ms`, Group: "ms", Aggregate: "max"},
+					},
+				},
+			},
+			LogStateFile: "/var/lib/agent/logs.json",
+			Probes: []ProbeParameters{
+				{Name: "api", Type: "http", URL: "https://api.local/health", Status: 200, Body: "ok", Timeout: 2},
+				{Name: "db", Type: "tcp", Address: "db.local:5432"},
+			},
+			RuntimeQuantiles: []float64{0.5, 0.99},
+			Rules: []MetricRuleParameters{
+				{Action: "deny", Pattern: "^RandomValue$"},
+				{Action: "rename", Pattern: "^(.*)Bytes$", Replacement: "${1}MiB"},
+				{Action: "scale", Pattern: "MiB$", Factor: 1.0 / (1 << 20)},
+				{Action: "prefix", Prefix: "prod_"},
+			},
 		}
 
 		var p AgentParameters
@@ -146,6 +351,30 @@ func Test_parseAgentFromFile(t *testing.T) {
 		f.UintVar(&p.ReportInterval, "r", 10, "report interval")
 		f.UintVar(&p.PollInterval, "p", 2, "poll interval")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.StringVar(&p.Token, "token", "", "bearer token")
+		f.StringVar(&p.Tenant, "tenant", "", "tenant")
+		f.Func("collectors", "enabled collectors", func(s string) error {
+			p.Collectors = splitList(s)
+			return nil
+		})
+		f.StringVar(&p.SpoolDir, "spool-dir", "", "spool directory")
+		f.UintVar(&p.SpoolMaxSize, "spool-max-size", 10<<20, "spool max size")
+		f.UintVar(&p.SpoolMaxAge, "spool-max-age", 3600, "spool max age")
+		f.StringVar(&p.PushHTTPAddr, "push-http", "", "push http address")
+		f.StringVar(&p.PushUDPAddr, "push-udp", "", "push udp address")
+		f.BoolVar(&p.ChangesOnly, "changes-only", false, "changes only")
+		f.Float64Var(&p.ChangeEpsilon, "change-epsilon", 0, "change epsilon")
+		f.UintVar(&p.FullRefresh, "full-refresh", 10, "full refresh")
+		f.StringVar(&p.Instance, "instance", "", "instance")
+		f.StringVar(&p.IdentityLabel, "identity-label", "", "identity label")
+		f.StringVar(&p.Group, "group", "", "group")
+		f.UintVar(&p.ConfigPollInterval, "config-poll", 0, "config poll interval")
+		f.StringVar(&p.Output, "output", "", "output")
+		f.StringVar(&p.OutputFile, "output-file", "", "output file")
+		f.UintVar(&p.OutputMaxSize, "output-max-size", 10<<20, "output max size")
+		f.UintVar(&p.OutputMaxBackups, "output-max-backups", 3, "output max backups")
+		f.StringVar(&p.RecordFile, "record", "", "record file")
+		f.Float64Var(&p.ReplaySpeed, "replay-speed", 1, "replay speed")
 
 		f.Parse(os.Args[1:])
 
@@ -164,6 +393,30 @@ func Test_parseAgentFromFile(t *testing.T) {
 		f.UintVar(&p.ReportInterval, "r", 10, "report interval")
 		f.UintVar(&p.PollInterval, "p", 2, "poll interval")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.StringVar(&p.Token, "token", "", "bearer token")
+		f.StringVar(&p.Tenant, "tenant", "", "tenant")
+		f.Func("collectors", "enabled collectors", func(s string) error {
+			p.Collectors = splitList(s)
+			return nil
+		})
+		f.StringVar(&p.SpoolDir, "spool-dir", "", "spool directory")
+		f.UintVar(&p.SpoolMaxSize, "spool-max-size", 10<<20, "spool max size")
+		f.UintVar(&p.SpoolMaxAge, "spool-max-age", 3600, "spool max age")
+		f.StringVar(&p.PushHTTPAddr, "push-http", "", "push http address")
+		f.StringVar(&p.PushUDPAddr, "push-udp", "", "push udp address")
+		f.BoolVar(&p.ChangesOnly, "changes-only", false, "changes only")
+		f.Float64Var(&p.ChangeEpsilon, "change-epsilon", 0, "change epsilon")
+		f.UintVar(&p.FullRefresh, "full-refresh", 10, "full refresh")
+		f.StringVar(&p.Instance, "instance", "", "instance")
+		f.StringVar(&p.IdentityLabel, "identity-label", "", "identity label")
+		f.StringVar(&p.Group, "group", "", "group")
+		f.UintVar(&p.ConfigPollInterval, "config-poll", 0, "config poll interval")
+		f.StringVar(&p.Output, "output", "", "output")
+		f.StringVar(&p.OutputFile, "output-file", "", "output file")
+		f.UintVar(&p.OutputMaxSize, "output-max-size", 10<<20, "output max size")
+		f.UintVar(&p.OutputMaxBackups, "output-max-backups", 3, "output max backups")
+		f.StringVar(&p.RecordFile, "record", "", "record file")
+		f.Float64Var(&p.ReplaySpeed, "replay-speed", 1, "replay speed")
 
 		f.Parse(os.Args[1:])
 
@@ -182,28 +435,76 @@ func setFlagsForAgent() AgentParameters {
 		"-k=key",
 		"-l=5",
 		"-grpc=true",
+		"-token=flagToken",
+		"-tenant=flagTenant",
+		"-collectors=memstats,flag",
+		"-spool-dir=flagSpool",
+		"-spool-max-size=2000",
+		"-spool-max-age=120",
+		"-push-http=flagPushHTTP",
+		"-push-udp=flagPushUDP",
+		"-changes-only",
+		"-change-epsilon=0.1",
+		"-full-refresh=20",
+		"-instance=flagInstance",
+		"-identity-label=suffix",
+		"-group=flagGroup",
+		"-config-poll=60",
+		"-output=file",
+		"-output-file=flagOutput",
+		"-output-max-size=2000",
+		"-output-max-backups=4",
+		"-record=flagRecord",
+		"-replay-speed=0",
 	}
 
 	return AgentParameters{
-		ListenAddr:     "testFlags",
-		CryptoKeyPath:  "testPath",
-		HashKey:        "key",
-		ReportInterval: 100,
-		RateLimit:      5,
-		PollInterval:   100,
-		UseGRPC:        true,
+		ListenAddr:         "testFlags",
+		CryptoKeyPath:      "testPath",
+		HashKey:            "key",
+		ReportInterval:     100,
+		RateLimit:          5,
+		PollInterval:       100,
+		UseGRPC:            true,
+		Token:              "flagToken",
+		Tenant:             "flagTenant",
+		Collectors:         []string{"memstats", "flag"},
+		SpoolDir:           "flagSpool",
+		SpoolMaxSize:       2000,
+		SpoolMaxAge:        120,
+		PushHTTPAddr:       "flagPushHTTP",
+		PushUDPAddr:        "flagPushUDP",
+		ChangesOnly:        true,
+		ChangeEpsilon:      0.1,
+		FullRefresh:        20,
+		Instance:           "flagInstance",
+		IdentityLabel:      "suffix",
+		Group:              "flagGroup",
+		ConfigPollInterval: 60,
+		Output:             "file",
+		OutputFile:         "flagOutput",
+		OutputMaxSize:      2000,
+		OutputMaxBackups:   4,
+		RecordFile:         "flagRecord",
+		ReplaySpeed:        0,
 	}
 }
 
 func getDefaultParametersForAgent() AgentParameters {
 	return AgentParameters{
-		ListenAddr:     "localhost:8080",
-		CryptoKeyPath:  "",
-		HashKey:        "",
-		ReportInterval: 10,
-		RateLimit:      10,
-		PollInterval:   2,
-		UseGRPC:        false,
+		ListenAddr:       "localhost:8080",
+		CryptoKeyPath:    "",
+		HashKey:          "",
+		ReportInterval:   10,
+		RateLimit:        10,
+		PollInterval:     2,
+		UseGRPC:          false,
+		SpoolMaxSize:     10 << 20,
+		SpoolMaxAge:      3600,
+		FullRefresh:      10,
+		OutputMaxSize:    10 << 20,
+		OutputMaxBackups: 3,
+		ReplaySpeed:      1,
 	}
 }
 
@@ -215,7 +516,8 @@ func delParameters() {
 func TestParseFlagsServer(t *testing.T) {
 	t.Run("test env", func(t *testing.T) {
 		wantP := setEnvForServer()
-		p := ParseFlagsServer()
+		p, err := ParseFlagsServer()
+		require.NoError(t, err)
 
 		assert.Equal(t, wantP, p)
 		delParameters()
@@ -223,7 +525,8 @@ func TestParseFlagsServer(t *testing.T) {
 
 	t.Run("test flags", func(t *testing.T) {
 		wantP := setFlagsForServer()
-		p := ParseFlagsServer()
+		p, err := ParseFlagsServer()
+		require.NoError(t, err)
 
 		assert.Equal(t, wantP, p)
 		delParameters()
@@ -231,7 +534,8 @@ func TestParseFlagsServer(t *testing.T) {
 
 	t.Run("test default", func(t *testing.T) {
 		wantP := getDefaultParametersForServer()
-		p := ParseFlagsServer()
+		p, err := ParseFlagsServer()
+		require.NoError(t, err)
 
 		assert.Equal(t, wantP, p)
 		delParameters()
@@ -240,7 +544,8 @@ func TestParseFlagsServer(t *testing.T) {
 	t.Run("test config file on flags c", func(t *testing.T) {
 		wantP := setFlagsForServer()
 		os.Args = append(os.Args, "-c=./testdata/server_config_test.json")
-		p := ParseFlagsServer()
+		p, err := ParseFlagsServer()
+		require.NoError(t, err)
 
 		assert.Equal(t, wantP, p)
 		delParameters()
@@ -249,7 +554,8 @@ func TestParseFlagsServer(t *testing.T) {
 	t.Run("test config file on flags config", func(t *testing.T) {
 		wantP := setFlagsForServer()
 		os.Args = append(os.Args, "-config=./testdata/server_config_test.json")
-		p := ParseFlagsServer()
+		p, err := ParseFlagsServer()
+		require.NoError(t, err)
 
 		assert.Equal(t, wantP, p)
 		delParameters()
@@ -258,27 +564,59 @@ func TestParseFlagsServer(t *testing.T) {
 	t.Run("test config file on env", func(t *testing.T) {
 		wantP := setEnvForServer()
 		os.Setenv("CONFIG", "./testdata/server_config_test.json")
-		p := ParseFlagsServer()
+		p, err := ParseFlagsServer()
+		require.NoError(t, err)
 
 		assert.Equal(t, wantP, p)
 		delParameters()
 	})
+
+	t.Run("invalid subnets", func(t *testing.T) {
+		defer delParameters()
+
+		os.Args = []string{"test", "-t=192.168.1.0/24,192.168.1.300/24"}
+		_, err := ParseFlagsServer()
+		require.Error(t, err, "invalid subnet on flags")
+
+		os.Args = []string{"test"}
+		os.Setenv("DENIED_SUBNETS", "10.0.0.1")
+		_, err = ParseFlagsServer()
+		require.Error(t, err, "invalid subnet on env")
+
+		os.Clearenv()
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(dir+"/config.json", []byte(`{"trusted_subnet":"10.0.0.0/33"}`), 0o600))
+		os.Setenv("CONFIG", dir+"/config.json")
+		_, err = ParseFlagsServer()
+		require.Error(t, err, "invalid subnet in config file")
+	})
 }
 
 func setEnvForServer() ServerParameters {
 	_, ts, _ := net.ParseCIDR("192.168.1.0/24")
+	_, ts6, _ := net.ParseCIDR("fd00::/8")
+	_, ds, _ := net.ParseCIDR("192.168.1.13/32")
+	_, tp, _ := net.ParseCIDR("10.0.0.0/8")
 
 	sp := ServerParameters{
-		FlagRunAddr:     "testEnv",
-		FlagRunGRPCAddr: "testGRPCEnv",
-		FileStoragePath: "/tmp/test.json",
-		CryptoKeyPath:   "testPath",
-		DataBaseDSN:     "test",
-		StoreInterval:   10,
-		Restore:         true,
-		HashKey:         "key",
-		RateLimit:       5,
-		TrustedSubnet:   ts,
+		FlagRunAddr:         "testEnv",
+		FlagRunGRPCAddr:     "testGRPCEnv",
+		FileStoragePath:     "/tmp/test.json",
+		CryptoKeyPath:       "testPath",
+		DataBaseDSN:         "test",
+		StoreInterval:       10,
+		Restore:             true,
+		HashKey:             "key",
+		RateLimit:           5,
+		TrustedSubnets:      []*net.IPNet{ts, ts6},
+		DeniedSubnets:       []*net.IPNet{ds},
+		TrustedProxies:      []*net.IPNet{tp},
+		ClockSkew:           15,
+		NonceCacheSize:      100,
+		TokensPath:          "envTokens",
+		AgentConfigDir:      "envAgentConfigs",
+		AgentReportInterval: 5,
+		AgentStaleIntervals: 4,
 	}
 	os.Setenv("ADDRESS", sp.FlagRunAddr)
 	os.Setenv("GRPC_ADDRESS", sp.FlagRunGRPCAddr)
@@ -289,7 +627,15 @@ func setEnvForServer() ServerParameters {
 	os.Setenv("RESTORE", "true")
 	os.Setenv("KEY", sp.HashKey)
 	os.Setenv("RATE_LIMIT", "5")
-	os.Setenv("TRUSTED_SUBNET", "192.168.1.0/24")
+	os.Setenv("TRUSTED_SUBNET", "192.168.1.0/24, fd00::/8")
+	os.Setenv("DENIED_SUBNETS", "192.168.1.13/32")
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	os.Setenv("CLOCK_SKEW", "15")
+	os.Setenv("NONCE_CACHE_SIZE", "100")
+	os.Setenv("TOKENS_FILE", "envTokens")
+	os.Setenv("AGENT_CONFIG_DIR", "envAgentConfigs")
+	os.Setenv("AGENT_REPORT_INTERVAL", "5")
+	os.Setenv("AGENT_STALE_INTERVALS", "4")
 
 	return sp
 }
@@ -307,35 +653,57 @@ func setFlagsForServer() ServerParameters {
 		"-k=key",
 		"-l=5",
 		"-t=192.168.1.0/24",
+		"-deny-subnets=192.168.1.13/32,192.168.1.14/32",
+		"-trusted-proxies=127.0.0.0/8",
+		"-clock-skew=20",
+		"-nonce-cache-size=200",
+		"-tokens=flagTokens",
+		"-agent-config-dir=flagAgentConfigs",
+		"-agent-report-interval=15",
+		"-agent-stale-intervals=5",
 	}
 
 	_, ts, _ := net.ParseCIDR("192.168.1.0/24")
+	_, ds1, _ := net.ParseCIDR("192.168.1.13/32")
+	_, ds2, _ := net.ParseCIDR("192.168.1.14/32")
+	_, tp, _ := net.ParseCIDR("127.0.0.0/8")
 	return ServerParameters{
-		FlagRunAddr:     "testFlags",
-		FlagRunGRPCAddr: "testGRPCFlags",
-		FileStoragePath: "/tmp/test/test.json",
-		CryptoKeyPath:   "testPath",
-		DataBaseDSN:     "testdb",
-		StoreInterval:   10,
-		Restore:         false,
-		HashKey:         "key",
-		RateLimit:       5,
-		TrustedSubnet:   ts,
+		FlagRunAddr:         "testFlags",
+		FlagRunGRPCAddr:     "testGRPCFlags",
+		FileStoragePath:     "/tmp/test/test.json",
+		CryptoKeyPath:       "testPath",
+		DataBaseDSN:         "testdb",
+		StoreInterval:       10,
+		Restore:             false,
+		HashKey:             "key",
+		RateLimit:           5,
+		TrustedSubnets:      []*net.IPNet{ts},
+		DeniedSubnets:       []*net.IPNet{ds1, ds2},
+		TrustedProxies:      []*net.IPNet{tp},
+		ClockSkew:           20,
+		NonceCacheSize:      200,
+		TokensPath:          "flagTokens",
+		AgentConfigDir:      "flagAgentConfigs",
+		AgentReportInterval: 15,
+		AgentStaleIntervals: 5,
 	}
 }
 
 func getDefaultParametersForServer() ServerParameters {
 	return ServerParameters{
-		FlagRunAddr:     "localhost:8080",
-		FlagRunGRPCAddr: "localhost:3200",
-		FileStoragePath: "/tmp/metrics-db.json",
-		CryptoKeyPath:   "",
-		DataBaseDSN:     "",
-		StoreInterval:   300,
-		Restore:         true,
-		HashKey:         "",
-		RateLimit:       10,
-		TrustedSubnet:   nil,
+		FlagRunAddr:         "localhost:8080",
+		FlagRunGRPCAddr:     "localhost:3200",
+		FileStoragePath:     "/tmp/metrics-db.json",
+		CryptoKeyPath:       "",
+		DataBaseDSN:         "",
+		StoreInterval:       300,
+		Restore:             true,
+		HashKey:             "",
+		RateLimit:           10,
+		ClockSkew:           60,
+		NonceCacheSize:      10000,
+		AgentReportInterval: 10,
+		AgentStaleIntervals: 3,
 	}
 }
 
@@ -360,6 +728,12 @@ func Test_parseServerFromFile(t *testing.T) {
 		f.UintVar(&p.StoreInterval, "i", 300, "interval in seconds for save storage")
 		f.BoolVar(&p.Restore, "r", true, "flag for upload storage from file")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.UintVar(&p.ClockSkew, "clock-skew", 60, "clock skew")
+		f.UintVar(&p.NonceCacheSize, "nonce-cache-size", 10000, "nonce cache size")
+		f.StringVar(&p.TokensPath, "tokens", "", "path to file with api tokens")
+		f.StringVar(&p.AgentConfigDir, "agent-config-dir", "", "agent config dir")
+		f.UintVar(&p.AgentReportInterval, "agent-report-interval", 10, "agent report interval")
+		f.UintVar(&p.AgentStaleIntervals, "agent-stale-intervals", 3, "agent stale intervals")
 
 		f.Parse(os.Args[1:])
 
@@ -388,13 +762,23 @@ func Test_parseServerFromFile(t *testing.T) {
 		f.UintVar(&p.StoreInterval, "i", 300, "interval in seconds for save storage")
 		f.BoolVar(&p.Restore, "r", true, "flag for upload storage from file")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
-
-		var trustedSubnet string
-		f.StringVar(&trustedSubnet, "t", "192.168.1.0/24", "trusted subnet")
+		f.UintVar(&p.ClockSkew, "clock-skew", 60, "clock skew")
+		f.UintVar(&p.NonceCacheSize, "nonce-cache-size", 10000, "nonce cache size")
+		f.StringVar(&p.TokensPath, "tokens", "", "path to file with api tokens")
+		f.StringVar(&p.AgentConfigDir, "agent-config-dir", "", "agent config dir")
+		f.UintVar(&p.AgentReportInterval, "agent-report-interval", 10, "agent report interval")
+		f.UintVar(&p.AgentStaleIntervals, "agent-stale-intervals", 3, "agent stale intervals")
+
+		var trustedSubnets, deniedSubnets, trustedProxies string
+		f.StringVar(&trustedSubnets, "t", "", "trusted subnets")
+		f.StringVar(&deniedSubnets, "deny-subnets", "", "denied subnets")
+		f.StringVar(&trustedProxies, "trusted-proxies", "", "trusted proxies")
 
 		f.Parse(os.Args[1:])
 
-		_, p.TrustedSubnet, _ = net.ParseCIDR(trustedSubnet)
+		p.TrustedSubnets, _ = parseCIDRs(trustedSubnets)
+		p.DeniedSubnets, _ = parseCIDRs(deniedSubnets)
+		p.TrustedProxies, _ = parseCIDRs(trustedProxies)
 
 		err := parseServerFromFile(f, &p, "./testdata/server_config_empty_test.json")
 		require.NoError(t, err)
@@ -403,20 +787,33 @@ func Test_parseServerFromFile(t *testing.T) {
 
 	t.Run("test config file", func(t *testing.T) {
 		_, wantCIDR, err := net.ParseCIDR("192.168.1.0/24")
+		require.NoError(t, err)
+
+		_, wantDenied, err := net.ParseCIDR("2001:db8::/32")
+		require.NoError(t, err)
 
+		_, wantProxy, err := net.ParseCIDR("10.0.0.1/32")
 		require.NoError(t, err)
 
 		wantP := ServerParameters{
-			FlagRunAddr:     "configAddr",
-			FlagRunGRPCAddr: "configGRPCAddr",
-			FileStoragePath: "configFile",
-			CryptoKeyPath:   "configCKey",
-			DataBaseDSN:     "configDSN",
-			HashKey:         "configKey",
-			StoreInterval:   111,
-			Restore:         true,
-			RateLimit:       222,
-			TrustedSubnet:   wantCIDR,
+			FlagRunAddr:         "configAddr",
+			FlagRunGRPCAddr:     "configGRPCAddr",
+			FileStoragePath:     "configFile",
+			CryptoKeyPath:       "configCKey",
+			DataBaseDSN:         "configDSN",
+			HashKey:             "configKey",
+			StoreInterval:       111,
+			Restore:             true,
+			RateLimit:           222,
+			TrustedSubnets:      []*net.IPNet{wantCIDR},
+			DeniedSubnets:       []*net.IPNet{wantDenied},
+			TrustedProxies:      []*net.IPNet{wantProxy},
+			ClockSkew:           30,
+			NonceCacheSize:      444,
+			TokensPath:          "configTokens",
+			AgentConfigDir:      "configAgentConfigs",
+			AgentReportInterval: 20,
+			AgentStaleIntervals: 6,
 		}
 
 		var p ServerParameters
@@ -435,6 +832,12 @@ func Test_parseServerFromFile(t *testing.T) {
 		f.UintVar(&p.StoreInterval, "i", 300, "interval in seconds for save storage")
 		f.BoolVar(&p.Restore, "r", true, "flag for upload storage from file")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.UintVar(&p.ClockSkew, "clock-skew", 60, "clock skew")
+		f.UintVar(&p.NonceCacheSize, "nonce-cache-size", 10000, "nonce cache size")
+		f.StringVar(&p.TokensPath, "tokens", "", "path to file with api tokens")
+		f.StringVar(&p.AgentConfigDir, "agent-config-dir", "", "agent config dir")
+		f.UintVar(&p.AgentReportInterval, "agent-report-interval", 10, "agent report interval")
+		f.UintVar(&p.AgentStaleIntervals, "agent-stale-intervals", 3, "agent stale intervals")
 
 		f.Parse(os.Args[1:])
 
@@ -460,6 +863,12 @@ func Test_parseServerFromFile(t *testing.T) {
 		f.UintVar(&p.StoreInterval, "i", 300, "interval in seconds for save storage")
 		f.BoolVar(&p.Restore, "r", true, "flag for upload storage from file")
 		f.UintVar(&p.RateLimit, "l", 10, "rate limit")
+		f.UintVar(&p.ClockSkew, "clock-skew", 60, "clock skew")
+		f.UintVar(&p.NonceCacheSize, "nonce-cache-size", 10000, "nonce cache size")
+		f.StringVar(&p.TokensPath, "tokens", "", "path to file with api tokens")
+		f.StringVar(&p.AgentConfigDir, "agent-config-dir", "", "agent config dir")
+		f.UintVar(&p.AgentReportInterval, "agent-report-interval", 10, "agent report interval")
+		f.UintVar(&p.AgentStaleIntervals, "agent-stale-intervals", 3, "agent stale intervals")
 
 		f.Parse(os.Args[1:])
 
@@ -145,3 +145,183 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/proto/metricsservice.proto",
 }
+
+const (
+	AgentConfigs_AgentConfig_FullMethodName = "/metricssservice.AgentConfigs/AgentConfig"
+)
+
+// AgentConfigsClient is the client API for AgentConfigs service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AgentConfigsClient interface {
+	AgentConfig(ctx context.Context, in *AgentConfigRequest, opts ...grpc.CallOption) (*AgentConfigResponse, error)
+}
+
+type agentConfigsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentConfigsClient(cc grpc.ClientConnInterface) AgentConfigsClient {
+	return &agentConfigsClient{cc}
+}
+
+func (c *agentConfigsClient) AgentConfig(ctx context.Context, in *AgentConfigRequest, opts ...grpc.CallOption) (*AgentConfigResponse, error) {
+	out := new(AgentConfigResponse)
+	err := c.cc.Invoke(ctx, AgentConfigs_AgentConfig_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AgentConfigsServer is the server API for AgentConfigs service.
+// All implementations must embed UnimplementedAgentConfigsServer
+// for forward compatibility
+type AgentConfigsServer interface {
+	AgentConfig(context.Context, *AgentConfigRequest) (*AgentConfigResponse, error)
+	mustEmbedUnimplementedAgentConfigsServer()
+}
+
+// UnimplementedAgentConfigsServer must be embedded to have forward compatible implementations.
+type UnimplementedAgentConfigsServer struct {
+}
+
+func (UnimplementedAgentConfigsServer) AgentConfig(context.Context, *AgentConfigRequest) (*AgentConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AgentConfig not implemented")
+}
+func (UnimplementedAgentConfigsServer) mustEmbedUnimplementedAgentConfigsServer() {}
+
+// UnsafeAgentConfigsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AgentConfigsServer will
+// result in compilation errors.
+type UnsafeAgentConfigsServer interface {
+	mustEmbedUnimplementedAgentConfigsServer()
+}
+
+func RegisterAgentConfigsServer(s grpc.ServiceRegistrar, srv AgentConfigsServer) {
+	s.RegisterService(&AgentConfigs_ServiceDesc, srv)
+}
+
+func _AgentConfigs_AgentConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentConfigsServer).AgentConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentConfigs_AgentConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentConfigsServer).AgentConfig(ctx, req.(*AgentConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AgentConfigs_ServiceDesc is the grpc.ServiceDesc for AgentConfigs service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AgentConfigs_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "metricssservice.AgentConfigs",
+	HandlerType: (*AgentConfigsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AgentConfig",
+			Handler:    _AgentConfigs_AgentConfig_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/proto/metricsservice.proto",
+}
+
+const (
+	Inventory_Agents_FullMethodName = "/metricssservice.Inventory/Agents"
+)
+
+// InventoryClient is the client API for Inventory service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InventoryClient interface {
+	Agents(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*AgentsResponse, error)
+}
+
+type inventoryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInventoryClient(cc grpc.ClientConnInterface) InventoryClient {
+	return &inventoryClient{cc}
+}
+
+func (c *inventoryClient) Agents(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*AgentsResponse, error) {
+	out := new(AgentsResponse)
+	err := c.cc.Invoke(ctx, Inventory_Agents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InventoryServer is the server API for Inventory service.
+// All implementations must embed UnimplementedInventoryServer
+// for forward compatibility
+type InventoryServer interface {
+	Agents(context.Context, *empty.Empty) (*AgentsResponse, error)
+	mustEmbedUnimplementedInventoryServer()
+}
+
+// UnimplementedInventoryServer must be embedded to have forward compatible implementations.
+type UnimplementedInventoryServer struct {
+}
+
+func (UnimplementedInventoryServer) Agents(context.Context, *empty.Empty) (*AgentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Agents not implemented")
+}
+func (UnimplementedInventoryServer) mustEmbedUnimplementedInventoryServer() {}
+
+// UnsafeInventoryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InventoryServer will
+// result in compilation errors.
+type UnsafeInventoryServer interface {
+	mustEmbedUnimplementedInventoryServer()
+}
+
+func RegisterInventoryServer(s grpc.ServiceRegistrar, srv InventoryServer) {
+	s.RegisterService(&Inventory_ServiceDesc, srv)
+}
+
+func _Inventory_Agents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(empty.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InventoryServer).Agents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Inventory_Agents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InventoryServer).Agents(ctx, req.(*empty.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Inventory_ServiceDesc is the grpc.ServiceDesc for Inventory service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Inventory_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "metricssservice.Inventory",
+	HandlerType: (*InventoryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Agents",
+			Handler:    _Inventory_Agents_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/proto/metricsservice.proto",
+}
@@ -17,6 +17,7 @@ type Repository interface {
 	PingDB(ctx context.Context) error
 	Updates(ctx context.Context, metrics []models.Metrics) error
 	GetAll(ctx context.Context) (map[string]fmt.Stringer, error)
+	Tenants(ctx context.Context) ([]string, error)
 	Close() error
 }
 
@@ -8,13 +8,18 @@ import (
 	"net/http"
 
 	"github.com/DarkOmap/metricsService/handlers"
+	"github.com/DarkOmap/metricsService/internal/agentconfig"
+	"github.com/DarkOmap/metricsService/internal/auth"
 	"github.com/DarkOmap/metricsService/internal/certmanager"
 	"github.com/DarkOmap/metricsService/internal/compresses"
 	"github.com/DarkOmap/metricsService/internal/hasher"
+	"github.com/DarkOmap/metricsService/internal/identity"
+	"github.com/DarkOmap/metricsService/internal/inventory"
 	"github.com/DarkOmap/metricsService/internal/ip"
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/parameters"
 	"github.com/DarkOmap/metricsService/internal/proto"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 )
@@ -96,8 +101,9 @@ func (s *Server) runGRPCServer(ctx context.Context, eg *errgroup.Group) {
 	})
 }
 
-// WithHTTP returns a functional option that adds http handlers to the server
-func WithHTTP(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, gp *compresses.GzipPool, p parameters.ServerParameters) OptionFunc {
+// WithHTTP returns a functional option that adds http handlers to the server.
+// Agents are tracked if inv isn't nil.
+func WithHTTP(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, gp *compresses.GzipPool, a *auth.Authenticator, inv *inventory.Inventory, p parameters.ServerParameters) OptionFunc {
 	return func(s *Server) error {
 		logger.Log.Info("Create decrypt manager")
 
@@ -108,9 +114,16 @@ func WithHTTP(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, gp *comp
 
 		logger.Log.Info("Create handlers")
 		sh := handlers.NewServiceHandlers(r)
+		if p.AgentConfigDir != "" {
+			sh = sh.WithAgentConfigs(agentconfig.NewStore(p.AgentConfigDir))
+		}
+
+		if inv != nil {
+			sh = sh.WithInventory(inv)
+		}
 
 		logger.Log.Info("Create routers")
-		router := handlers.ServiceRouter(gp, h, sh, dm, ipc)
+		router := handlers.ServiceRouter(gp, h, sh, dm, ipc, a)
 
 		logger.Log.Info("Create server")
 		s.httpServer = &http.Server{
@@ -122,8 +135,9 @@ func WithHTTP(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, gp *comp
 	}
 }
 
-// WithGRPC returns a functional option that adds grpc handlers to the server
-func WithGRPC(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, p parameters.ServerParameters) OptionFunc {
+// WithGRPC returns a functional option that adds grpc handlers to the server.
+// Agents are tracked if inv isn't nil.
+func WithGRPC(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, a *auth.Authenticator, inv *inventory.Inventory, p parameters.ServerParameters) OptionFunc {
 	return func(s *Server) error {
 		logger.Log.Info("Create grpc server")
 
@@ -132,13 +146,28 @@ func WithGRPC(r handlers.Repository, ipc *ip.Checker, h *hasher.Hasher, p parame
 			return fmt.Errorf("create listener: %w", err)
 		}
 
-		gs := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		interceptors := []grpc.UnaryServerInterceptor{
 			logger.InterceptorLogger,
 			ipc.InterceptorIPCheck,
 			h.InterceptorCheckHash,
-		))
+			a.InterceptorAuth,
+			tenant.InterceptorTenant,
+			identity.InterceptorIdentity,
+		}
+
+		if inv != nil {
+			interceptors = append(interceptors, inv.InterceptorTrack)
+		}
+
+		gs := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
 
 		proto.RegisterMetricsServer(gs, handlers.NewMetricsServer(r))
+		if inv != nil {
+			inventory.RegisterServer(gs, inv)
+		}
+		if p.AgentConfigDir != "" {
+			agentconfig.RegisterServer(gs, agentconfig.NewStore(p.AgentConfigDir))
+		}
 
 		s.Listener = listen
 		s.grpsServer = gs
@@ -19,7 +19,7 @@ func TestNewServer(t *testing.T) {
 	})
 
 	t.Run("test server with HTTP", func(t *testing.T) {
-		httpOpt := WithHTTP(nil, nil, nil, nil, parameters.ServerParameters{
+		httpOpt := WithHTTP(nil, nil, nil, nil, nil, nil, parameters.ServerParameters{
 			CryptoKeyPath: "./testdata/test_private",
 		})
 
@@ -31,7 +31,7 @@ func TestNewServer(t *testing.T) {
 	})
 
 	t.Run("test error server with HTTP", func(t *testing.T) {
-		httpOpt := WithHTTP(nil, nil, nil, nil, parameters.ServerParameters{
+		httpOpt := WithHTTP(nil, nil, nil, nil, nil, nil, parameters.ServerParameters{
 			CryptoKeyPath: "./testdata/error",
 		})
 
@@ -40,7 +40,7 @@ func TestNewServer(t *testing.T) {
 	})
 
 	t.Run("test server with GRPC", func(t *testing.T) {
-		grpcOpt := WithGRPC(nil, nil, nil, parameters.ServerParameters{
+		grpcOpt := WithGRPC(nil, nil, nil, nil, nil, parameters.ServerParameters{
 			FlagRunGRPCAddr: "localhost:0",
 		})
 
@@ -52,7 +52,7 @@ func TestNewServer(t *testing.T) {
 	})
 
 	t.Run("test error server with GRPC", func(t *testing.T) {
-		grpcOpt := WithGRPC(nil, nil, nil, parameters.ServerParameters{
+		grpcOpt := WithGRPC(nil, nil, nil, nil, nil, parameters.ServerParameters{
 			FlagRunGRPCAddr: "error",
 		})
 
@@ -61,11 +61,11 @@ func TestNewServer(t *testing.T) {
 	})
 
 	t.Run("test server with HTTP and GRPC", func(t *testing.T) {
-		httpOpt := WithHTTP(nil, nil, nil, nil, parameters.ServerParameters{
+		httpOpt := WithHTTP(nil, nil, nil, nil, nil, nil, parameters.ServerParameters{
 			CryptoKeyPath: "./testdata/test_private",
 		})
 
-		grpcOpt := WithGRPC(nil, nil, nil, parameters.ServerParameters{
+		grpcOpt := WithGRPC(nil, nil, nil, nil, nil, parameters.ServerParameters{
 			FlagRunGRPCAddr: "localhost:0",
 		})
 
@@ -80,7 +80,7 @@ func TestNewServer(t *testing.T) {
 func TestServer_Run(t *testing.T) {
 	t.Run("test run HTTP", func(t *testing.T) {
 		t.Parallel()
-		httpOpt := WithHTTP(nil, nil, nil, nil, parameters.ServerParameters{
+		httpOpt := WithHTTP(nil, nil, nil, nil, nil, nil, parameters.ServerParameters{
 			CryptoKeyPath: "./testdata/test_private",
 			FlagRunAddr:   ":0",
 		})
@@ -100,7 +100,7 @@ func TestServer_Run(t *testing.T) {
 
 	t.Run("test run grpc", func(t *testing.T) {
 		t.Parallel()
-		grpcOpt := WithGRPC(nil, nil, nil, parameters.ServerParameters{
+		grpcOpt := WithGRPC(nil, nil, nil, nil, nil, parameters.ServerParameters{
 			FlagRunGRPCAddr: ":1",
 		})
 
@@ -119,12 +119,12 @@ func TestServer_Run(t *testing.T) {
 
 	t.Run("test run grpc and http", func(t *testing.T) {
 		t.Parallel()
-		httpOpt := WithHTTP(nil, nil, nil, nil, parameters.ServerParameters{
+		httpOpt := WithHTTP(nil, nil, nil, nil, nil, nil, parameters.ServerParameters{
 			CryptoKeyPath: "./testdata/test_private",
 			FlagRunAddr:   ":2",
 		})
 
-		grpcOpt := WithGRPC(nil, nil, nil, parameters.ServerParameters{
+		grpcOpt := WithGRPC(nil, nil, nil, nil, nil, parameters.ServerParameters{
 			FlagRunGRPCAddr: ":3",
 		})
 
@@ -143,12 +143,12 @@ func TestServer_Run(t *testing.T) {
 
 	t.Run("test run HTTP error", func(t *testing.T) {
 		t.Parallel()
-		httpOpt := WithHTTP(nil, nil, nil, nil, parameters.ServerParameters{
+		httpOpt := WithHTTP(nil, nil, nil, nil, nil, nil, parameters.ServerParameters{
 			CryptoKeyPath: "./testdata/test_private",
 			FlagRunAddr:   ":4",
 		})
 
-		grpcOpt := WithGRPC(nil, nil, nil, parameters.ServerParameters{
+		grpcOpt := WithGRPC(nil, nil, nil, nil, nil, parameters.ServerParameters{
 			FlagRunGRPCAddr: ":5",
 		})
 
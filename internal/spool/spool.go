@@ -0,0 +1,282 @@
+// Package spool defines a bounded disk-backed queue of metrics which the agent failed to send.
+// Every entry is stored in its own file, file names keep the order of entries.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkOmap/metricsService/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	entryExt = ".json"
+	tmpExt   = ".tmp"
+)
+
+// Entry it's metrics which failed to send
+type Entry struct {
+	Time     time.Time          `json:"time"`
+	Gauges   map[string]float64 `json:"gauges,omitempty"`
+	Counters map[string]int64   `json:"counters,omitempty"`
+}
+
+// Empty returns true if entry doesn't contain metrics
+func (e Entry) Empty() bool {
+	return len(e.Gauges) == 0 && len(e.Counters) == 0
+}
+
+// Batch it's spooled entries coalesced into one entry.
+// Gauges contain the latest values, counters contain sums of increments.
+type Batch struct {
+	Entry
+	files []string
+}
+
+// Spool stores entries in directory.
+// Entries older than maxAge are dropped, the oldest entries are dropped when size of directory exceeds maxSize.
+type Spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	next    uint64
+	mu      sync.Mutex
+}
+
+// NewSpool create Spool in directory dir, entries left by previous runs are kept
+// and temporary files of interrupted writes are removed
+func NewSpool(dir string, maxSize int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxSize: maxSize, maxAge: maxAge}
+
+	if err := s.removeTmp(); err != nil {
+		return nil, err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) != 0 {
+		last := strings.TrimSuffix(files[len(files)-1].Name(), entryExt)
+		n, _ := strconv.ParseUint(last, 10, 64)
+		s.next = n + 1
+	}
+
+	return s, nil
+}
+
+// Push stores entry and drops the oldest entries if spool exceeds its limits
+func (s *Spool) Push(e Entry) error {
+	if e.Empty() {
+		return nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.next, entryExt))
+	tmp := name + tmpExt
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write entry: %w", err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename entry: %w", err)
+	}
+
+	s.next++
+
+	return s.trim()
+}
+
+// Batch returns all stored entries coalesced in order, nil means that spool is empty.
+// Entries stay in spool until Commit.
+func (s *Spool) Batch() (*Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.trim(); err != nil {
+		return nil, err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	b := &Batch{Entry: Entry{Gauges: make(map[string]float64), Counters: make(map[string]int64)}}
+
+	for _, f := range files {
+		name := filepath.Join(s.dir, f.Name())
+		b.files = append(b.files, name)
+
+		e, err := readEntry(name)
+		if err != nil {
+			logger.Log.Warn("Drop broken spool entry", zap.String("file", name), zap.Error(err))
+			continue
+		}
+
+		b.Time = e.Time
+		maps.Copy(b.Gauges, e.Gauges)
+
+		for name, delta := range e.Counters {
+			b.Counters[name] += delta
+		}
+	}
+
+	return b, nil
+}
+
+// Commit removes entries of sent batch
+func (s *Spool) Commit(b *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+
+	for _, name := range b.files {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("remove entries: %w", err)
+	}
+
+	return nil
+}
+
+// Len returns count of stored entries
+func (s *Spool) Len() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	return len(files), err
+}
+
+// trim drops expired entries and the oldest entries over size limit
+func (s *Spool) trim() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	var (
+		size    int64
+		sizes   = make([]int64, len(files))
+		expired = 0
+		now     = time.Now()
+	)
+
+	for i, f := range files {
+		info, err := f.Info()
+		if err != nil {
+			return fmt.Errorf("get entry info: %w", err)
+		}
+
+		if s.maxAge > 0 && now.Sub(info.ModTime()) > s.maxAge {
+			expired = i + 1
+		}
+
+		sizes[i] = info.Size()
+		size += info.Size()
+	}
+
+	drop := expired
+	for _, sz := range sizes[:drop] {
+		size -= sz
+	}
+
+	for s.maxSize > 0 && size > s.maxSize && drop < len(files) {
+		size -= sizes[drop]
+		drop++
+	}
+
+	if drop == 0 {
+		return nil
+	}
+
+	logger.Log.Warn("Drop spool entries over limits", zap.Int("count", drop))
+
+	for _, f := range files[:drop] {
+		if err := os.Remove(filepath.Join(s.dir, f.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// files returns entry files sorted from the oldest to the newest
+func (s *Spool) files() ([]os.DirEntry, error) {
+	all, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool directory: %w", err)
+	}
+
+	files := slices.DeleteFunc(all, func(f os.DirEntry) bool {
+		return f.IsDir() || filepath.Ext(f.Name()) != entryExt
+	})
+
+	return files, nil
+}
+
+// removeTmp removes temporary files left by interrupted writes
+func (s *Spool) removeTmp() error {
+	tmp, err := filepath.Glob(filepath.Join(s.dir, "*"+entryExt+tmpExt))
+	if err != nil {
+		return fmt.Errorf("find temporary files: %w", err)
+	}
+
+	for _, name := range tmp {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove temporary file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func readEntry(name string) (Entry, error) {
+	var e Entry
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return e, fmt.Errorf("read entry: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("unmarshal entry: %w", err)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,115 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	t.Run("coalesce and commit", func(t *testing.T) {
+		s, err := NewSpool(t.TempDir(), 0, 0)
+		require.NoError(t, err)
+
+		b, err := s.Batch()
+		require.NoError(t, err)
+		require.Nil(t, b)
+
+		require.NoError(t, s.Push(Entry{}))
+		require.NoError(t, s.Push(Entry{Gauges: map[string]float64{"g": 1, "old": 1}, Counters: map[string]int64{"c": 1}}))
+		require.NoError(t, s.Push(Entry{Gauges: map[string]float64{"g": 2}, Counters: map[string]int64{"c": 2, "d": 1}}))
+
+		n, err := s.Len()
+		require.NoError(t, err)
+		require.Equal(t, 2, n, "empty entry isn't stored")
+
+		b, err = s.Batch()
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"g": 2, "old": 1}, b.Gauges)
+		require.Equal(t, map[string]int64{"c": 3, "d": 1}, b.Counters)
+
+		require.NoError(t, s.Push(Entry{Counters: map[string]int64{"c": 5}}))
+		require.NoError(t, s.Commit(b))
+
+		b, err = s.Batch()
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{"c": 5}, b.Counters, "entries pushed after batch stay in spool")
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := NewSpool(dir, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, s.Push(Entry{Gauges: map[string]float64{"g": 1}}))
+
+		tmp := filepath.Join(dir, "00000000000000000001.json.tmp")
+		require.NoError(t, os.WriteFile(tmp, []byte(`{"gauges":`), 0o600))
+
+		s, err = NewSpool(dir, 0, 0)
+		require.NoError(t, err)
+		require.NoFileExists(t, tmp, "file of interrupted write is removed")
+		require.NoError(t, s.Push(Entry{Gauges: map[string]float64{"g": 2}}))
+
+		b, err := s.Batch()
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"g": 2}, b.Gauges, "new entries are after entries of previous run")
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := NewSpool(dir, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, s.Push(Entry{Counters: map[string]int64{"c": 1}}))
+
+		files, err := s.files()
+		require.NoError(t, err)
+		info, err := files[0].Info()
+		require.NoError(t, err)
+
+		s.maxSize = 2 * info.Size()
+		for range 3 {
+			require.NoError(t, s.Push(Entry{Counters: map[string]int64{"c": 1}}))
+		}
+
+		n, err := s.Len()
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		s, err := NewSpool(t.TempDir(), 0, time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, s.Push(Entry{Counters: map[string]int64{"old": 1}}))
+		require.NoError(t, s.Push(Entry{Counters: map[string]int64{"new": 1}}))
+
+		files, err := s.files()
+		require.NoError(t, err)
+		old := time.Now().Add(-time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(s.dir, files[0].Name()), old, old))
+
+		b, err := s.Batch()
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{"new": 1}, b.Counters)
+	})
+
+	t.Run("broken entry", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000000.json"), []byte("{"), 0o600))
+
+		s, err := NewSpool(dir, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, s.Push(Entry{Counters: map[string]int64{"c": 1}}))
+
+		b, err := s.Batch()
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{"c": 1}, b.Counters)
+		require.NoError(t, s.Commit(b))
+
+		n, err := s.Len()
+		require.NoError(t, err)
+		require.Zero(t, n, "broken entry is removed on commit")
+	})
+}
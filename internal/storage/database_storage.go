@@ -8,6 +8,7 @@ import (
 
 	"github.com/DarkOmap/metricsService/internal/models"
 	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -17,19 +18,19 @@ import (
 const (
 	queryUpdateGauges = `
 		WITH t AS (
-			INSERT INTO gauges (Name, Value) VALUES ($1, $2)
-			ON CONFLICT (Name) DO UPDATE SET Value = EXCLUDED.Value
+			INSERT INTO gauges (Tenant, Name, Value) VALUES ($1, $2, $3)
+			ON CONFLICT (Tenant, Name) DO UPDATE SET Value = EXCLUDED.Value
 			RETURNING *
 		)
-		SELECT Value FROM t WHERE Name = $1
+		SELECT Value FROM t WHERE Tenant = $1 AND Name = $2
 	`
 	queryUpdateCounters = `
 		WITH t AS (
-			INSERT INTO counters (Name, Delta) VALUES ($1, $2)
-			ON CONFLICT (Name) DO UPDATE SET Delta = counters.Delta + EXCLUDED.Delta
+			INSERT INTO counters (Tenant, Name, Delta) VALUES ($1, $2, $3)
+			ON CONFLICT (Tenant, Name) DO UPDATE SET Delta = counters.Delta + EXCLUDED.Delta
 			RETURNING *
 		)
-		SELECT Delta FROM t WHERE Name = $1
+		SELECT Delta FROM t WHERE Tenant = $1 AND Name = $2
 	`
 )
 
@@ -98,7 +99,7 @@ func (dbs *DBStorage) ValueByMetrics(ctx context.Context, m models.Metrics) (*mo
 	}
 }
 
-// GetAll returns all data from DBStorage
+// GetAll returns all data of the context's tenant from DBStorage
 func (dbs *DBStorage) GetAll(ctx context.Context) (map[string]fmt.Stringer, error) {
 	var (
 		s      string
@@ -114,10 +115,13 @@ func (dbs *DBStorage) GetAll(ctx context.Context) (map[string]fmt.Stringer, erro
 			`SELECT
 				Name, Value as Value, 0 as Delta, 'gauge' as Type
 			FROM gauges
+			WHERE Tenant = $1
 			UNION
 			SELECT
 				 Name, 0, Delta, 'counter' as Type
-			FROM counters`,
+			FROM counters
+			WHERE Tenant = $1`,
+			tenant.FromContext(ctx),
 		)
 	})
 	if err != nil {
@@ -143,16 +147,39 @@ func (dbs *DBStorage) GetAll(ctx context.Context) (map[string]fmt.Stringer, erro
 	return retMap, nil
 }
 
+// Tenants returns sorted names of tenants having metrics in DBStorage
+func (dbs *DBStorage) Tenants(ctx context.Context) ([]string, error) {
+	rows, err := retry2[pgx.Rows](ctx, dbs.retryPolicy, func() (pgx.Rows, error) {
+		return dbs.conn.Query(ctx,
+			`SELECT Tenant FROM gauges
+			UNION
+			SELECT Tenant FROM counters
+			ORDER BY 1`,
+		)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get tenants from db: %w", err)
+	}
+
+	tenants, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("parse tenants from db: %w", err)
+	}
+
+	return tenants, nil
+}
+
 // Updates updates database's datas.
 func (dbs *DBStorage) Updates(ctx context.Context, metrics []models.Metrics) error {
 	batch := &pgx.Batch{}
+	tenantName := tenant.FromContext(ctx)
 
 	for _, val := range metrics {
 		switch val.MType {
 		case models.TypeGauge:
-			batch.Queue(queryUpdateGauges, val.ID, *val.Value)
+			batch.Queue(queryUpdateGauges, tenantName, val.ID, *val.Value)
 		case models.TypeCounter:
-			batch.Queue(queryUpdateCounters, val.ID, *val.Delta)
+			batch.Queue(queryUpdateCounters, tenantName, val.ID, *val.Delta)
 		}
 	}
 
@@ -173,21 +200,30 @@ func (dbs *DBStorage) createTables() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
 
+	// Tables created before tenants were added have unique names, so names are made unique per tenant.
 	createGaugesQuery := `
 		CREATE TABLE IF NOT EXISTS gauges (
 			Id SERIAL PRIMARY KEY,
-			Name VARCHAR(150) UNIQUE,
+			Tenant VARCHAR(64) NOT NULL DEFAULT 'default',
+			Name VARCHAR(150),
 			Value DOUBLE PRECISION
 		);
-		CREATE UNIQUE INDEX IF NOT EXISTS gauge_idx ON gauges (Name);
+		ALTER TABLE gauges ADD COLUMN IF NOT EXISTS Tenant VARCHAR(64) NOT NULL DEFAULT 'default';
+		ALTER TABLE gauges DROP CONSTRAINT IF EXISTS gauges_name_key;
+		DROP INDEX IF EXISTS gauge_idx;
+		CREATE UNIQUE INDEX IF NOT EXISTS gauge_tenant_idx ON gauges (Tenant, Name);
 	`
 	createCountersQuery := `
 		CREATE TABLE IF NOT EXISTS counters (
 			Id SERIAL PRIMARY KEY,
-			Name VARCHAR(150) UNIQUE,
+			Tenant VARCHAR(64) NOT NULL DEFAULT 'default',
+			Name VARCHAR(150),
 			Delta BIGINT
 		);
-		CREATE UNIQUE INDEX IF NOT EXISTS counter_idx ON counters (Name);
+		ALTER TABLE counters ADD COLUMN IF NOT EXISTS Tenant VARCHAR(64) NOT NULL DEFAULT 'default';
+		ALTER TABLE counters DROP CONSTRAINT IF EXISTS counters_name_key;
+		DROP INDEX IF EXISTS counter_idx;
+		CREATE UNIQUE INDEX IF NOT EXISTS counter_tenant_idx ON counters (Tenant, Name);
 	`
 
 	err := pgx.BeginFunc(ctx, dbs.conn, func(tx pgx.Tx) error {
@@ -222,7 +258,7 @@ func (dbs *DBStorage) updateCounterByMetrics(ctx context.Context, id string, del
 	var newDelta int64
 
 	err := retry(ctx, dbs.retryPolicy, func() error {
-		return dbs.conn.QueryRow(ctx, queryUpdateCounters, id, *delta).Scan(&newDelta)
+		return dbs.conn.QueryRow(ctx, queryUpdateCounters, tenant.FromContext(ctx), id, *delta).Scan(&newDelta)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("update counter metric name %s delta %d: %w", id, *delta, err)
@@ -239,7 +275,7 @@ func (dbs *DBStorage) updateGaugeByMetrics(ctx context.Context, id string, value
 	var newValue float64
 
 	err := retry(ctx, dbs.retryPolicy, func() error {
-		return dbs.conn.QueryRow(ctx, queryUpdateGauges, id, *value).Scan(&newValue)
+		return dbs.conn.QueryRow(ctx, queryUpdateGauges, tenant.FromContext(ctx), id, *value).Scan(&newValue)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("update gauge metric name %s value %f: %w", id, *value, err)
@@ -251,7 +287,7 @@ func (dbs *DBStorage) updateGaugeByMetrics(ctx context.Context, id string, value
 func (dbs *DBStorage) valueCounterByMetrics(ctx context.Context, id string) (*models.Metrics, error) {
 	var c int64
 	err := retry(ctx, dbs.retryPolicy, func() error {
-		return dbs.conn.QueryRow(ctx, "SELECT Delta FROM counters WHERE Name = $1", id).Scan(&c)
+		return dbs.conn.QueryRow(ctx, "SELECT Delta FROM counters WHERE Tenant = $1 AND Name = $2", tenant.FromContext(ctx), id).Scan(&c)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("get counter in DB %s: %w", id, err)
@@ -263,7 +299,7 @@ func (dbs *DBStorage) valueCounterByMetrics(ctx context.Context, id string) (*mo
 func (dbs *DBStorage) valueGaugeByMetrics(ctx context.Context, id string) (*models.Metrics, error) {
 	var g float64
 	err := retry(ctx, dbs.retryPolicy, func() error {
-		return dbs.conn.QueryRow(ctx, "SELECT Value FROM gauges WHERE Name = $1", id).Scan(&g)
+		return dbs.conn.QueryRow(ctx, "SELECT Value FROM gauges WHERE Tenant = $1 AND Name = $2", tenant.FromContext(ctx), id).Scan(&g)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("get gauge in DB %s: %w", id, err)
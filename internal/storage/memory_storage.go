@@ -1,10 +1,12 @@
 package storage
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
 	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/DarkOmap/metricsService/internal/logger"
 	"github.com/DarkOmap/metricsService/internal/models"
 	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"go.uber.org/zap"
 )
 
@@ -25,11 +28,43 @@ type counters struct {
 	sync.RWMutex
 }
 
-// MemStorage it's in-memory storage repository
+type tenantMetrics struct {
+	Gauges   gauges   `json:"gauges"`
+	Counters counters `json:"counters"`
+}
+
+func newTenantMetrics() *tenantMetrics {
+	tm := &tenantMetrics{}
+	tm.Gauges.Data = make(map[string]Gauge)
+	tm.Counters.Data = make(map[string]Counter)
+
+	return tm
+}
+
+type tenantsData struct {
+	Data map[string]*tenantMetrics `json:"data"`
+	sync.RWMutex
+}
+
+// fileRecord it's line of storage file. Tenant is omitted for the default tenant.
+type fileRecord struct {
+	models.Metrics
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func newFileRecord(tenantName string, m *models.Metrics) fileRecord {
+	if tenantName == tenant.Default {
+		tenantName = ""
+	}
+
+	return fileRecord{Metrics: *m, Tenant: tenantName}
+}
+
+// MemStorage it's in-memory storage repository.
+// Metrics of each tenant are stored separately.
 type MemStorage struct {
 	producer      *file.Producer
-	Gauges        gauges   `json:"gauges"`
-	Counters      counters `json:"counters"`
+	tenants       tenantsData
 	storeInterval uint
 }
 
@@ -46,8 +81,7 @@ func NewMemStorage(ctx context.Context, p parameters.ServerParameters) (*MemStor
 		ms.producer = producer
 	}
 
-	ms.Counters.Data = make(map[string]Counter)
-	ms.Gauges.Data = make(map[string]Gauge)
+	ms.tenants.Data = make(map[string]*tenantMetrics)
 	ms.storeInterval = p.StoreInterval
 
 	if p.Restore && p.FileStoragePath != "" {
@@ -56,18 +90,22 @@ func NewMemStorage(ctx context.Context, p parameters.ServerParameters) (*MemStor
 			return nil, fmt.Errorf("initializing new consumer: %w", err)
 		}
 
-		m := &models.Metrics{}
+		r := &fileRecord{}
 
-		for err := consumer.Decoder.Decode(m); err != io.EOF; err = consumer.Decoder.Decode(m) {
+		for err := consumer.Decoder.Decode(r); err != io.EOF; err = consumer.Decoder.Decode(r) {
 			if err != nil && err != io.EOF {
 				return nil, fmt.Errorf("read from file for storage: %w", err)
 			}
 
-			if m.MType == models.TypeCounter {
-				ms.Counters.Data[m.ID] = Counter(*m.Delta)
+			tenantName := cmp.Or(r.Tenant, tenant.Default)
+			m := r.Metrics
+			*r = fileRecord{}
+
+			if m.MType == models.TypeCounter && m.Delta != nil {
+				ms.tenant(tenantName).Counters.Data[m.ID] = Counter(*m.Delta)
 				continue
 			}
-			_, err := ms.UpdateByMetrics(context.Background(), *m)
+			_, err := ms.UpdateByMetrics(tenant.NewContext(context.Background(), tenantName), m)
 			if err != nil {
 				return nil, fmt.Errorf("update metrics from file: %w", err)
 			}
@@ -115,23 +153,37 @@ func (ms *MemStorage) runDumping(ctx context.Context) {
 }
 
 func (ms *MemStorage) dumpStorage() error {
-	ms.Gauges.RLock()
-	ms.Counters.RLock()
-	defer ms.Gauges.RUnlock()
-	defer ms.Counters.RUnlock()
-	allGauges := maps.Clone(ms.Gauges.Data)
+	ms.tenants.RLock()
+	allTenants := maps.Clone(ms.tenants.Data)
+	ms.tenants.RUnlock()
+
+	for _, name := range sortedNames(allTenants) {
+		if err := ms.dumpTenant(name, allTenants[name]); err != nil {
+			return fmt.Errorf("dump tenant %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (ms *MemStorage) dumpTenant(name string, tm *tenantMetrics) error {
+	tm.Gauges.RLock()
+	tm.Counters.RLock()
+	defer tm.Gauges.RUnlock()
+	defer tm.Counters.RUnlock()
+	allGauges := maps.Clone(tm.Gauges.Data)
 	for idx, val := range allGauges {
 		m := models.NewMetricsForGauge(idx, float64(val))
-		err := ms.producer.WriteInFile(m)
+		err := ms.producer.WriteInFile(newFileRecord(name, m))
 		if err != nil {
 			return fmt.Errorf("write gauges in file: %w", err)
 		}
 	}
 
-	allCouters := maps.Clone(ms.Counters.Data)
+	allCouters := maps.Clone(tm.Counters.Data)
 	for idx, val := range allCouters {
 		m := models.NewMetricsForCounter(idx, int64(val))
-		err := ms.producer.WriteInFile(m)
+		err := ms.producer.WriteInFile(newFileRecord(name, m))
 		if err != nil {
 			return fmt.Errorf("write counters in file: %w", err)
 		}
@@ -139,24 +191,53 @@ func (ms *MemStorage) dumpStorage() error {
 	return nil
 }
 
+func (ms *MemStorage) lookupTenant(name string) (*tenantMetrics, bool) {
+	ms.tenants.RLock()
+	defer ms.tenants.RUnlock()
+
+	tm, ok := ms.tenants.Data[name]
+	return tm, ok
+}
+
+// tenant returns metrics of the tenant, creating them if necessary
+func (ms *MemStorage) tenant(name string) *tenantMetrics {
+	if tm, ok := ms.lookupTenant(name); ok {
+		return tm
+	}
+
+	ms.tenants.Lock()
+	defer ms.tenants.Unlock()
+
+	if tm, ok := ms.tenants.Data[name]; ok {
+		return tm
+	}
+
+	tm := newTenantMetrics()
+	ms.tenants.Data[name] = tm
+
+	return tm
+}
+
 // UpdateByMetrics updates metrics values by model
-func (ms *MemStorage) UpdateByMetrics(_ context.Context, m models.Metrics) (*models.Metrics, error) {
+func (ms *MemStorage) UpdateByMetrics(ctx context.Context, m models.Metrics) (*models.Metrics, error) {
+	tenantName := tenant.FromContext(ctx)
+
 	switch m.MType {
 	case models.TypeCounter:
-		return ms.updateCounterByMetrics(m.ID, (*Counter)(m.Delta))
+		return ms.updateCounterByMetrics(tenantName, m.ID, (*Counter)(m.Delta))
 	case models.TypeGauge:
-		return ms.updateGaugeByMetrics(m.ID, (*Gauge)(m.Value))
+		return ms.updateGaugeByMetrics(tenantName, m.ID, (*Gauge)(m.Value))
 	default:
 		return nil, ErrUnknownType
 	}
 }
 
-func (ms *MemStorage) updateCounterByMetrics(id string, delta *Counter) (*models.Metrics, error) {
+func (ms *MemStorage) updateCounterByMetrics(tenantName, id string, delta *Counter) (*models.Metrics, error) {
 	if delta == nil {
 		return nil, ErrEmptyDelta
 	}
 
-	newDelta, err := ms.addCounter(*delta, id)
+	newDelta, err := ms.addCounter(tenantName, *delta, id)
 	if err != nil {
 		return nil, fmt.Errorf("add counter: %w", err)
 	}
@@ -164,12 +245,12 @@ func (ms *MemStorage) updateCounterByMetrics(id string, delta *Counter) (*models
 	return models.NewMetricsForCounter(id, int64(newDelta)), nil
 }
 
-func (ms *MemStorage) updateGaugeByMetrics(id string, value *Gauge) (*models.Metrics, error) {
+func (ms *MemStorage) updateGaugeByMetrics(tenantName, id string, value *Gauge) (*models.Metrics, error) {
 	if value == nil {
 		return nil, ErrEmptyValue
 	}
 
-	newValue, err := ms.setGauge(*value, id)
+	newValue, err := ms.setGauge(tenantName, *value, id)
 	if err != nil {
 		return nil, fmt.Errorf("set gauge: %w", err)
 	}
@@ -178,19 +259,21 @@ func (ms *MemStorage) updateGaugeByMetrics(id string, value *Gauge) (*models.Met
 }
 
 // ValueByMetrics returns value of metrics by name and type
-func (ms *MemStorage) ValueByMetrics(_ context.Context, m models.Metrics) (*models.Metrics, error) {
+func (ms *MemStorage) ValueByMetrics(ctx context.Context, m models.Metrics) (*models.Metrics, error) {
+	tenantName := tenant.FromContext(ctx)
+
 	switch m.MType {
 	case models.TypeCounter:
-		return ms.valueCounterByMetrics(m.ID)
+		return ms.valueCounterByMetrics(tenantName, m.ID)
 	case models.TypeGauge:
-		return ms.valueGaugeByMetrics(m.ID)
+		return ms.valueGaugeByMetrics(tenantName, m.ID)
 	default:
 		return nil, ErrUnknownType
 	}
 }
 
-func (ms *MemStorage) valueCounterByMetrics(id string) (*models.Metrics, error) {
-	c, err := ms.getCounter(id)
+func (ms *MemStorage) valueCounterByMetrics(tenantName, id string) (*models.Metrics, error) {
+	c, err := ms.getCounter(tenantName, id)
 	if err != nil {
 		return nil, fmt.Errorf("get counter in mem storage%s: %w", id, err)
 	}
@@ -198,8 +281,8 @@ func (ms *MemStorage) valueCounterByMetrics(id string) (*models.Metrics, error)
 	return models.NewMetricsForCounter(id, int64(c)), nil
 }
 
-func (ms *MemStorage) valueGaugeByMetrics(id string) (*models.Metrics, error) {
-	g, err := ms.getGauge(id)
+func (ms *MemStorage) valueGaugeByMetrics(tenantName, id string) (*models.Metrics, error) {
+	g, err := ms.getGauge(tenantName, id)
 	if err != nil {
 		return nil, fmt.Errorf("get gauge in mem storage %s: %w", id, err)
 	}
@@ -207,15 +290,16 @@ func (ms *MemStorage) valueGaugeByMetrics(id string) (*models.Metrics, error) {
 	return models.NewMetricsForGauge(id, float64(g)), nil
 }
 
-func (ms *MemStorage) setGauge(g Gauge, name string) (Gauge, error) {
-	ms.Gauges.Lock()
-	defer ms.Gauges.Unlock()
-	ms.Gauges.Data[name] = g
-	retV := ms.Gauges.Data[name]
+func (ms *MemStorage) setGauge(tenantName string, g Gauge, name string) (Gauge, error) {
+	tm := ms.tenant(tenantName)
+	tm.Gauges.Lock()
+	defer tm.Gauges.Unlock()
+	tm.Gauges.Data[name] = g
+	retV := tm.Gauges.Data[name]
 
 	if ms.storeInterval == 0 {
 		m := models.NewMetricsForGauge(name, float64(g))
-		err := ms.producer.WriteInFile(m)
+		err := ms.producer.WriteInFile(newFileRecord(tenantName, m))
 		if err != nil {
 			return 0, fmt.Errorf("write gauge in file: %w", err)
 		}
@@ -224,10 +308,15 @@ func (ms *MemStorage) setGauge(g Gauge, name string) (Gauge, error) {
 	return retV, nil
 }
 
-func (ms *MemStorage) getGauge(name string) (Gauge, error) {
-	ms.Gauges.RLock()
-	v, ok := ms.Gauges.Data[name]
-	ms.Gauges.RUnlock()
+func (ms *MemStorage) getGauge(tenantName, name string) (Gauge, error) {
+	tm, ok := ms.lookupTenant(tenantName)
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	tm.Gauges.RLock()
+	v, ok := tm.Gauges.Data[name]
+	tm.Gauges.RUnlock()
 
 	if !ok {
 		return v, ErrNotFound
@@ -236,15 +325,16 @@ func (ms *MemStorage) getGauge(name string) (Gauge, error) {
 	return v, nil
 }
 
-func (ms *MemStorage) addCounter(c Counter, name string) (Counter, error) {
-	ms.Counters.Lock()
-	defer ms.Counters.Unlock()
-	ms.Counters.Data[name] += c
-	retC := ms.Counters.Data[name]
+func (ms *MemStorage) addCounter(tenantName string, c Counter, name string) (Counter, error) {
+	tm := ms.tenant(tenantName)
+	tm.Counters.Lock()
+	defer tm.Counters.Unlock()
+	tm.Counters.Data[name] += c
+	retC := tm.Counters.Data[name]
 
 	if ms.storeInterval == 0 {
 		m := models.NewMetricsForCounter(name, int64(retC))
-		err := ms.producer.WriteInFile(m)
+		err := ms.producer.WriteInFile(newFileRecord(tenantName, m))
 
 		return 0, fmt.Errorf("write counter in file: %w", err)
 	}
@@ -252,10 +342,15 @@ func (ms *MemStorage) addCounter(c Counter, name string) (Counter, error) {
 	return retC, nil
 }
 
-func (ms *MemStorage) getCounter(name string) (Counter, error) {
-	ms.Counters.RLock()
-	v, ok := ms.Counters.Data[name]
-	ms.Counters.RUnlock()
+func (ms *MemStorage) getCounter(tenantName, name string) (Counter, error) {
+	tm, ok := ms.lookupTenant(tenantName)
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	tm.Counters.RLock()
+	v, ok := tm.Counters.Data[name]
+	tm.Counters.RUnlock()
 
 	if !ok {
 		return v, ErrNotFound
@@ -264,40 +359,67 @@ func (ms *MemStorage) getCounter(name string) (Counter, error) {
 	return v, nil
 }
 
-// GetAll returns all data of metrics from mem storage
-func (ms *MemStorage) GetAll(context.Context) (retMap map[string]fmt.Stringer, err error) {
-	ms.Gauges.RLock()
-	ms.Counters.RLock()
-	defer ms.Gauges.RUnlock()
-	defer ms.Counters.RUnlock()
+// GetAll returns all data of metrics of the context's tenant from mem storage
+func (ms *MemStorage) GetAll(ctx context.Context) (retMap map[string]fmt.Stringer, err error) {
 	retMap = make(map[string]fmt.Stringer)
-	for k, v := range ms.Gauges.Data {
+
+	tm, ok := ms.lookupTenant(tenant.FromContext(ctx))
+	if !ok {
+		return
+	}
+
+	tm.Gauges.RLock()
+	tm.Counters.RLock()
+	defer tm.Gauges.RUnlock()
+	defer tm.Counters.RUnlock()
+	for k, v := range tm.Gauges.Data {
 		retMap[k] = v
 	}
 
-	for k, v := range ms.Counters.Data {
+	for k, v := range tm.Counters.Data {
 		retMap[k] = v
 	}
 
 	return
 }
 
+// Tenants returns sorted names of tenants having metrics
+func (ms *MemStorage) Tenants(context.Context) ([]string, error) {
+	ms.tenants.RLock()
+	defer ms.tenants.RUnlock()
+
+	return sortedNames(ms.tenants.Data), nil
+}
+
+func sortedNames(data map[string]*tenantMetrics) []string {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
 // PingDB returns error "for this storage type database is not supported"
 func (ms *MemStorage) PingDB(context.Context) error {
 	return fmt.Errorf("for this storage type database is not supported")
 }
 
 // Updates updates metrics on memstorage
-func (ms *MemStorage) Updates(_ context.Context, metrics []models.Metrics) error {
+func (ms *MemStorage) Updates(ctx context.Context, metrics []models.Metrics) error {
+	tenantName := tenant.FromContext(ctx)
+
 	for _, val := range metrics {
 		switch val.MType {
 		case models.TypeGauge:
-			_, err := ms.updateGaugeByMetrics(val.ID, (*Gauge)(val.Value))
+			_, err := ms.updateGaugeByMetrics(tenantName, val.ID, (*Gauge)(val.Value))
 			if err != nil {
 				return err
 			}
 		case models.TypeCounter:
-			_, err := ms.updateCounterByMetrics(val.ID, (*Counter)(val.Delta))
+			_, err := ms.updateCounterByMetrics(tenantName, val.ID, (*Counter)(val.Delta))
 			if err != nil {
 				return err
 			}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/DarkOmap/metricsService/internal/file"
 	"github.com/DarkOmap/metricsService/internal/models"
 	"github.com/DarkOmap/metricsService/internal/parameters"
+	"github.com/DarkOmap/metricsService/internal/tenant"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -52,17 +54,12 @@ func TestMemStorage_SetGauge(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: producer,
 			}
 
-			m.setGauge(tt.args.value, tt.args.name)
-			assert.Equal(t, tt.wantFields, fields{m.Gauges.Data, m.Counters.Data})
+			m.setGauge(tenant.Default, tt.args.value, tt.args.name)
+			assert.Equal(t, tt.wantFields, fields{m.tenants.Data[tenant.Default].Gauges.Data, m.tenants.Data[tenant.Default].Counters.Data})
 		})
 	}
 }
@@ -105,17 +102,12 @@ func TestMemStorage_AddCounter(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: producer,
 			}
 
-			m.addCounter(tt.args.value, tt.args.name)
-			assert.Equal(t, tt.wantFields, fields{m.Gauges.Data, m.Counters.Data})
+			m.addCounter(tenant.Default, tt.args.value, tt.args.name)
+			assert.Equal(t, tt.wantFields, fields{m.tenants.Data[tenant.Default].Gauges.Data, m.tenants.Data[tenant.Default].Counters.Data})
 		})
 	}
 }
@@ -148,15 +140,10 @@ func TestMemStorage_GetGauge(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: &file.Producer{},
 			}
-			got, err := m.getGauge(tt.args)
+			got, err := m.getGauge(tenant.Default, tt.args)
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -197,15 +184,10 @@ func TestMemStorage_GetCounter(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: &file.Producer{},
 			}
-			got, err := m.getCounter(tt.args)
+			got, err := m.getCounter(tenant.Default, tt.args)
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -279,12 +261,7 @@ func TestMemStorage_UpdateByMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ms := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:       newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer:      producer,
 				storeInterval: 1,
 			}
@@ -359,12 +336,7 @@ func TestMemStorage_ValueByMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ms := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: &file.Producer{},
 			}
 			got, err := ms.ValueByMetrics(context.Background(), tt.args.m)
@@ -428,16 +400,11 @@ func TestMemStorage_updateCounterByMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ms := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:       newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer:      producer,
 				storeInterval: 1,
 			}
-			got, err := ms.updateCounterByMetrics(tt.args.id, tt.args.delta)
+			got, err := ms.updateCounterByMetrics(tenant.Default, tt.args.id, tt.args.delta)
 			if tt.wantErr {
 				require.Error(t, err)
 				return
@@ -497,15 +464,10 @@ func TestMemStorage_updateGaugeByMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ms := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: producer,
 			}
-			got, err := ms.updateGaugeByMetrics(tt.args.id, tt.args.value)
+			got, err := ms.updateGaugeByMetrics(tenant.Default, tt.args.id, tt.args.value)
 			if tt.wantErr {
 				require.Error(t, err)
 				return
@@ -549,15 +511,10 @@ func TestMemStorage_valueCounter(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ms := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: &file.Producer{},
 			}
-			got, err := ms.valueCounterByMetrics(tt.args.id)
+			got, err := ms.valueCounterByMetrics(tenant.Default, tt.args.id)
 			if tt.wantErr {
 				require.Error(t, err)
 				return
@@ -601,15 +558,10 @@ func TestMemStorage_valueGaugeByMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ms := &MemStorage{
-				Gauges: gauges{
-					Data: tt.fields.Gauges,
-				},
-				Counters: counters{
-					Data: tt.fields.Counters,
-				},
+				tenants:  newDefaultTenant(tt.fields.Gauges, tt.fields.Counters),
 				producer: &file.Producer{},
 			}
-			got, err := ms.valueGaugeByMetrics(tt.args.id)
+			got, err := ms.valueGaugeByMetrics(tenant.Default, tt.args.id)
 			if tt.wantErr {
 				require.Error(t, err)
 				return
@@ -668,8 +620,8 @@ func TestNewMemStorage(t *testing.T) {
 		require.NoError(t, err)
 		defer ms.Close()
 		defer ms.dumpStorage()
-		require.Equal(t, wantGauges, ms.Gauges.Data)
-		require.Equal(t, wantCounters, ms.Counters.Data)
+		require.Equal(t, wantGauges, ms.tenants.Data[tenant.Default].Gauges.Data)
+		require.Equal(t, wantCounters, ms.tenants.Data[tenant.Default].Counters.Data)
 	})
 
 	t.Run("test error new consumer", func(t *testing.T) {
@@ -719,16 +671,11 @@ func TestMemStorage_dumpStorage(t *testing.T) {
 
 		ms := MemStorage{
 			producer: producer,
-			Gauges: gauges{
-				Data: map[string]Gauge{
-					"test": 1,
-				},
-			},
-			Counters: counters{
-				Data: map[string]Counter{
-					"test": 2,
-				},
-			},
+			tenants: newDefaultTenant(map[string]Gauge{
+				"test": 1,
+			}, map[string]Counter{
+				"test": 2,
+			}),
 		}
 
 		wantLine1 := []byte(`{"value":1,"id":"test","type":"gauge"}`)
@@ -763,11 +710,9 @@ func TestMemStorage_dumpStorage(t *testing.T) {
 
 		ms := MemStorage{
 			producer: producer,
-			Gauges: gauges{
-				Data: map[string]Gauge{
-					"test": 1,
-				},
-			},
+			tenants: newDefaultTenant(map[string]Gauge{
+				"test": 1,
+			}, nil),
 		}
 
 		err = ms.dumpStorage()
@@ -785,14 +730,77 @@ func TestMemStorage_dumpStorage(t *testing.T) {
 
 		ms := MemStorage{
 			producer: producer,
-			Counters: counters{
-				Data: map[string]Counter{
-					"test": 2,
-				},
-			},
+			tenants: newDefaultTenant(nil, map[string]Counter{
+				"test": 2,
+			}),
 		}
 
 		err = ms.dumpStorage()
 		require.Error(t, err)
 	})
 }
+
+func newDefaultTenant(g map[string]Gauge, c map[string]Counter) tenantsData {
+	tm := &tenantMetrics{}
+	tm.Gauges.Data = g
+	tm.Counters.Data = c
+
+	return tenantsData{Data: map[string]*tenantMetrics{tenant.Default: tm}}
+}
+
+func TestMemStorage_tenants(t *testing.T) {
+	pathToTest := filepath.Join(t.TempDir(), "metrics.json")
+
+	ms, err := NewMemStorage(context.Background(), parameters.ServerParameters{
+		StoreInterval:   10,
+		FileStoragePath: pathToTest,
+	})
+	require.NoError(t, err)
+
+	ctxA := tenant.NewContext(context.Background(), "team_a")
+	ctxB := tenant.NewContext(context.Background(), "team_b")
+
+	_, err = ms.UpdateByMetrics(ctxA, *models.NewMetricsForGauge("HeapAlloc", 1))
+	require.NoError(t, err)
+	_, err = ms.UpdateByMetrics(ctxB, *models.NewMetricsForGauge("HeapAlloc", 2))
+	require.NoError(t, err)
+	require.NoError(t, ms.Updates(ctxB, []models.Metrics{*models.NewMetricsForCounter("PollCount", 3)}))
+
+	t.Run("value by tenant", func(t *testing.T) {
+		got, err := ms.ValueByMetrics(ctxA, models.Metrics{ID: "HeapAlloc", MType: models.TypeGauge})
+		require.NoError(t, err)
+		require.Equal(t, models.NewMetricsForGauge("HeapAlloc", 1), got)
+
+		_, err = ms.ValueByMetrics(context.Background(), models.Metrics{ID: "HeapAlloc", MType: models.TypeGauge})
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("get all by tenant", func(t *testing.T) {
+		got, err := ms.GetAll(ctxB)
+		require.NoError(t, err)
+		require.Equal(t, map[string]fmt.Stringer{"HeapAlloc": Gauge(2), "PollCount": Counter(3)}, got)
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		got, err := ms.Tenants(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []string{"team_a", "team_b"}, got)
+	})
+
+	t.Run("restore tenants", func(t *testing.T) {
+		require.NoError(t, ms.dumpStorage())
+		require.NoError(t, ms.Close())
+
+		restored, err := NewMemStorage(context.Background(), parameters.ServerParameters{
+			StoreInterval:   10,
+			Restore:         true,
+			FileStoragePath: pathToTest,
+		})
+		require.NoError(t, err)
+		defer restored.Close()
+
+		got, err := restored.GetAll(ctxB)
+		require.NoError(t, err)
+		require.Equal(t, map[string]fmt.Stringer{"HeapAlloc": Gauge(2), "PollCount": Counter(3)}, got)
+	})
+}
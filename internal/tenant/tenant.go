@@ -0,0 +1,152 @@
+// Package tenant defines structures for separating metrics of different tenants.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/DarkOmap/metricsService/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Default is the tenant of requests without tenant
+const Default = "default"
+
+const headerTenant = "X-Tenant"
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Tenant errors
+var (
+	ErrInvalidName = errors.New("invalid tenant name")
+	ErrForbidden   = errors.New("tenant isn't available for token")
+)
+
+type tenantKey struct{}
+
+// NewContext returns a new context that carries the tenant.
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext returns the tenant stored in ctx or Default if there is no tenant.
+func FromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(tenantKey{}).(string); ok && name != "" {
+		return name
+	}
+
+	return Default
+}
+
+// Validate checks the tenant name.
+// The name may contain latin letters, digits, '_' and '-', and be up to 64 characters long.
+func Validate(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+
+	return nil
+}
+
+// Resolve returns the tenant of the request.
+// The tenant bound to the caller's token wins over the requested one, only admins may choose any tenant.
+func Resolve(ctx context.Context, requested string) (string, error) {
+	if id, ok := auth.FromContext(ctx); ok && id.Tenant != "" && !id.HasScope(auth.ScopeAdmin) {
+		if requested != "" && requested != id.Tenant {
+			return "", fmt.Errorf("%w: %s", ErrForbidden, requested)
+		}
+
+		return id.Tenant, nil
+	}
+
+	if requested == "" {
+		if id, ok := auth.FromContext(ctx); ok && id.Tenant != "" {
+			return id.Tenant, nil
+		}
+
+		return Default, nil
+	}
+
+	if err := Validate(requested); err != nil {
+		return "", err
+	}
+
+	return requested, nil
+}
+
+// RequestTenant middleware putting the tenant of the request to the context.
+// It must be placed after the authentication one.
+func RequestTenant(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		name, err := Resolve(r.Context(), r.Header.Get(headerTenant))
+		if err != nil {
+			http.Error(w, err.Error(), statusCodeByError(err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), name)))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// InterceptorTenant interceptor putting the tenant of the request to the context.
+// It must be placed after the authentication one.
+func InterceptorTenant(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	var requested string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(headerTenant); len(v) != 0 {
+			requested = v[0]
+		}
+	}
+
+	name, err := Resolve(ctx, requested)
+	if err != nil {
+		err = status.Error(grpcCodeByError(err), err.Error())
+		return
+	}
+
+	resp, err = handler(NewContext(ctx, name), req)
+
+	return
+}
+
+// SetHeader sets the tenant header of the request. Empty name is ignored.
+func SetHeader(h http.Header, name string) {
+	if name != "" {
+		h.Set(headerTenant, name)
+	}
+}
+
+// InterceptorAddTenant returns an interceptor that adds the tenant to the metadata.
+func InterceptorAddTenant(name string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if name != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, headerTenant, name)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func statusCodeByError(err error) int {
+	if errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusBadRequest
+}
+
+func grpcCodeByError(err error) codes.Code {
+	if errors.Is(err, ErrForbidden) {
+		return codes.PermissionDenied
+	}
+
+	return codes.InvalidArgument
+}
@@ -0,0 +1,136 @@
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DarkOmap/metricsService/internal/auth"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/interop"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+func TestResolve(t *testing.T) {
+	bound := auth.NewContext(context.Background(), &auth.Identity{Tenant: "team_a", Scopes: []auth.Scope{auth.ScopeWrite}})
+	admin := auth.NewContext(context.Background(), &auth.Identity{Tenant: "team_a", Scopes: []auth.Scope{auth.ScopeAdmin}})
+	unbound := auth.NewContext(context.Background(), &auth.Identity{Scopes: []auth.Scope{auth.ScopeWrite}})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		requested string
+		want      string
+		wantErr   error
+	}{
+		{name: "no identity no header", ctx: context.Background(), want: Default},
+		{name: "no identity with header", ctx: context.Background(), requested: "team_b", want: "team_b"},
+		{name: "invalid name", ctx: context.Background(), requested: "team b", wantErr: ErrInvalidName},
+		{name: "bound token", ctx: bound, want: "team_a"},
+		{name: "bound token same header", ctx: bound, requested: "team_a", want: "team_a"},
+		{name: "bound token other header", ctx: bound, requested: "team_b", wantErr: ErrForbidden},
+		{name: "admin default", ctx: admin, want: "team_a"},
+		{name: "admin other header", ctx: admin, requested: "team_b", want: "team_b"},
+		{name: "unbound token", ctx: unbound, requested: "team_b", want: "team_b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.ctx, tt.requested)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRequestTenant(t *testing.T) {
+	h := RequestTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(FromContext(r.Context())))
+	}))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	t.Run("default", func(t *testing.T) {
+		res, err := resty.New().R().Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, Default, string(res.Body()))
+	})
+
+	t.Run("header", func(t *testing.T) {
+		req := resty.New().R()
+		SetHeader(req.Header, "team_a")
+
+		res, err := req.Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, "team_a", string(res.Body()))
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		res, err := resty.New().R().SetHeader(headerTenant, "team/a").Get(srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+	})
+}
+
+func TestInterceptorTenant(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(InterceptorTenant))
+
+	testgrpc.RegisterTestServiceServer(
+		s,
+		interop.NewTestServer(),
+	)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			require.FailNow(t, err.Error())
+		}
+	}()
+
+	defer s.Stop()
+
+	tests := []struct {
+		name   string
+		tenant string
+		want   codes.Code
+	}{
+		{name: "without tenant", want: codes.OK},
+		{name: "with tenant", tenant: "team_a", want: codes.OK},
+		{name: "invalid tenant", tenant: "team a", want: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.NewClient(
+				lis.Addr().String(),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithUnaryInterceptor(InterceptorAddTenant(tt.tenant)),
+			)
+
+			require.NoError(t, err)
+			defer conn.Close()
+
+			client := testgrpc.NewTestServiceClient(conn)
+			_, err = client.EmptyCall(context.Background(), &testgrpc.Empty{})
+
+			require.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
@@ -52,6 +52,112 @@ const docTemplate = `{
                 }
             }
         },
+        "/agent/config": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Return versioned config of the agent sending the request, config of agent's group or default config.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agent"
+                ],
+                "summary": "Return config of agent",
+                "operationId": "agentConfig",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "\"prod\"",
+                        "description": "Agent's group",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the applied config",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/agentconfig.Document"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Return agents seen by the server with their last request time. Requires admin scope.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Agents"
+                ],
+                "summary": "Return agents",
+                "operationId": "agentsAgents",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/inventory.Agent"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/ping": {
             "get": {
                 "security": [
@@ -84,6 +190,95 @@ const docTemplate = `{
                 }
             }
         },
+        "/tenants": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Return names of tenants having metrics. Requires admin scope.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tenants"
+                ],
+                "summary": "Return tenants",
+                "operationId": "tenantsTenants",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Return all metric value of tenant. Requires admin scope.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "Tenants"
+                ],
+                "summary": "Return all metrics of tenant",
+                "operationId": "tenantsAll",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "\"default\"",
+                        "description": "Tenant's name",
+                        "name": "tenant",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/update": {
             "post": {
                 "security": [
@@ -359,6 +554,53 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "agentconfig.Document": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "type": "object"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "inventory.Agent": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "first_seen": {
+                    "type": "string"
+                },
+                "hostname": {
+                    "type": "string"
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                },
+                "report_interval": {
+                    "description": "ReportInterval it's report interval of agent in seconds, zero if agent doesn't send it",
+                    "type": "integer"
+                },
+                "stale": {
+                    "type": "boolean"
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "transport": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
         "models.Metrics": {
             "description": "Metric information type may be \"gauge\" or \"counter\"",
             "type": "object",
@@ -393,6 +635,18 @@ const docTemplate = `{
         {
             "description": "\"Query group for metrics data retrieval\"",
             "name": "Value"
+        },
+        {
+            "description": "\"Query group for tenants administration\"",
+            "name": "Tenants"
+        },
+        {
+            "description": "\"Query group for agents inventory\"",
+            "name": "Agents"
+        },
+        {
+            "description": "\"Query group for agents configuration\"",
+            "name": "Agent"
         }
     ]
 }`